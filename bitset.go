@@ -0,0 +1,146 @@
+package ssego
+
+import "math/bits"
+
+// DocIDの集合を、DocIDの位置のビットを立てたビット列で表す
+type bitset struct {
+	words []uint64
+}
+
+func (b *bitset) add(docID DocumentID) {
+	i := int(docID / 64)
+	for len(b.words) <= i {
+		b.words = append(b.words, 0)
+	}
+	b.words[i] |= 1 << uint(docID%64)
+}
+
+func (b *bitset) contains(docID DocumentID) bool {
+	i := int(docID / 64)
+	return docID >= 0 && i < len(b.words) && b.words[i]&(1<<uint(docID%64)) != 0
+}
+
+// キャッシュしたbitsetを共有できるように、集合の演算は新しいbitsetを返す
+
+// 両方に含まれるDocIDの集合
+func (b *bitset) and(other *bitset) *bitset {
+	n := len(b.words)
+	if len(other.words) < n {
+		n = len(other.words)
+	}
+	result := &bitset{words: make([]uint64, n)}
+	for i := range result.words {
+		result.words[i] = b.words[i] & other.words[i]
+	}
+	return result
+}
+
+// どちらかに含まれるDocIDの集合
+func (b *bitset) or(other *bitset) *bitset {
+	long, short := b, other
+	if len(long.words) < len(short.words) {
+		long, short = short, long
+	}
+	result := &bitset{words: append([]uint64(nil), long.words...)}
+	for i, word := range short.words {
+		result.words[i] |= word
+	}
+	return result
+}
+
+// otherに含まれないDocIDの集合
+func (b *bitset) andNot(other *bitset) *bitset {
+	result := &bitset{words: append([]uint64(nil), b.words...)}
+	for i := 0; i < len(result.words) && i < len(other.words); i++ {
+		result.words[i] &^= other.words[i]
+	}
+	return result
+}
+
+// 同じDocIDの集合か
+func (b *bitset) equal(other *bitset) bool {
+	long, short := b, other
+	if len(long.words) < len(short.words) {
+		long, short = short, long
+	}
+	for i, word := range long.words {
+		if i < len(short.words) && word != short.words[i] || i >= len(short.words) && word != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// 含まれるDocIDの数
+func (b *bitset) count() int {
+	n := 0
+	for _, word := range b.words {
+		n += bits.OnesCount64(word)
+	}
+	return n
+}
+
+// おおよそのメモリ使用量(バイト)
+func (b *bitset) size() int64 {
+	return int64(8 * len(b.words))
+}
+
+// docID以上で最小のDocIDを返す
+func (b *bitset) next(docID DocumentID) (DocumentID, bool) {
+	if docID < 0 {
+		docID = 0
+	}
+	i := int(docID / 64)
+	if i >= len(b.words) {
+		return 0, false
+	}
+	// docIDより前のビットを落として探し始める
+	word := b.words[i] >> uint(docID%64) << uint(docID%64)
+	for {
+		if word != 0 {
+			return DocumentID(i*64 + bits.TrailingZeros64(word)), true
+		}
+		if i++; i >= len(b.words) {
+			return 0, false
+		}
+		word = b.words[i]
+	}
+}
+
+// フィルタにマッチするドキュメントの集合
+// negatedならbitsに含まれないドキュメントの集合を表すので、NOTの条件をすべてのドキュメントを列挙せずに表せる
+type docSet struct {
+	bits    *bitset
+	negated bool
+}
+
+// すべてのドキュメントの集合
+func allDocs() *docSet {
+	return &docSet{bits: &bitset{}, negated: true}
+}
+
+func (s *docSet) contains(docID DocumentID) bool {
+	return s.bits.contains(docID) != s.negated
+}
+
+func (s *docSet) and(other *docSet) *docSet {
+	switch {
+	case !s.negated && !other.negated:
+		return &docSet{bits: s.bits.and(other.bits)}
+	case !s.negated:
+		return &docSet{bits: s.bits.andNot(other.bits)}
+	case !other.negated:
+		return &docSet{bits: other.bits.andNot(s.bits)}
+	default:
+		return &docSet{bits: s.bits.or(other.bits), negated: true}
+	}
+}
+
+// ド・モルガンの法則でandに置き換える
+func (s *docSet) or(other *docSet) *docSet {
+	return s.not().and(other.not()).not()
+}
+
+func (s *docSet) not() *docSet {
+	return &docSet{bits: s.bits, negated: !s.negated}
+}
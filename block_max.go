@@ -0,0 +1,53 @@
+package ssego
+
+import (
+	"sort"
+)
+
+// ブロックごとのスコア上限値を計算するときの1ブロックあたりのポスティング数
+const blockSize = 64
+
+// ポスティングリストをblockSize件ずつに区切ったブロックの統計情報
+type BlockMax struct {
+	LastDocID DocumentID // ブロック内で最大のDocID
+	MaxTF     int        // ブロック内で最大の出現回数
+}
+
+// 用語ごとのスコア上限値を求めるためのメタデータ
+// 動的枝刈り(WAND, Block-Max WAND)で、スコアが上位K件に入らないドキュメントを読み飛ばすために使う
+type BlockMaxes struct {
+	MaxTF  int        // ポスティングリスト全体で最大の出現回数
+	Blocks []BlockMax // ブロックごとの統計情報
+}
+
+// ポスティングリストからブロックごとの最大出現回数を計算する
+func NewBlockMaxes(pl PostingsList) *BlockMaxes {
+	bm := &BlockMaxes{}
+	for i, docID := range pl.docIDs {
+		termFreq := pl.termFreqs[i]
+		if i%blockSize == 0 {
+			bm.Blocks = append(bm.Blocks, BlockMax{})
+		}
+		block := &bm.Blocks[len(bm.Blocks)-1]
+		block.LastDocID = docID
+		if block.MaxTF < termFreq {
+			block.MaxTF = termFreq
+		}
+		if bm.MaxTF < termFreq {
+			bm.MaxTF = termFreq
+		}
+	}
+	return bm
+}
+
+// target以上のDocIDを含む最初のブロックを返す
+// そのようなブロックが存在しない場合はfalseを返す
+func (bm *BlockMaxes) block(target DocumentID) (BlockMax, bool) {
+	i := sort.Search(len(bm.Blocks), func(i int) bool {
+		return bm.Blocks[i].LastDocID >= target
+	})
+	if i == len(bm.Blocks) {
+		return BlockMax{}, false
+	}
+	return bm.Blocks[i], true
+}
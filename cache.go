@@ -0,0 +1,125 @@
+package ssego
+
+import (
+	"container/list"
+	"sync"
+)
+
+// 読み込んだ用語ごとのデータ
+type cachedTerm struct {
+	postings   *PostingsList // ポスティングリスト
+	blockMaxes *BlockMaxes   // ブロックごとの最大出現回数
+	size       int64         // おおよそのメモリ使用量(バイト)
+}
+
+func newCachedTerm(postings *PostingsList, blockMaxes *BlockMaxes) *cachedTerm {
+	// DocID, 出現回数, 出現位置の開始位置, 出現位置はいずれも8バイト
+	size := int64(8 * (len(postings.docIDs) + len(postings.termFreqs) + len(postings.offsets) + len(postings.positions)))
+	// ブロックはDocIDと出現回数の2つ
+	size += int64(16 * len(blockMaxes.Blocks))
+	return &cachedTerm{postings, blockMaxes, size}
+}
+
+// lruCacheはメモリ使用量の合計がmaxBytesを超えないように、最も長く使われていないデータから捨てるキャッシュ
+// 用語のポスティングリストやフィルタにマッチするドキュメントの集合をキャッシュする
+// 複数のgoroutineから同時に使用できる
+type lruCache struct {
+	mu       sync.Mutex
+	maxBytes int64                    // 保持するデータのサイズの上限
+	bytes    int64                    // 保持しているデータのサイズの合計
+	ll       *list.List               // 最近使われた順に並べたキーのリスト
+	items    map[string]*list.Element // キーからリストの要素への参照
+}
+
+type lruEntry struct {
+	key   string
+	value interface{}
+	size  int64 // おおよそのメモリ使用量(バイト)
+}
+
+func newLRUCache(maxBytes int64) *lruCache {
+	return &lruCache{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (c *lruCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (c *lruCache) add(key string, value interface{}, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// 上限より大きいデータはキャッシュしない
+	if size > c.maxBytes {
+		return
+	}
+
+	if e, ok := c.items[key]; ok {
+		entry := e.Value.(*lruEntry)
+		c.bytes += size - entry.size
+		entry.value, entry.size = value, size
+		c.ll.MoveToFront(e)
+	} else {
+		c.items[key] = c.ll.PushFront(&lruEntry{key, value, size})
+		c.bytes += size
+	}
+
+	// 上限を超えた分を古いものから捨てる
+	for c.bytes > c.maxBytes {
+		e := c.ll.Back()
+		entry := e.Value.(*lruEntry)
+		c.ll.Remove(e)
+		delete(c.items, entry.key)
+		c.bytes -= entry.size
+	}
+}
+
+// loadGroupは同じ用語の読み込みが同時に要求されたとき、ファイルの読み込みを1回にまとめる
+type loadGroup struct {
+	mu    sync.Mutex
+	calls map[string]*loadCall
+}
+
+type loadCall struct {
+	wg    sync.WaitGroup
+	value *cachedTerm
+	err   error
+}
+
+// termの読み込みが実行中であればその結果を待ち、そうでなければloadを実行する
+func (g *loadGroup) do(term string, load func() (*cachedTerm, error)) (*cachedTerm, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*loadCall)
+	}
+	if call, ok := g.calls[term]; ok {
+		g.mu.Unlock()
+		call.wg.Wait()
+		return call.value, call.err
+	}
+	call := &loadCall{}
+	call.wg.Add(1)
+	g.calls[term] = call
+	g.mu.Unlock()
+
+	call.value, call.err = load()
+	call.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, term)
+	g.mu.Unlock()
+
+	return call.value, call.err
+}
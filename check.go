@@ -0,0 +1,309 @@
+package ssego
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// インデクスの検査で見つかった問題
+type CheckProblem struct {
+	Term    string     // 問題のあるポスティングリストの用語。インデクス全体の問題では空
+	DocID   DocumentID // 問題のあるドキュメント。特定のドキュメントによらない問題では0
+	Message string
+}
+
+func (p CheckProblem) String() string {
+	var where []string
+	if p.Term != "" {
+		where = append(where, "term "+strconv.Quote(p.Term))
+	}
+	if p.DocID != 0 {
+		where = append(where, fmt.Sprintf("doc %d", p.DocID))
+	}
+	if len(where) == 0 {
+		return p.Message
+	}
+	return strings.Join(where, ", ") + ": " + p.Message
+}
+
+// インデクスの検査結果
+type CheckReport struct {
+	Generation       int // 検査した世代
+	Terms            int // ポスティングリストのファイル数
+	Postings         int // Postingの総数
+	DocCount         int // _0.dcに記録されたドキュメント数
+	ExpectedDocCount int // DocumentStoreから求めたドキュメント数
+	Problems         []CheckProblem
+	Fixed            bool // 問題を修復した新しい世代をコミットしたかどうか
+}
+
+// 問題が見つからなければtrue
+func (r *CheckReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// コミット済みの世代のインデクスファイルを検査する
+//   - すべてのポスティングリストが読み込めること
+//   - DocIDが狭義単調増加であること
+//   - TermFrequencyが出現位置の数と等しく、出現位置が昇順であること
+//   - ブロックごとの最大出現回数がポスティングリストと一致すること
+//   - _termsの用語の統計情報がポスティングリストと一致すること
+//   - _0.dcのドキュメント数と_docsのドキュメントがDocumentStoreと一致すること
+//   - すべてのDocIDがDocumentStoreに存在すること
+//
+// Flushされていない追加・削除はWALから求めて、DocumentStoreとの比較に含める
+// fixがtrueで問題が見つかった場合は、修復したポスティングリストで新しい世代を作成してコミットする
+// 読み込めないポスティングリストは修復できないので、その用語は新しい世代から取り除かれる
+func (e *Engine) Check(fix bool) (*CheckReport, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	commit, err := readCommit(e.indexDir)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := e.documentStore.fetchTermCounts()
+	if err != nil {
+		return nil, err
+	}
+	records, err := e.wal.records(commit.WALSeq)
+	if err != nil {
+		return nil, err
+	}
+
+	// Flushされていない削除はまだインデクスに含まれているが、DocumentStoreからは削除済み
+	added := make(map[DocumentID]bool)
+	deleted := make(map[DocumentID]bool)
+	for _, record := range records {
+		switch record.Op {
+		case walAdd:
+			added[record.DocID] = true
+		case walDelete:
+			deleted[record.DocID] = true
+		}
+	}
+	exists := func(docID DocumentID) bool {
+		_, ok := stored[docID]
+		return (ok || deleted[docID]) && !added[docID]
+	}
+	report := &CheckReport{Generation: commit.Generation}
+	for docID := range stored {
+		if !added[docID] {
+			report.ExpectedDocCount++
+		}
+	}
+	for docID := range deleted {
+		if _, ok := stored[docID]; !ok && !added[docID] {
+			report.ExpectedDocCount++
+		}
+	}
+
+	dir := committedDir(e.indexDir)
+	terms, err := termFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	report.Terms = len(terms)
+	// 修復したポスティングリストから求めた用語の統計情報
+	dict := []TermStats{}
+	for _, term := range terms {
+		list, problems := checkTerm(dir, term, exists)
+		report.Postings += list.Len()
+		report.Problems = append(report.Problems, problems...)
+		if list.Len() > 0 {
+			dict = append(dict, TermStats{Term: term, DocFreq: list.Len(), TotalTermFreq: len(list.positions)})
+		}
+	}
+	// ポスティングリストに問題があれば統計情報も一致しないので、問題がない場合のみ比較する
+	if recorded, err := readTermDictionary(dir); err != nil {
+		report.Problems = append(report.Problems, CheckProblem{Message: fmt.Sprintf("cannot read term dictionary: %v", err)})
+	} else if recorded == nil && commit.Generation > 0 {
+		report.Problems = append(report.Problems, CheckProblem{Message: "term dictionary is missing"})
+	} else if recorded != nil && report.OK() && !reflect.DeepEqual(recorded, dict) {
+		report.Problems = append(report.Problems, CheckProblem{Message: "term dictionary does not match the postings"})
+	}
+
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, "_0.dc"))
+	if err == nil {
+		report.DocCount, err = strconv.Atoi(string(bytes))
+	}
+	if err != nil {
+		report.Problems = append(report.Problems, CheckProblem{Message: fmt.Sprintf("cannot read document count: %v", err)})
+	} else if report.DocCount != report.ExpectedDocCount {
+		report.Problems = append(report.Problems, CheckProblem{
+			Message: fmt.Sprintf("document count is %d, but the store has %d", report.DocCount, report.ExpectedDocCount),
+		})
+	}
+	// 世代に含まれるドキュメントの集合
+	expectedDocs := &bitset{}
+	for docID := range stored {
+		if exists(docID) {
+			expectedDocs.add(docID)
+		}
+	}
+	for docID := range deleted {
+		if exists(docID) {
+			expectedDocs.add(docID)
+		}
+	}
+	if live, err := readLiveDocs(dir); err != nil {
+		report.Problems = append(report.Problems, CheckProblem{Message: fmt.Sprintf("cannot read live documents: %v", err)})
+	} else if live == nil && commit.Generation > 0 {
+		report.Problems = append(report.Problems, CheckProblem{Message: "live documents are not recorded"})
+	} else if live != nil && !live.equal(expectedDocs) {
+		report.Problems = append(report.Problems, CheckProblem{
+			Message: fmt.Sprintf("live documents record %d documents, but the store has %d", live.count(), expectedDocs.count()),
+		})
+	}
+	if commit.Generation > 0 && commit.DocCount != report.ExpectedDocCount {
+		report.Problems = append(report.Problems, CheckProblem{
+			Message: fmt.Sprintf("commit point records %d documents, but the store has %d", commit.DocCount, report.ExpectedDocCount),
+		})
+	}
+
+	if !fix || report.OK() {
+		return report, nil
+	}
+
+	// 修復したポスティングリストで新しい世代を作成する
+	writer := NewIndexWriter(e.indexDir)
+	err = writer.commit(commit.WALSeq, e.nextDocID, func(tmpDir string, _ commitPoint) (int, error) {
+		for _, term := range terms {
+			list, _ := checkTerm(dir, term, exists)
+			if list.Len() == 0 {
+				continue
+			}
+			if err := writer.postingsList(tmpDir, term, list); err != nil {
+				return 0, err
+			}
+			if err := writer.blockMaxes(tmpDir, term, list); err != nil {
+				return 0, err
+			}
+		}
+		if err := writeTermDictionary(tmpDir, dict); err != nil {
+			return 0, err
+		}
+		stored, err := readStoredFields(dir)
+		if err != nil {
+			return 0, err
+		}
+		for docID := range stored {
+			if !exists(docID) {
+				delete(stored, docID)
+			}
+		}
+		if err := writeStoredFields(tmpDir, stored); err != nil {
+			return 0, err
+		}
+		// 読み込めないタイトルは書き込まず、次のFlushでDocumentStoreから読み込み直す
+		titles, _ := readTitles(dir)
+		for docID := range titles {
+			if !exists(docID) {
+				delete(titles, docID)
+			}
+		}
+		if err := writeTitles(tmpDir, titles); err != nil {
+			return 0, err
+		}
+		if err := writeLiveDocs(tmpDir, expectedDocs); err != nil {
+			return 0, err
+		}
+		return report.ExpectedDocCount, writer.docCount(tmpDir, report.ExpectedDocCount)
+	})
+	if err != nil {
+		return nil, err
+	}
+	e.indexReader = NewIndexReaderSize(e.indexDir, e.cacheBytes)
+	e.nrt = nil
+	report.Fixed = true
+	return report, nil
+}
+
+// 用語のポスティングリストとブロックごとの最大出現回数を検査し、修復したポスティングリストを返す
+// 読み込めない場合は空のポスティングリストを返す
+func checkTerm(dir, term string, exists func(DocumentID) bool) (PostingsList, []CheckProblem) {
+	problem := func(docID DocumentID, format string, args ...interface{}) CheckProblem {
+		return CheckProblem{Term: term, DocID: docID, Message: fmt.Sprintf(format, args...)}
+	}
+
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, termFileName(term)))
+	if err != nil {
+		return NewPostingsList(), []CheckProblem{problem(0, "cannot read postings: %v", err)}
+	}
+	var postings []Posting
+	if err := json.Unmarshal(bytes, &postings); err != nil {
+		return NewPostingsList(), []CheckProblem{problem(0, "cannot parse postings: %v", err)}
+	}
+
+	var problems []CheckProblem
+	for i, p := range postings {
+		if i > 0 && p.DocID <= postings[i-1].DocID {
+			problems = append(problems, problem(p.DocID, "DocID is not greater than the previous DocID %d", postings[i-1].DocID))
+		}
+		if p.TermFrequency != len(p.Positions) {
+			problems = append(problems, problem(p.DocID, "TermFrequency is %d, but there are %d positions", p.TermFrequency, len(p.Positions)))
+		}
+		for j := 1; j < len(p.Positions); j++ {
+			if p.Positions[j] <= p.Positions[j-1] {
+				problems = append(problems, problem(p.DocID, "positions are not ascending"))
+				break
+			}
+		}
+		if !exists(p.DocID) {
+			problems = append(problems, problem(p.DocID, "document does not exist in the store"))
+		}
+	}
+	list := repairPostings(postings, exists)
+
+	var blockMaxes *BlockMaxes
+	bytes, err = ioutil.ReadFile(filepath.Join(dir, termFileName(term)+blockMaxExt))
+	if os.IsNotExist(err) {
+		problems = append(problems, problem(0, "block max file is missing"))
+	} else if err == nil && json.Unmarshal(bytes, &blockMaxes) == nil {
+		if !reflect.DeepEqual(blockMaxes, NewBlockMaxes(list)) && len(problems) == 0 {
+			problems = append(problems, problem(0, "block maxes do not match the postings"))
+		}
+	} else {
+		problems = append(problems, problem(0, "cannot read block maxes: %v", err))
+	}
+	return list, problems
+}
+
+// DocIDの昇順に並べ替えて同じDocIDのPostingをまとめ、出現位置からTermFrequencyを求め直す
+// DocumentStoreに存在しないドキュメントと、出現位置を持たないPostingは取り除く
+func repairPostings(postings []Posting, exists func(DocumentID) bool) PostingsList {
+	sort.SliceStable(postings, func(i, j int) bool {
+		return postings[i].DocID < postings[j].DocID
+	})
+
+	list := NewPostingsList()
+	for i := 0; i < len(postings); {
+		docID := postings[i].DocID
+		var positions []int
+		for ; i < len(postings) && postings[i].DocID == docID; i++ {
+			positions = append(positions, postings[i].Positions...)
+		}
+		if !exists(docID) {
+			continue
+		}
+		sort.Ints(positions)
+		var unique []int
+		for _, position := range positions {
+			if len(unique) == 0 || position != unique[len(unique)-1] {
+				unique = append(unique, position)
+			}
+		}
+		if len(unique) == 0 {
+			continue
+		}
+		list.add(&Posting{DocID: docID, Positions: unique, TermFrequency: len(unique)})
+	}
+	return list
+}
@@ -0,0 +1,146 @@
+package ssego
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCheckTerm(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exists := func(docID DocumentID) bool { return docID != 9 }
+	type testCase struct {
+		term     string
+		postings string
+		problems []CheckProblem
+		expected PostingsList
+	}
+	testCases := []testCase{
+		{
+			term:     "sir",
+			postings: `[{"DocID":1,"Positions":[3],"TermFrequency":1},{"DocID":3,"Positions":[1,3],"TermFrequency":2}]`,
+			expected: NewPostingsList(NewPosting(1, 3), NewPosting(3, 1, 3)),
+		},
+		{
+			term:     "quarrel",
+			postings: `[{"DocID":3,"Positions":[0],"TermFrequency":1},{"DocID":1,"Positions":[2],"TermFrequency":1},{"DocID":3,"Positions":[4],"TermFrequency":1}]`,
+			problems: []CheckProblem{
+				{"quarrel", 1, "DocID is not greater than the previous DocID 3"},
+			},
+			expected: NewPostingsList(NewPosting(1, 2), NewPosting(3, 0, 4)),
+		},
+		{
+			term:     "no",
+			postings: `[{"DocID":2,"Positions":[5,1],"TermFrequency":1},{"DocID":9,"Positions":[0],"TermFrequency":1}]`,
+			problems: []CheckProblem{
+				{"no", 2, "TermFrequency is 1, but there are 2 positions"},
+				{"no", 2, "positions are not ascending"},
+				{"no", 9, "document does not exist in the store"},
+			},
+			expected: NewPostingsList(NewPosting(2, 1, 5)),
+		},
+		{
+			term:     "better",
+			postings: `[{"DocID":2,`,
+			problems: []CheckProblem{
+				{"better", 0, "cannot parse postings: unexpected end of JSON input"},
+			},
+			expected: NewPostingsList(),
+		},
+	}
+
+	for _, testCase := range testCases {
+		if err := ioutil.WriteFile(filepath.Join(dir, testCase.term), []byte(testCase.postings), 0666); err != nil {
+			t.Fatal(err)
+		}
+		// ブロックごとの最大出現回数は修復後のポスティングリストから作成しておく
+		if err := NewIndexWriter(dir).blockMaxes(dir, testCase.term, testCase.expected); err != nil {
+			t.Fatal(err)
+		}
+
+		list, problems := checkTerm(dir, testCase.term, exists)
+		if !reflect.DeepEqual(problems, testCase.problems) {
+			t.Fatalf("%s: got:%v\nexpected:%v\n", testCase.term, problems, testCase.problems)
+		}
+		if !reflect.DeepEqual(list, testCase.expected) {
+			t.Fatalf("%s: got:%v\nexpected:%v\n", testCase.term, list, testCase.expected)
+		}
+	}
+
+	// ブロックごとの最大出現回数がない
+	if err := os.Remove(filepath.Join(dir, "sir"+blockMaxExt)); err != nil {
+		t.Fatal(err)
+	}
+	_, problems := checkTerm(dir, "sir", exists)
+	expected := []CheckProblem{{"sir", 0, "block max file is missing"}}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", problems, expected)
+	}
+}
+
+func TestCheckTermDictionary(t *testing.T) {
+	e := newTestEngine(t, newMemoryStore())
+	defer e.Close()
+	for _, doc := range []string{"Do you quarrel, sir?", "Quarrel sir! no, sir!", "No better."} {
+		if _, err := e.AddDocument("doc", strings.NewReader(doc)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	dir := committedDir(e.indexDir)
+	expected, err := readTermDictionary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report, err := e.Check(false); err != nil || !report.OK() {
+		t.Fatalf("got: %+v, %v\nwant: no problems", report, err)
+	}
+
+	// ポスティングリストと一致しない_termsと、存在しない_termsを検出する
+	if err := writeTermDictionary(dir, []TermStats{{Term: "sir", DocFreq: 1, TotalTermFreq: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := e.Check(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	problems := []CheckProblem{{Message: "term dictionary does not match the postings"}}
+	if !reflect.DeepEqual(report.Problems, problems) {
+		t.Fatalf("got:%v\nexpected:%v\n", report.Problems, problems)
+	}
+	if err := os.Remove(filepath.Join(dir, termDictFileName)); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = e.Check(false); err != nil {
+		t.Fatal(err)
+	}
+	problems = []CheckProblem{{Message: "term dictionary is missing"}}
+	if !reflect.DeepEqual(report.Problems, problems) {
+		t.Fatalf("got:%v\nexpected:%v\n", report.Problems, problems)
+	}
+
+	// 修復した世代には_termsを書き込む
+	if report, err = e.Check(true); err != nil || !report.Fixed {
+		t.Fatalf("got: %+v, %v\nwant: fixed", report, err)
+	}
+	got, err := readTermDictionary(committedDir(e.indexDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+	if report, err := e.Check(false); err != nil || !report.OK() {
+		t.Fatalf("got: %+v, %v\nwant: no problems", report, err)
+	}
+}
@@ -0,0 +1,117 @@
+package ssego
+
+import (
+	"container/heap"
+)
+
+// Collectorは検索でマッチしたドキュメントを1件ずつ受け取る
+// 上位K件の収集やヒット件数のカウントなど、結果の集め方を差し替えられるようにする
+type Collector interface {
+	Collect(doc *ScoreDoc)
+}
+
+// 上位K件を保持し、検索後にTopDocsとして返すCollector
+type topDocsCollector interface {
+	Collector
+	TopDocs() *TopDocs
+}
+
+// TopKCollectorはスコアの高い順に上位K件のみを保持するCollector
+// 全件をソートせず、サイズKの最小ヒープで足切りしながら収集する
+type TopKCollector struct {
+	k         int          // 保持する件数
+	totalHits int          // マッチしたドキュメントの総数
+	docs      scoreDocHeap // 上位K件を保持する最小ヒープ
+}
+
+func NewTopKCollector(k int) *TopKCollector {
+	if k < 0 {
+		k = 0
+	}
+	return &TopKCollector{k: k, docs: make(scoreDocHeap, 0, k)}
+}
+
+func (c *TopKCollector) Collect(doc *ScoreDoc) {
+	c.totalHits++
+	if c.k == 0 {
+		return
+	}
+	if len(c.docs) < c.k {
+		heap.Push(&c.docs, doc)
+		return
+	}
+	// ヒープの先頭(K件中で最も順位の低いドキュメント)より上位なら入れ替える
+	if c.docs.less(c.docs[0], doc) {
+		c.docs[0] = doc
+		heap.Fix(&c.docs, 0)
+	}
+}
+
+// 上位K件に入るために超えなければならないスコアを返す
+// K件集まるまではどのドキュメントも上位に入りうるのでfalseを返す
+// DocIDの昇順に評価していれば、同点のドキュメントは後から来たほうが順位が低いので上位には入らない
+func (c *TopKCollector) threshold() (float64, bool) {
+	if c.k == 0 || len(c.docs) < c.k {
+		return 0, false
+	}
+	return c.docs[0].score, true
+}
+
+// 収集した結果をスコアの降順(同点の場合はDocIDの昇順)で返す
+func (c *TopKCollector) TopDocs() *TopDocs {
+	docs := make([]*ScoreDoc, len(c.docs))
+	h := make(scoreDocHeap, len(c.docs))
+	copy(h, c.docs)
+	for i := len(docs) - 1; i >= 0; i-- {
+		docs[i] = heap.Pop(&h).(*ScoreDoc)
+	}
+	return &TopDocs{
+		totalHits: c.totalHits,
+		scoreDocs: docs,
+	}
+}
+
+// TotalHitCountCollectorはスコアを保持せずヒット件数のみを数えるCollector
+type TotalHitCountCollector struct {
+	totalHits int
+}
+
+func NewTotalHitCountCollector() *TotalHitCountCollector {
+	return &TotalHitCountCollector{}
+}
+
+func (c *TotalHitCountCollector) Collect(doc *ScoreDoc) {
+	c.totalHits++
+}
+
+func (c *TotalHitCountCollector) TotalHits() int {
+	return c.totalHits
+}
+
+// 順位の低いドキュメントを先頭に持つ最小ヒープ
+type scoreDocHeap []*ScoreDoc
+
+// aがbより順位が低いか
+// スコアが同じ場合はDocIDの大きいほうを低い順位とする
+func (h scoreDocHeap) less(a, b *ScoreDoc) bool {
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.docID > b.docID
+}
+
+func (h scoreDocHeap) Len() int           { return len(h) }
+func (h scoreDocHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h scoreDocHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *scoreDocHeap) Push(x interface{}) {
+	*h = append(*h, x.(*ScoreDoc))
+}
+
+func (h *scoreDocHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	doc := old[n-1]
+	*h = old[:n-1]
+	return doc
+}
@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+
+	"github.com/urfave/cli"
+)
+
+// インデクスを検査するコマンド
+var checkCommand = cli.Command{
+	Name:  "check",
+	Usage: "check the integrity of the index",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "fix",
+			Usage: "commit a new generation that repairs the problems found",
+		},
+	},
+	Action: check,
+}
+
+func check(c *cli.Context) (err error) {
+	if err := checkArgs(c, 0, exactArgs); err != nil {
+		return err
+	}
+	engine, err := openEngine(c)
+	if err != nil {
+		return err
+	}
+	defer closeEngine(engine, &err)
+	report, err := engine.Check(c.Bool("fix"))
+	if err != nil {
+		return err
+	}
+	for _, problem := range report.Problems {
+		fmt.Println(problem)
+	}
+	fmt.Printf("generation: %d, terms: %d, postings: %d, documents: %d (store: %d)\n",
+		report.Generation, report.Terms, report.Postings, report.DocCount, report.ExpectedDocCount)
+
+	switch {
+	case report.OK():
+		fmt.Println("ok")
+	case report.Fixed:
+		fmt.Printf("fixed %d problem(s)\n", len(report.Problems))
+	default:
+		return fmt.Errorf("%d problem(s) found; run with --fix to repair", len(report.Problems))
+	}
+	return nil
+}
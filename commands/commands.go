@@ -1,7 +1,6 @@
 package commands
 
 import (
-	"database/sql"
 	"fmt"
 	"log"
 	"os"
@@ -10,9 +9,50 @@ import (
 	"github.com/urfave/cli"
 )
 
-var engine *ssego.Engine
+// すべてのコマンドで使える、設定を上書きするフラグ
+var globalFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:   "config, c",
+		Usage:  "load options from a YAML or TOML `FILE`",
+		EnvVar: "SSEGO_CONFIG",
+	},
+	cli.StringFlag{
+		Name:  "index-dir",
+		Usage: "directory to store the index in",
+	},
+	cli.StringFlag{
+		Name:  "store",
+		Usage: "database/sql driver of the document store",
+	},
+	cli.StringFlag{
+		Name:  "dsn",
+		Usage: "data source name of the document store",
+	},
+	cli.StringFlag{
+		Name:  "analyzer",
+		Usage: "analyzer to split documents and queries into terms",
+	},
+	cli.StringFlag{
+		Name:  "scorer",
+		Usage: "default scoring function (TFIDF or BM25)",
+	},
+	cli.Int64Flag{
+		Name:  "postings-cache-bytes",
+		Usage: "maximum size of the postings cache in bytes",
+	},
+	cli.Int64Flag{
+		Name:  "ram-buffer-bytes",
+		Usage: "maximum size of the in-memory index in bytes",
+	},
+}
 
 func Main() {
+	if err := newApp().Run(os.Args); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newApp() *cli.App {
 	app := cli.NewApp()
 	app.Name = "ssego"
 	app.Usage = `simple and small search engine for learning`
@@ -20,18 +60,70 @@ func Main() {
 	app.Commands = []cli.Command{
 		createIndexCommand,
 		searchCommand,
+		checkCommand,
+		statsCommand,
+		termsCommand,
+		serveCommand,
+		shellCommand,
 	}
 
-	db, err := sql.Open("mysql", "root@tcp(127.0.0.1:3306)/ssego")
+	app.Flags = globalFlags
+	return app
+}
+
+// 設定を読み込んで検索エンジンを作成する
+// エンジンの作成はインデクスディレクトリにファイルを書き込み、データベースに接続するので、
+// ヘルプの表示などでは作成せず、エンジンを使うコマンドの中で作成する
+func openEngine(c *cli.Context) (*ssego.Engine, error) {
+	options, err := loadOptions(c)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	defer db.Close()
+	return ssego.NewSearchEngine(options)
+}
 
-	engine = ssego.NewSearchEngine(db)
-	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+// エンジンを閉じる。コマンドが成功していれば、Closeのエラーをコマンドのエラーとする
+func closeEngine(engine *ssego.Engine, err *error) {
+	if closeErr := engine.Close(); *err == nil {
+		*err = closeErr
+	}
+}
+
+// 設定をデフォルト値、設定ファイル、環境変数、フラグの順に上書きして読み込む
+func loadOptions(c *cli.Context) (ssego.Options, error) {
+	options := ssego.DefaultOptions()
+	if path := c.GlobalString("config"); path != "" {
+		var err error
+		if options, err = ssego.LoadOptions(path); err != nil {
+			return options, err
+		}
+	}
+	if err := options.LoadEnv(); err != nil {
+		return options, err
+	}
+
+	stringFlags := map[string]*string{
+		"index-dir": &options.IndexDir,
+		"store":     &options.Store.Backend,
+		"dsn":       &options.Store.DSN,
+		"analyzer":  &options.Analyzer,
+		"scorer":    &options.Scorer,
+	}
+	for name, field := range stringFlags {
+		if c.GlobalIsSet(name) {
+			*field = c.GlobalString(name)
+		}
+	}
+	int64Flags := map[string]*int64{
+		"postings-cache-bytes": &options.Cache.PostingsBytes,
+		"ram-buffer-bytes":     &options.Cache.RAMBufferBytes,
+	}
+	for name, field := range int64Flags {
+		if c.GlobalIsSet(name) {
+			*field = c.GlobalInt64(name)
+		}
 	}
+	return options, options.Validate()
 }
 
 const (
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"ssego"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+// argsのフラグでコマンドを実行したときの設定を返す
+func runLoadOptions(t *testing.T, args ...string) ssego.Options {
+	var loaded ssego.Options
+	app := cli.NewApp()
+	app.Flags = globalFlags
+	app.Commands = []cli.Command{{
+		Name: "test",
+		Action: func(c *cli.Context) error {
+			var err error
+			loaded, err = loadOptions(c)
+			return err
+		},
+	}}
+	if err := app.Run(append(append([]string{"ssego"}, args...), "test")); err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+func TestLoadOptionsPrecedence(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "ssego.yaml")
+	data := "index_dir: /file\nscorer: TFIDF\ncache:\n  ram_buffer_bytes: 1024\n  postings_bytes: 2048\n"
+	if err := ioutil.WriteFile(config, []byte(data), 0666); err != nil {
+		t.Fatal(err)
+	}
+	// 以前の環境変数INDEX_DIR_PATHもindex_dirを上書きするので消しておく。t.Setenvでテスト後に元に戻る
+	t.Setenv("INDEX_DIR_PATH", "")
+	os.Unsetenv("INDEX_DIR_PATH")
+	t.Setenv("SSEGO_INDEX_DIR", "/env")
+	t.Setenv("SSEGO_SCORER", "BM25")
+	t.Setenv("SSEGO_POSTINGS_CACHE_BYTES", "4096")
+
+	// フラグ > 環境変数 > 設定ファイル > デフォルト値の順に優先する
+	got := runLoadOptions(t, "--config", config, "--index-dir", "/flag", "--postings-cache-bytes", "8192")
+	expected := ssego.DefaultOptions()
+	expected.IndexDir = "/flag"
+	expected.Scorer = "BM25"
+	expected.Cache.RAMBufferBytes = 1024
+	expected.Cache.PostingsBytes = 8192
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%+v\nexpected:%+v\n", got, expected)
+	}
+
+	// フラグがなければ環境変数の値を使う
+	got = runLoadOptions(t, "--config", config)
+	if got.IndexDir != "/env" || got.Cache.PostingsBytes != 4096 || got.Cache.RAMBufferBytes != 1024 {
+		t.Fatalf("got:%+v\n", got)
+	}
+}
+
+func TestHelpWithoutEngine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	indexDir := filepath.Join(dir, "index")
+
+	// ヘルプの表示や引数の誤りでは、エンジンを作成せずインデクスディレクトリにも書き込まない
+	// 作成しようとすればデータベースに接続できずにエラーになる
+	app := newApp()
+	app.Writer = ioutil.Discard
+	defer func(printer func(io.Writer, string, interface{})) { cli.HelpPrinter = printer }(cli.HelpPrinter)
+	cli.HelpPrinter = func(io.Writer, string, interface{}) {}
+	args := [][]string{
+		{"help"},
+		{"search", "--help"},
+	}
+	for _, arg := range args {
+		if err := app.Run(append([]string{"ssego", "--index-dir", indexDir, "--dsn", "invalid"}, arg...)); err != nil {
+			t.Fatalf("%v: %v", arg, err)
+		}
+	}
+	if err := app.Run([]string{"ssego", "--index-dir", indexDir, "search"}); err == nil {
+		t.Fatal("search without a query: expected an error")
+	}
+	if _, err := os.Stat(indexDir); !os.IsNotExist(err) {
+		t.Fatalf("index dir is created: %v", err)
+	}
+}
@@ -1,9 +1,12 @@
 package commands
 
 import (
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"runtime"
+	"ssego"
 
 	"github.com/urfave/cli"
 )
@@ -12,23 +15,50 @@ var createIndexCommand = cli.Command{
 	Name:      "create",
 	Usage:     "create index",
 	ArgsUsage: `<path>`,
-	Action:    createIndex,
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "workers, w",
+			Usage: "number of goroutines tokenizing documents",
+			Value: runtime.NumCPU(),
+		},
+		cli.Int64Flag{
+			Name:  "ram-buffer",
+			Usage: "MB of memory used for the in-memory index before spilling segments to disk",
+			Value: 256,
+		},
+	},
+	Action: createIndex,
 }
 
-func createIndex(c *cli.Context) error {
+func createIndex(c *cli.Context) (err error) {
 	if err := checkArgs(c, 1, exactArgs); err != nil {
 		return err
 	}
+	engine, err := openEngine(c)
+	if err != nil {
+		return err
+	}
+	defer closeEngine(engine, &err)
 	dir := c.Args().Get(0)
 	files, err := fetchFiles(dir)
 	if err != nil {
 		return err
 	}
 
-	for _, file := range files {
-		if err := addFile(file); err != nil {
-			log.Printf("failed to add file to index: %s\n", file)
+	engine.SetRAMBufferSize(c.Int64("ram-buffer") << 20)
+	pipeline := ssego.NewIndexingPipeline(engine, c.Int("workers"))
+	pipeline.OnDocument = func(title string, err error) {
+		if err != nil {
+			log.Printf("failed to add file to index: %s: %v\n", title, err)
+			return
 		}
+		log.Printf("add document to index: %s\n", title)
+	}
+	for _, file := range files {
+		pipeline.Add(filepath.Base(file), openFile(file))
+	}
+	if err := pipeline.Close(); err != nil {
+		return err
 	}
 
 	return engine.Flush()
@@ -49,17 +79,9 @@ func fetchFiles(dir string) ([]string, error) {
 	return files, err
 }
 
-// ファイルの内容をインデクスに追加する
-func addFile(file string) error {
-	fp, err := os.Open(file)
-	if err != nil {
-		return err
-	}
-	defer fp.Close()
-	title := filepath.Base(file)
-	if err = engine.AddDocument(title, fp); err != nil {
-		return err
+// ワーカーがファイルを読み込むときに開く関数を返す
+func openFile(file string) func() (io.ReadCloser, error) {
+	return func() (io.ReadCloser, error) {
+		return os.Open(file)
 	}
-	log.Printf("add document to index: %s\n", title)
-	return nil
 }
@@ -2,6 +2,8 @@ package commands
 
 import (
 	"fmt"
+	"io"
+	"os"
 	"ssego"
 	"strings"
 
@@ -18,32 +20,89 @@ var searchCommand = cli.Command{
 			Name:  "number, n",
 			Value: 10,
 		},
+		cli.BoolFlag{
+			Name:  "explain",
+			Usage: "show how the score of each result was computed",
+		},
+		cli.StringFlag{
+			Name:  "filter",
+			Usage: "restrict results to documents matching `FILTER` (e.g. \"author:Shakespeare year:[1590 TO 1600]\") without changing scores",
+		},
+		cli.StringFlag{
+			Name:  "sort",
+			Usage: "sort results by comma-separated `KEYS` such as year:desc,_score; keys are numeric or date fields, _score, _doc or _title",
+		},
+		cli.StringFlag{
+			Name:  "or",
+			Usage: "match documents containing any query term, evaluated with `ALGORITHM` (Exhaustive, WAND, BlockMaxWAND or MaxScore)",
+		},
+		cli.StringSliceFlag{
+			Name:  "facet",
+			Usage: "count the values of a keyword, numeric or date `FIELD` over all matches (repeatable)",
+		},
 	},
 	Action: search,
 }
 
-func search(c *cli.Context) error {
+func search(c *cli.Context) (err error) {
 	if err := checkArgs(c, 1, exactArgs); err != nil {
 		return err
 	}
+	engine, err := openEngine(c)
+	if err != nil {
+		return err
+	}
+	defer closeEngine(engine, &err)
 	query := c.Args().Get(0)
-	result, err := engine.Search(query, c.Int("number"), "TFIDF")
+	sort, err := ssego.ParseSort(c.String("sort"))
 	if err != nil {
 		return err
 	}
-	printResult(result)
+	req := ssego.SearchRequest{
+		Query:  query,
+		K:      c.Int("number"),
+		Or:     c.String("or"),
+		Filter: c.String("filter"),
+		Sort:   sort,
+		Facets: c.StringSlice("facet"),
+	}
+	res, err := engine.SearchWith(req)
+	if err != nil {
+		return err
+	}
+	printResult(os.Stdout, res.Results)
+	printFacets(c.StringSlice("facet"), res.Facets)
+	if c.Bool("explain") {
+		for _, r := range res.Results {
+			explanation, err := engine.ExplainWith(req, r.DocID)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("\n%s (doc %d):\n%s", r.Title, r.DocID, explanation)
+		}
+	}
 	return nil
 }
 
 // 検索結果を表示する
-func printResult(results []*ssego.SearchResult) {
+func printResult(w io.Writer, results []*ssego.SearchResult) {
 	if len(results) == 0 {
-		fmt.Println("0 match!!")
+		fmt.Fprintln(w, "0 match!!")
 		return
 	}
 	s := make([]string, len(results))
 	for i, result := range results {
 		s[i] = fmt.Sprintf("rank: %3d, score: %4f, title: %s", i+1, result.Score, result.Title)
 	}
-	fmt.Println(strings.Join(s, "\n"))
+	fmt.Fprintln(w, strings.Join(s, "\n"))
+}
+
+// フィールドごとに値とドキュメント数を表示する
+func printFacets(fields []string, facets map[string][]ssego.FacetValue) {
+	for _, field := range fields {
+		fmt.Printf("\n%s:\n", field)
+		for _, value := range facets[field] {
+			fmt.Printf("  %s (%d)\n", value.Value, value.Count)
+		}
+	}
 }
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"ssego/grpcserver"
+	"ssego/server"
+	"ssego/ssegopb"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli"
+	"google.golang.org/grpc"
+)
+
+// HTTPのJSON APIとgRPCのサービスを提供するコマンド
+var serveCommand = cli.Command{
+	Name:  "serve",
+	Usage: "serve the search API over HTTP and gRPC",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "addr",
+			Usage: "address to listen on",
+			Value: ":8080",
+		},
+		cli.StringFlag{
+			Name:  "grpc-addr",
+			Usage: "address to serve gRPC on (disabled when empty)",
+		},
+		cli.BoolFlag{
+			Name:  "ui",
+			Usage: "serve a search page at /ui/",
+		},
+		cli.DurationFlag{
+			Name:  "timeout",
+			Usage: "maximum duration of a request",
+			Value: server.DefaultTimeout,
+		},
+		cli.DurationFlag{
+			Name:  "shutdown-timeout",
+			Usage: "maximum duration to wait for in-flight requests on shutdown",
+			Value: 30 * time.Second,
+		},
+	},
+	Action: serve,
+}
+
+func serve(c *cli.Context) (err error) {
+	if err := checkArgs(c, 0, exactArgs); err != nil {
+		return err
+	}
+	engine, err := openEngine(c)
+	if err != nil {
+		return err
+	}
+	defer closeEngine(engine, &err)
+	timeout := c.Duration("timeout")
+	srv := &http.Server{
+		Addr:              c.String("addr"),
+		Handler:           server.New(engine, timeout, c.Bool("ui")),
+		ReadHeaderTimeout: timeout,
+		// ハンドラのタイムアウトのレスポンスを書き込めるように、少し長くする
+		ReadTimeout:  timeout + time.Second,
+		WriteTimeout: timeout + time.Second,
+	}
+
+	errs := make(chan error, 2)
+	go func() {
+		log.Printf("listening on %s\n", srv.Addr)
+		if c.Bool("ui") {
+			log.Println("serving the search page at /ui/")
+		}
+		errs <- srv.ListenAndServe()
+	}()
+
+	var grpcServer *grpc.Server
+	if addr := c.String("grpc-addr"); addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			srv.Close()
+			return err
+		}
+		grpcServer = grpc.NewServer()
+		ssegopb.RegisterSearchEngineServer(grpcServer, grpcserver.New(engine))
+		go func() {
+			log.Printf("serving gRPC on %s\n", addr)
+			errs <- grpcServer.Serve(listener)
+		}()
+	}
+
+	// シグナルを受け取ったら、処理中のリクエストを待ってから終了する
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		log.Printf("received %v, shutting down\n", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Duration("shutdown-timeout"))
+	defer cancel()
+	if grpcServer != nil {
+		// 処理中のRPCが終わらなければ、シャットダウンの期限で打ち切る
+		stopped := make(chan struct{})
+		go func() {
+			grpcServer.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			grpcServer.Stop()
+		}
+	}
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	// 追加・削除したドキュメントはWALにも残っているが、次回の起動で再生しなくて済むようにする
+	return engine.Flush()
+}
@@ -0,0 +1,253 @@
+package commands
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"ssego"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// エンジンを開いたまま、対話的に検索するコマンド
+var shellCommand = cli.Command{
+	Name:  "shell",
+	Usage: "search interactively with a warm index",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "number, n",
+			Value: 10,
+		},
+		cli.StringFlag{
+			Name:  "score",
+			Usage: "scoring function (TFIDF or BM25; defaults to the configured scorer)",
+		},
+		cli.StringFlag{
+			Name:  "history",
+			Usage: "file to save the history to (disabled when empty)",
+			Value: defaultHistoryFile(),
+		},
+	},
+	Action: shell,
+}
+
+const shellHelp = `enter a query to search, or one of the commands:
+  :k <n>          number of results to show
+  :score <name>   scoring function (TFIDF or BM25)
+  :explain <rank> explain the score of a result of the last search
+  :history        show the history
+  !<n>            run the n-th entry of the history again
+  :help           show this help
+  :quit           exit the shell
+`
+
+// ホームディレクトリがなければ履歴を保存しない
+func defaultHistoryFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssego_history")
+}
+
+// シェルが使う検索エンジンの操作
+type shellEngine interface {
+	Search(query string, k int, score string) ([]*ssego.SearchResult, error)
+	Explain(query string, docID ssego.DocumentID, score string) (*ssego.Explanation, error)
+}
+
+// シェルの状態
+type shellSession struct {
+	engine      shellEngine
+	out         io.Writer
+	k           int
+	score       string
+	history     []string
+	historyFile string
+	// 直前の検索のクエリと結果。:explainで使う
+	lastQuery   string
+	lastResults []*ssego.SearchResult
+}
+
+func shell(c *cli.Context) (err error) {
+	if err := checkArgs(c, 0, exactArgs); err != nil {
+		return err
+	}
+	options, err := loadOptions(c)
+	if err != nil {
+		return err
+	}
+	engine, err := ssego.NewSearchEngine(options)
+	if err != nil {
+		return err
+	}
+	defer closeEngine(engine, &err)
+	s := &shellSession{engine: engine, out: os.Stdout, k: c.Int("number"), historyFile: c.String("history")}
+	score := c.String("score")
+	if score == "" {
+		score = options.Scorer
+	}
+	if err := s.setScore(score); err != nil {
+		return err
+	}
+	if err := s.loadHistory(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(s.out, "ssego shell (score: %s, k: %d). type :help for commands\n", s.score, s.k)
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Fprint(s.out, "ssego> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(s.out)
+			return scanner.Err()
+		}
+		quit, err := s.run(strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			fmt.Fprintf(s.out, "error: %v\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// 1行を実行する。シェルを終了する場合はtrueを返す
+func (s *shellSession) run(line string) (bool, error) {
+	if line == "" {
+		return false, nil
+	}
+	if strings.HasPrefix(line, "!") {
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 1 || n > len(s.history) {
+			return false, fmt.Errorf("no history entry %q", line[1:])
+		}
+		line = s.history[n-1]
+		fmt.Fprintln(s.out, line)
+	}
+	if err := s.addHistory(line); err != nil {
+		return false, err
+	}
+
+	if !strings.HasPrefix(line, ":") {
+		return false, s.search(line)
+	}
+	fields := strings.Fields(line)
+	command, args := fields[0], fields[1:]
+	switch command {
+	case ":quit", ":q", ":exit":
+		return true, nil
+	case ":help":
+		fmt.Fprint(s.out, shellHelp)
+	case ":history":
+		for i, entry := range s.history {
+			fmt.Fprintf(s.out, "%4d  %s\n", i+1, entry)
+		}
+	case ":k":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: :k <n>")
+		}
+		k, err := strconv.Atoi(args[0])
+		if err != nil || k < 1 {
+			return false, fmt.Errorf("k must be a positive integer")
+		}
+		s.k = k
+	case ":score":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: :score <TFIDF|BM25>")
+		}
+		return false, s.setScore(args[0])
+	case ":explain":
+		if len(args) != 1 {
+			return false, fmt.Errorf("usage: :explain <rank>")
+		}
+		return false, s.explain(args[0])
+	default:
+		return false, fmt.Errorf("unknown command %s; type :help for commands", command)
+	}
+	return false, nil
+}
+
+func (s *shellSession) setScore(score string) error {
+	switch strings.ToUpper(score) {
+	case "TFIDF", "BM25":
+		s.score = strings.ToUpper(score)
+	default:
+		return fmt.Errorf("unknown score %q; use TFIDF or BM25", score)
+	}
+	return nil
+}
+
+func (s *shellSession) search(query string) error {
+	start := time.Now()
+	results, err := s.engine.Search(query, s.k, s.score)
+	if err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	s.lastQuery, s.lastResults = query, results
+	printResult(s.out, results)
+	fmt.Fprintf(s.out, "%d results in %v (score: %s)\n", len(results), elapsed.Round(time.Microsecond), s.score)
+	return nil
+}
+
+func (s *shellSession) explain(arg string) error {
+	rank, err := strconv.Atoi(arg)
+	if err != nil || rank < 1 || rank > len(s.lastResults) {
+		return fmt.Errorf("rank must be between 1 and %d", len(s.lastResults))
+	}
+	result := s.lastResults[rank-1]
+	explanation, err := s.engine.Explain(s.lastQuery, result.DocID, s.score)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(s.out, "%s (doc %d):\n%s", result.Title, result.DocID, explanation)
+	return nil
+}
+
+// 履歴ファイルを読み込む
+func (s *shellSession) loadHistory() error {
+	if s.historyFile == "" {
+		return nil
+	}
+	f, err := os.Open(s.historyFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			s.history = append(s.history, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// 履歴に追加し、履歴ファイルに追記する。直前と同じ行は追加しない
+func (s *shellSession) addHistory(line string) error {
+	if len(s.history) > 0 && s.history[len(s.history)-1] == line {
+		return nil
+	}
+	s.history = append(s.history, line)
+	if s.historyFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(s.historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"bytes"
+	"regexp"
+	"ssego"
+	"testing"
+)
+
+type fakeEngine struct{}
+
+func (fakeEngine) Search(query string, k int, score string) ([]*ssego.SearchResult, error) {
+	results := []*ssego.SearchResult{
+		{DocID: 1, Score: 1, Title: "test1"},
+		{DocID: 2, Score: 0.5, Title: "test2"},
+		{DocID: 3, Score: 0.25, Title: "test3"},
+	}
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+func (fakeEngine) Explain(query string, docID ssego.DocumentID, score string) (*ssego.Explanation, error) {
+	return &ssego.Explanation{Value: 1 / float64(docID), Description: score + " " + query}, nil
+}
+
+// 検索にかかった時間は実行ごとに変わるので置き換える
+var elapsedPattern = regexp.MustCompile(`results in \S+ `)
+
+func TestShellRun(t *testing.T) {
+	var out bytes.Buffer
+	s := &shellSession{engine: fakeEngine{}, out: &out, k: 10, score: "TFIDF"}
+
+	type testCase struct {
+		line string
+		want string
+		err  string
+		quit bool
+	}
+	// 1つのセッションで順に実行する
+	testCases := []testCase{
+		{line: ":k 2"},
+		{line: ":k 0", err: "k must be a positive integer"},
+		{line: ":score bm25"},
+		{line: ":score okapi", err: `unknown score "okapi"; use TFIDF or BM25`},
+		{line: "quarrel", want: "rank:   1, score: 1.000000, title: test1\nrank:   2, score: 0.500000, title: test2\n2 results in <elapsed> (score: BM25)\n"},
+		{line: ":explain 2", want: "test2 (doc 2):\n0.5 = BM25 quarrel\n"},
+		{line: ":explain 3", err: "rank must be between 1 and 2"},
+		{line: "!5", want: "quarrel\nrank:   1, score: 1.000000, title: test1\nrank:   2, score: 0.500000, title: test2\n2 results in <elapsed> (score: BM25)\n"},
+		{line: "!99", err: `no history entry "99"`},
+		{line: ":k", err: "usage: :k <n>"},
+		{line: ":unknown", err: "unknown command :unknown; type :help for commands"},
+		{line: ":quit", quit: true},
+	}
+	for _, testCase := range testCases {
+		out.Reset()
+		quit, err := s.run(testCase.line)
+		got := elapsedPattern.ReplaceAllString(out.String(), "results in <elapsed> ")
+		errMessage := ""
+		if err != nil {
+			errMessage = err.Error()
+		}
+		if errMessage != testCase.err {
+			t.Fatalf("%s: got error: %v\nwant: %s\n", testCase.line, err, testCase.err)
+		}
+		if got != testCase.want || quit != testCase.quit {
+			t.Fatalf("%s: got: %q (quit: %v)\nwant: %q (quit: %v)\n", testCase.line, got, quit, testCase.want, testCase.quit)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+// インデクスの統計情報を表示するコマンド
+var statsCommand = cli.Command{
+	Name:  "stats",
+	Usage: "show index statistics",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "top, t",
+			Usage: "number of terms with the highest document frequency to show",
+			Value: 10,
+		},
+	},
+	Action: stats,
+}
+
+func stats(c *cli.Context) (err error) {
+	if err := checkArgs(c, 0, exactArgs); err != nil {
+		return err
+	}
+	engine, err := openEngine(c)
+	if err != nil {
+		return err
+	}
+	defer closeEngine(engine, &err)
+	stats, err := engine.Stats(c.Int("top"))
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "generation:\t%d\n", stats.Generation)
+	fmt.Fprintf(w, "documents:\t%d\n", stats.DocCount)
+	fmt.Fprintf(w, "pending documents:\t%d\n", stats.PendingDocs)
+	fmt.Fprintf(w, "vocabulary size:\t%d\n", stats.VocabularySize)
+	fmt.Fprintf(w, "postings:\t%d\n", stats.PostingsCount)
+	fmt.Fprintf(w, "postings size on disk:\t%d bytes\n", stats.PostingsBytes)
+	fmt.Fprintf(w, "average document length:\t%.2f terms\n", stats.AvgDocLength)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if len(stats.TopTerms) == 0 {
+		return nil
+	}
+	fmt.Println()
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "rank\tterm\tdf\ttf\t")
+	for i, term := range stats.TopTerms {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t\n", i+1, term.Term, term.DocFreq, term.TotalTermFreq)
+	}
+	return w.Flush()
+}
+
+// 用語のポスティングリストを表示するコマンド
+var termsCommand = cli.Command{
+	Name:      "terms",
+	Usage:     "dump the postings of a term",
+	ArgsUsage: `<term>`,
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Usage: "output format (json or table)",
+			Value: "table",
+		},
+	},
+	Action: terms,
+}
+
+func terms(c *cli.Context) (err error) {
+	if err := checkArgs(c, 1, exactArgs); err != nil {
+		return err
+	}
+	engine, err := openEngine(c)
+	if err != nil {
+		return err
+	}
+	defer closeEngine(engine, &err)
+	term := c.Args().Get(0)
+	postings, err := engine.TermPostings(term)
+	if err != nil {
+		return err
+	}
+	if postings == nil {
+		return fmt.Errorf("term %q is not in the index", term)
+	}
+
+	switch c.String("format") {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(postings)
+	case "table":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "docID\ttf\tpositions")
+		for cursor := postings.OpenCursor(); !cursor.Empty(); cursor.Next() {
+			fmt.Fprintf(w, "%d\t%d\t%v\n", cursor.DocID(), cursor.TermFrequency(), cursor.Positions())
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown format %q", c.String("format"))
+	}
+}
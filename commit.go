@@ -0,0 +1,186 @@
+package ssego
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// インデクスディレクトリの構成
+//
+//	_commit     コミットポイント。最後に書き込みが完了した世代を指す
+//	_schema     インデクスのスキーマ
+//	_gen_N/     N世代目のインデクス(用語ごとのポスティングリスト, _0.dc, _docs, _terms, _stored)
+//	_segments/  Indexerがメモリの上限を超えたときに書き出すセグメント
+//	_wal        まだコミットされていないドキュメントの追加・削除のログ
+//
+// Flushは新しい世代のディレクトリにすべてのファイルを書き込んでから_commitを置き換えるので、
+// 途中でクラッシュしても読み取り側からは直前にコミットされた世代だけが見える
+const (
+	commitFileName   = "_commit"
+	generationPrefix = "_gen_"
+	tmpSuffix        = ".tmp"
+)
+
+// コミットポイント
+type commitPoint struct {
+	Generation int        // コミットされた世代。0のときはまだ一度もコミットされていない
+	DocCount   int        // その世代に含まれるドキュメント数
+	WALSeq     int64      // その世代に反映済みのWALレコードの最後の連番
+	NextDocID  DocumentID // 次に発行するドキュメントID。0のときはまだ記録されていない
+}
+
+// N世代目のインデクスを保存するディレクトリのパス
+func generationDir(indexDir string, generation int) string {
+	return filepath.Join(indexDir, generationPrefix+strconv.Itoa(generation))
+}
+
+// 最後にコミットされた世代を読み込む
+// まだ一度もコミットされていない場合は0世代目を返す
+func readCommit(indexDir string) (commitPoint, error) {
+	var commit commitPoint
+	bytes, err := ioutil.ReadFile(filepath.Join(indexDir, commitFileName))
+	if os.IsNotExist(err) {
+		return commit, nil
+	}
+	if err != nil {
+		return commit, err
+	}
+	if err := json.Unmarshal(bytes, &commit); err != nil {
+		return commit, fmt.Errorf("invalid commit point: %v", err)
+	}
+	return commit, nil
+}
+
+// 検索で読み込むディレクトリを返す
+// コミットポイントがないディレクトリは、世代を持たない以前の形式のインデクスとしてそのまま読み込む
+func committedDir(indexDir string) string {
+	commit, err := readCommit(indexDir)
+	if err != nil || commit.Generation == 0 {
+		return indexDir
+	}
+	return generationDir(indexDir, commit.Generation)
+}
+
+// コミットポイントを一時ファイルに書き込んでからリネームして置き換える
+func writeCommit(indexDir string, commit commitPoint) error {
+	bytes, err := json.Marshal(commit)
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(indexDir, commitFileName)
+	if err := writeFileSync(filename+tmpSuffix, bytes); err != nil {
+		return err
+	}
+	if err := os.Rename(filename+tmpSuffix, filename); err != nil {
+		return err
+	}
+	return syncDir(indexDir)
+}
+
+// ファイルに書き込み、ディスクに同期する
+func writeFileSync(filename string, data []byte) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ディレクトリ内のファイルの作成やリネームをディスクに同期する
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// コミットされていない世代(書き込み途中でクラッシュしたものなど)と、keepより古い世代を削除する
+// 直前の世代は検索中のIndexReaderが参照している可能性があるので、keep以降は残す
+func removeGenerations(indexDir string, committed, keep int) error {
+	files, err := ioutil.ReadDir(indexDir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, generationPrefix) {
+			continue
+		}
+		generation, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, generationPrefix), tmpSuffix))
+		if err != nil {
+			continue
+		}
+		if strings.HasSuffix(name, tmpSuffix) || generation > committed || generation < keep {
+			if err := os.RemoveAll(filepath.Join(indexDir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ファイル名が用語のポスティングリストのファイルかどうか
+// 用語は英数字のみからなるので、_で始まるファイルや拡張子を持つファイルはメタデータとなる
+func isTermFile(name string) bool {
+	return !strings.HasPrefix(name, "_") && !strings.Contains(name, ".")
+}
+
+// 用語のポスティングリストを保存するファイル名
+// フィールドを指定した用語の値には任意の文字が含まれるので、値を16進数に変換して「フィールド名=値」とする
+func termFileName(term string) string {
+	if i := strings.IndexByte(term, ':'); i >= 0 {
+		return term[:i] + "=" + hex.EncodeToString([]byte(term[i+1:]))
+	}
+	return term
+}
+
+// termFileNameで変換したファイル名から用語を求める
+func termFromFileName(name string) (string, error) {
+	i := strings.IndexByte(name, '=')
+	if i < 0 {
+		return name, nil
+	}
+	value, err := hex.DecodeString(name[i+1:])
+	if err != nil {
+		return "", fmt.Errorf("invalid term file name %s: %v", name, err)
+	}
+	return fieldTerm(name[:i], string(value)), nil
+}
+
+// ディレクトリ内のポスティングリストのファイルの用語を昇順に返す
+func termFiles(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var terms []string
+	for _, file := range files {
+		if !isTermFile(file.Name()) {
+			continue
+		}
+		term, err := termFromFileName(file.Name())
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms, nil
+}
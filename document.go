@@ -0,0 +1,155 @@
+package ssego
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 保存したフィールドの値を記録するファイル名
+const storedFileName = "_stored"
+
+// ドキュメントのタイトルを記録するファイル名
+const titlesFileName = "_titles"
+
+// ドキュメントのフィールドがスキーマに合わない
+var ErrInvalidDocument = errors.New("invalid document")
+
+// インデクスに追加するドキュメント
+type Document struct {
+	Title  string
+	Body   io.Reader         // DefaultFieldに索引する本文
+	Fields map[string]string // スキーマで定義したフィールドの値。フィールドの名前をキーとする
+}
+
+// 索引するために分割したドキュメント
+type analyzedDocument struct {
+	terms     []string          // 本文の用語に続けて、フィールドを指定した用語を並べたもの
+	termCount int               // 本文の用語数。BM25の文書長に使う
+	body      string            // 本文。検索結果の抜粋に使う
+	stored    map[string]string // 保存するフィールドとdoc valuesを持つフィールドの値
+}
+
+// スキーマに従ってドキュメントを検証し、用語に分割する
+func (e *Engine) analyze(doc Document) (*analyzedDocument, error) {
+	// 本文はDocumentStoreに保存するので、分割しながら読み込んだ内容を残す
+	var body strings.Builder
+	terms, err := e.tokenizer.ReaderToWordSequence(io.TeeReader(doc.Body, &body))
+	if err != nil {
+		return nil, err
+	}
+	analyzed := &analyzedDocument{terms: terms, termCount: len(terms), body: body.String()}
+
+	// 用語の並びが毎回同じになるように、フィールドの名前の順に処理する
+	names := make([]string, 0, len(doc.Fields))
+	for name := range doc.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field, ok := e.schema.Field(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: field %s is not defined in the schema", ErrInvalidDocument, name)
+		}
+		if name == DefaultField {
+			return nil, fmt.Errorf("%w: field %s is read from the document body", ErrInvalidDocument, name)
+		}
+		value, err := field.normalize(doc.Fields[name])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+		}
+		if field.Indexed {
+			if field.Type == FieldText {
+				for _, term := range e.tokenizer.TextToWordSequence(value) {
+					analyzed.terms = append(analyzed.terms, fieldTerm(name, term))
+				}
+			} else {
+				analyzed.terms = append(analyzed.terms, fieldTerm(name, value))
+			}
+			if field.isRange() {
+				key, err := field.rangeKey(value)
+				if err != nil {
+					return nil, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+				}
+				analyzed.terms = append(analyzed.terms, trieTerms(name, key)...)
+			}
+		}
+		if field.Stored || field.hasDocValues() {
+			if analyzed.stored == nil {
+				analyzed.stored = make(map[string]string)
+			}
+			analyzed.stored[name] = value
+		}
+	}
+	return analyzed, nil
+}
+
+// ドキュメントIDごとの保存したフィールドの値
+// 検索結果で返すstoredのフィールドの値に加えて、ソートや集計に使うdoc valuesも保存する
+type storedFields map[DocumentID]map[string]string
+
+// 世代のディレクトリに保存したフィールドの値を読み込む
+func readStoredFields(dir string) (storedFields, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, storedFileName))
+	if os.IsNotExist(err) {
+		return storedFields{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var stored storedFields
+	if err := json.Unmarshal(bytes, &stored); err != nil {
+		return nil, fmt.Errorf("invalid stored fields: %v", err)
+	}
+	return stored, nil
+}
+
+// 保存するフィールドの値がなければファイルを作成しない
+func writeStoredFields(dir string, stored storedFields) error {
+	if len(stored) == 0 {
+		return nil
+	}
+	bytes, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(filepath.Join(dir, storedFileName), bytes)
+}
+
+// ドキュメントIDごとのタイトル
+// タイトルで並べるときに、DocumentStoreから1件ずつ読み込まずに済むように世代ごとに記録する
+type documentTitles map[DocumentID]string
+
+// 世代のディレクトリに記録したタイトルを読み込む。_titlesのない以前の世代ではnilを返す
+func readTitles(dir string) (documentTitles, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, titlesFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	titles := documentTitles{}
+	if err := json.Unmarshal(bytes, &titles); err != nil {
+		return nil, fmt.Errorf("invalid titles: %v", err)
+	}
+	return titles, nil
+}
+
+// タイトルがなければファイルを作成しない
+func writeTitles(dir string, titles documentTitles) error {
+	if len(titles) == 0 {
+		return nil
+	}
+	bytes, err := json.Marshal(titles)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(filepath.Join(dir, titlesFileName), bytes)
+}
@@ -2,9 +2,28 @@ package ssego
 
 import (
 	"database/sql"
-	"log"
+	"errors"
+	"strings"
 )
 
+// 指定されたドキュメントIDのドキュメントが保存されていない
+var ErrDocumentNotFound = errors.New("document not found")
+
+// Engineがドキュメントを保存する先。DocumentStoreが実装する
+// テストではデータベースを使わない実装に置き換える
+type documentStorage interface {
+	save(docID DocumentID, title, body string, termCount int) error
+	saveBatch(docs []documentRecord) error
+	deleteBatch(docIDs []DocumentID) error
+	maxDocID() (DocumentID, error)
+	fetchTermCounts() (map[DocumentID]int, error)
+	delete(docID DocumentID) error
+	fetchTitle(docID DocumentID) (string, error)
+	fetchTitles() (documentTitles, error)
+	fetchBody(docID DocumentID) (string, error)
+	fetchTermCount(docID DocumentID) (int, error)
+}
+
 type DocumentStore struct {
 	db *sql.DB
 }
@@ -13,14 +32,94 @@ func NewDocumentStore(db *sql.DB) *DocumentStore {
 	return &DocumentStore{db: db}
 }
 
-func (ds *DocumentStore) save(title string, termCount int) (DocumentID, error) {
-	query := "INSERT INTO documents (document_title, document_terms) VALUES (?, ?)"
-	result, err := ds.db.Exec(query, title, termCount)
+// インデクスが発行したドキュメントIDでドキュメントを保存する
+// 本文は検索結果の抜粋を作るために保存する
+func (ds *DocumentStore) save(docID DocumentID, title, body string, termCount int) error {
+	query := "INSERT INTO documents (document_id, document_title, document_body, document_terms) VALUES (?, ?, ?, ?)"
+	_, err := ds.db.Exec(query, docID, title, body, termCount)
+	return err
+}
+
+// 保存するドキュメント
+type documentRecord struct {
+	docID     DocumentID
+	title     string
+	body      string
+	termCount int
+}
+
+// 複数のドキュメントを1回のINSERTでまとめて保存する
+func (ds *DocumentStore) saveBatch(docs []documentRecord) error {
+	if len(docs) == 0 {
+		return nil
+	}
+	values := make([]string, len(docs))
+	args := make([]interface{}, 0, 4*len(docs))
+	for i, doc := range docs {
+		values[i] = "(?, ?, ?, ?)"
+		args = append(args, doc.docID, doc.title, doc.body, doc.termCount)
+	}
+	query := "INSERT INTO documents (document_id, document_title, document_body, document_terms) VALUES " + strings.Join(values, ", ")
+	_, err := ds.db.Exec(query, args...)
+	return err
+}
+
+// 複数のドキュメントを1回のDELETEでまとめて削除する。保存されていないドキュメントは無視する
+func (ds *DocumentStore) deleteBatch(docIDs []DocumentID) error {
+	if len(docIDs) == 0 {
+		return nil
+	}
+	values := make([]string, len(docIDs))
+	args := make([]interface{}, len(docIDs))
+	for i, docID := range docIDs {
+		values[i] = "?"
+		args[i] = docID
+	}
+	query := "DELETE FROM documents WHERE document_id IN (" + strings.Join(values, ", ") + ")"
+	_, err := ds.db.Exec(query, args...)
+	return err
+}
+
+// 保存されているドキュメントIDの最大値。ドキュメントがなければ0を返す
+func (ds *DocumentStore) maxDocID() (DocumentID, error) {
+	query := "SELECT COALESCE(MAX(document_id), 0) FROM documents"
+	var docID DocumentID
+	err := ds.db.QueryRow(query).Scan(&docID)
+	return docID, err
+}
+
+// 保存されているすべてのドキュメントの用語数をドキュメントIDごとに返す
+func (ds *DocumentStore) fetchTermCounts() (map[DocumentID]int, error) {
+	rows, err := ds.db.Query("SELECT document_id, document_terms FROM documents")
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	id, err := result.LastInsertId()
-	return DocumentID(id), err
+	defer rows.Close()
+
+	termCounts := make(map[DocumentID]int)
+	for rows.Next() {
+		var docID DocumentID
+		var termCount int
+		if err := rows.Scan(&docID, &termCount); err != nil {
+			return nil, err
+		}
+		termCounts[docID] = termCount
+	}
+	return termCounts, rows.Err()
+}
+
+func (ds *DocumentStore) delete(docID DocumentID) error {
+	query := "DELETE FROM documents WHERE document_id = ?"
+	result, err := ds.db.Exec(query, docID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDocumentNotFound
+	}
+	return nil
 }
 
 func (ds *DocumentStore) fetchTitle(docID DocumentID) (string, error) {
@@ -28,9 +127,43 @@ func (ds *DocumentStore) fetchTitle(docID DocumentID) (string, error) {
 	row := ds.db.QueryRow(query, docID)
 	var title string
 	err := row.Scan(&title)
+	if err == sql.ErrNoRows {
+		err = ErrDocumentNotFound
+	}
 	return title, err
 }
 
+// 保存されているすべてのドキュメントのタイトルをドキュメントIDごとに返す
+func (ds *DocumentStore) fetchTitles() (documentTitles, error) {
+	rows, err := ds.db.Query("SELECT document_id, document_title FROM documents")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := make(documentTitles)
+	for rows.Next() {
+		var docID DocumentID
+		var title string
+		if err := rows.Scan(&docID, &title); err != nil {
+			return nil, err
+		}
+		titles[docID] = title
+	}
+	return titles, rows.Err()
+}
+
+func (ds *DocumentStore) fetchBody(docID DocumentID) (string, error) {
+	query := "SELECT document_body FROM documents WHERE document_id = ?"
+	row := ds.db.QueryRow(query, docID)
+	var body string
+	err := row.Scan(&body)
+	if err == sql.ErrNoRows {
+		err = ErrDocumentNotFound
+	}
+	return body, err
+}
+
 func (ds *DocumentStore) fetchTermCount(docID DocumentID) (int, error) {
 	query := "SELECT document_terms FROM documents WHERE document_id = ?"
 	row := ds.db.QueryRow(query, docID)
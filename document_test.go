@@ -0,0 +1,116 @@
+package ssego
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	e := &Engine{tokenizer: NewTokenizer(), schema: testSchema()}
+	got, err := e.analyze(Document{
+		Title: "test1",
+		Body:  strings.NewReader("Do you quarrel, sir?"),
+		Fields: map[string]string{
+			"title":    "Romeo and Juliet",
+			"author":   "William Shakespeare",
+			"year":     "1597",
+			"modified": "2026-01-02",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	year, _ := e.schema.Field("year")
+	key, err := year.rangeKey("1597")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &analyzedDocument{
+		terms: append([]string{
+			"do", "you", "quarrel", "sir",
+			"author:William Shakespeare",
+			"title:romeo", "title:and", "title:juliet",
+			"year:1597",
+		}, trieTerms("year", key)...),
+		termCount: 4,
+		body:      "Do you quarrel, sir?",
+		stored: map[string]string{
+			"author":   "William Shakespeare",
+			"year":     "1597",
+			"modified": "2026-01-02T00:00:00Z",
+		},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%+v\nexpected:%+v\n", got, expected)
+	}
+
+	invalid := []map[string]string{
+		{"publisher": "Penguin"},
+		{"body": "No better."},
+		{"year": "MDXCVII"},
+	}
+	for _, fields := range invalid {
+		if _, err := e.analyze(Document{Body: strings.NewReader(""), Fields: fields}); err == nil {
+			t.Fatalf("%v: expected an error", fields)
+		}
+	}
+}
+
+func TestStoredFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	indexer := NewIndexer(NewTokenizer())
+	indexer.update(1, strings.NewReader("Do you quarrel, sir?"))
+	indexer.store(1, map[string]string{"author": "Shakespeare"})
+	indexer.update(2, strings.NewReader("No better."))
+	indexer.store(2, map[string]string{"author": "Marlowe"})
+	writer := NewIndexWriter(dir)
+	if err := writer.flush(flushRequest{index: indexer.index, stored: indexer.stored}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 前の世代の値を引き継ぎ、削除したドキュメントの値は取り除く
+	indexer = NewIndexer(NewTokenizer())
+	indexer.update(3, strings.NewReader("Quarrel sir! no, sir!"))
+	indexer.store(3, map[string]string{"author": "Jonson"})
+	indexer.delete(2)
+	if err := writer.flush(flushRequest{index: indexer.index, stored: indexer.stored, deleted: indexer.deleted}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readStoredFields(generationDir(dir, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := storedFields{1: {"author": "Shakespeare"}, 3: {"author": "Jonson"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+
+	// Flushされていないドキュメントの値はメモリ上から返す
+	indexer = NewIndexer(NewTokenizer())
+	indexer.update(4, strings.NewReader("Well, sir"))
+	indexer.store(4, map[string]string{"author": "Kyd"})
+	reader := newNRTReader(NewIndexReader(dir), nil, indexer)
+	indexer.store(5, map[string]string{"author": "Nashe"})
+	for docID, want := range map[DocumentID]map[string]string{1: {"author": "Shakespeare"}, 2: nil, 4: {"author": "Kyd"}, 5: nil} {
+		if got := reader.storedFields(docID); !reflect.DeepEqual(got, want) {
+			t.Fatalf("%d: got:%v\nexpected:%v\n", docID, got, want)
+		}
+	}
+
+	// 値がなければファイルを作成しない
+	if err := writeStoredFields(dir, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, storedFileName)); !os.IsNotExist(err) {
+		t.Fatalf("got: %v", err)
+	}
+}
@@ -3,9 +3,13 @@ package ssego
 import (
 	"bufio"
 	"database/sql"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
 // 検索エンジンとは？
@@ -13,44 +17,264 @@ import (
 //   - インデクサ = ドキュメントからポスティングリストを作成する
 //   - ドキュメント管理機 = MySQLのdocumentテーブルモデル
 //   - インデクスの保存先ディレクトリパス
+//
+// Engineは複数のgoroutineから同時に使用できる
 type Engine struct {
-	tokenizer     *Tokenizer     // トークンの分割方法を決めるトークナイザ
-	indexer       *Indexer       // インデクス生成器
-	documentStore *DocumentStore // ドキュメント管理機
-	indexDir      string         // インデクスファイルを保存するディレクトリ
+	tokenizer     *Tokenizer      // トークンの分割方法を決めるトークナイザ
+	indexer       *Indexer        // インデクス生成器
+	documentStore documentStorage // ドキュメント管理機
+	indexDir      string          // インデクスファイルを保存するディレクトリ
+	indexReader   *IndexReader    // 検索で共有するインデクス読み取り器
+	schema        *Schema         // インデクスのスキーマ
+	db            *sql.DB         // ドキュメントを保存するデータベース
+	scorer        string          // スコアの計算方法が指定されなかったときに使う計算方法
+	cacheBytes    int64           // ポスティングリストのキャッシュの上限(バイト)
+	titleCache    *lruCache       // タイトルで並べるときにDocumentStoreから読み込んだタイトル
+	wal           *writeAheadLog  // Flushされていない追加・削除のログ
+	addMu         sync.Mutex      // AddDocumentを直列化し、ドキュメントIDの順にインデクスに追加する
+	mu            sync.RWMutex    // 以下のフィールドを保護する
+
+	nextDocID DocumentID // 次に発行するドキュメントID
+	pipelines int        // Closeされていないパイプラインの数。0でなければFlushできない
+
+	nrt             *nrtReader               // Flushされていないドキュメントも含めて検索するスナップショット
+	refreshedAt     time.Time                // nrtを作成した時刻
+	refreshInterval time.Duration            // nrtを作り直す間隔
+	segmentTerms    map[string]*segmentTerms // 検索のために読み込んだセグメントの用語の位置
 }
 
-func NewSearchEngine(db *sql.DB) *Engine {
-	tokenizer := NewTokenizer()
-	indexer := NewIndexer(tokenizer)
-	documentStore := NewDocumentStore(db)
+// メモリ上のインデクスの大きさの上限のデフォルト値(バイト)
+// 上限を超えるとインデクスディレクトリの_segmentsにセグメントを書き出し、Flushでマージする
+const defaultRAMBufferBytes = 256 << 20
+
+// 追加したドキュメントが検索できるようになるまでの間隔のデフォルト値
+const defaultRefreshInterval = time.Second
 
-	path, ok := os.LookupEnv("INDEX_DIR_PATH")
-	if !ok {
-		current, _ := os.Getwd()
-		path = filepath.Join(current, "_index_data")
+// optionsの設定で検索エンジンを作成する
+// 前回Flushされずに終了したドキュメントの追加・削除はWALから復元する
+// 使い終わったらCloseでWALとデータベースへの接続を閉じる
+func NewSearchEngine(options Options) (*Engine, error) {
+	if err := options.Validate(); err != nil {
+		return nil, err
 	}
 
-	return &Engine{
+	db, err := sql.Open(options.Store.Backend, options.Store.DSN)
+	if err != nil {
+		return nil, err
+	}
+	e, err := newEngine(options, NewDocumentStore(db))
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	e.db = db
+	return e, nil
+}
+
+// storeにドキュメントを保存する検索エンジンを作成する
+func newEngine(options Options, store documentStorage) (*Engine, error) {
+	if err := os.MkdirAll(options.IndexDir, 0777); err != nil {
+		return nil, err
+	}
+	schema, err := openSchema(options.IndexDir, options)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenizer := NewTokenizer()
+	indexer := NewIndexer(tokenizer)
+	indexer.setRAMBudget(options.Cache.RAMBufferBytes, filepath.Join(options.IndexDir, "_segments"))
+
+	e := &Engine{
 		tokenizer:     tokenizer,
 		indexer:       indexer,
-		documentStore: documentStore,
-		indexDir:      path,
+		documentStore: store,
+		indexDir:      options.IndexDir,
+		indexReader:   NewIndexReaderSize(options.IndexDir, options.Cache.PostingsBytes),
+		schema:        schema,
+		scorer:        options.Scorer,
+		cacheBytes:    options.Cache.PostingsBytes,
+		titleCache:    newLRUCache(defaultTitleCacheBytes),
+
+		refreshInterval: options.RefreshInterval,
+	}
+	if err := e.indexReader.loadStoredFields(); err != nil {
+		return nil, err
+	}
+	if err := e.openWAL(); err != nil {
+		return nil, err
 	}
+	if err := e.syncDocIDs(); err != nil {
+		e.wal.close()
+		return nil, err
+	}
+	return e, nil
 }
 
-// インデクスにドキュメントを追加する
-func (e *Engine) AddDocument(title string, reader io.ReadSeeker) error {
-	termCount := e.CountTerm(reader)
-	id, err := e.documentStore.save(title, termCount) // タイトルを保存しドキュメントIDを発行する
+// WALを開き、最後のコミットより後のレコードを再生してメモリ上のインデクスを復元する
+// ドキュメントIDの発行はコミットポイントに記録した値と、再生したドキュメントの続きから再開する
+func (e *Engine) openWAL() error {
+	if err := os.MkdirAll(e.indexDir, 0777); err != nil {
+		return err
+	}
+	commit, err := readCommit(e.indexDir)
 	if err != nil {
 		return err
 	}
-	reader.Seek(0, 0)
-	e.indexer.update(id, reader) // インデクスを更新する
+	e.nextDocID = commit.NextDocID
+	wal, err := openWAL(filepath.Join(e.indexDir, walFileName), commit.WALSeq, func(record walRecord) {
+		switch record.Op {
+		case walAdd:
+			if record.DocID >= e.nextDocID {
+				e.nextDocID = record.DocID + 1
+			}
+			e.indexer.updateTerms(record.DocID, record.Terms)
+			e.indexer.store(record.DocID, record.Fields)
+			e.indexer.setTitle(record.DocID, record.Title)
+			// 書き出しに失敗してもメモリ上に残るので、エラーは無視する
+			e.indexer.maybeSpill()
+		case walDelete:
+			e.indexer.delete(record.DocID)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	e.wal = wal
 	return nil
 }
 
+// DocumentStoreに保存済みのドキュメントIDを発行しないようにする
+// DocumentStoreへの保存後、WALへの記録前にクラッシュしたドキュメントや、
+// MySQLのAUTO_INCREMENTでIDを発行していた以前のインデクスのドキュメントがある
+func (e *Engine) syncDocIDs() error {
+	maxDocID, err := e.documentStore.maxDocID()
+	if err != nil {
+		return err
+	}
+	if e.nextDocID <= maxDocID {
+		e.nextDocID = maxDocID + 1
+	}
+	if e.nextDocID < 1 {
+		e.nextDocID = 1
+	}
+	return nil
+}
+
+// n個の連続したドキュメントIDを発行し、その先頭を返す
+func (e *Engine) allocateDocIDs(n int) DocumentID {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	first := e.nextDocID
+	e.nextDocID += DocumentID(n)
+	return first
+}
+
+// WALとデータベースへの接続を閉じる
+func (e *Engine) Close() error {
+	err := e.wal.close()
+	if e.db == nil {
+		return err
+	}
+	if dbErr := e.db.Close(); err == nil {
+		err = dbErr
+	}
+	return err
+}
+
+// インデクスに本文のみのドキュメントを追加し、発行したドキュメントIDを返す
+func (e *Engine) AddDocument(title string, reader io.ReadSeeker) (DocumentID, error) {
+	return e.Index(Document{Title: title, Body: reader})
+}
+
+// スキーマに従ってドキュメントをインデクスに追加し、発行したドキュメントIDを返す
+func (e *Engine) Index(doc Document) (DocumentID, error) {
+	// ドキュメントを1度だけ読み込んで用語に分割する
+	analyzed, err := e.analyze(doc)
+	if err != nil {
+		return 0, err
+	}
+	// ポスティングリストにはドキュメントIDの昇順に追加する必要があるので、発行から追加までを直列化する
+	e.addMu.Lock()
+	defer e.addMu.Unlock()
+	id := e.allocateDocIDs(1) // ドキュメントIDを発行する
+	if err := e.documentStore.save(id, doc.Title, analyzed.body, analyzed.termCount); err != nil {
+		return 0, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// メモリ上のインデクスを更新する前にWALに記録する
+	// 記録できなければ、インデクスに含まれないドキュメントが残らないように保存を取り消す
+	record := walRecord{Op: walAdd, DocID: id, Title: doc.Title, Terms: analyzed.terms, Fields: analyzed.stored}
+	if err := e.wal.append(record); err != nil {
+		e.documentStore.deleteBatch([]DocumentID{id})
+		return 0, err
+	}
+	e.indexer.updateTerms(id, analyzed.terms) // インデクスを更新する
+	e.indexer.store(id, analyzed.stored)
+	e.indexer.setTitle(id, doc.Title)
+	return id, e.indexer.maybeSpill()
+}
+
+// インデクスのスキーマ
+func (e *Engine) Schema() *Schema {
+	return e.schema
+}
+
+// ドキュメントを置き換え、新しいドキュメントIDを返す
+// ポスティングリストはDocIDの昇順に並んでいる必要があるので、同じIDのまま内容を変えることはできない
+// 新しいドキュメントを追加してから古いドキュメントを削除する
+func (e *Engine) UpdateDocument(docID DocumentID, title string, reader io.ReadSeeker) (DocumentID, error) {
+	return e.Replace(docID, Document{Title: title, Body: reader})
+}
+
+// docIDのドキュメントをdocで置き換え、新しいドキュメントIDを返す
+func (e *Engine) Replace(docID DocumentID, doc Document) (DocumentID, error) {
+	if _, err := e.documentStore.fetchTitle(docID); err != nil {
+		return 0, err
+	}
+	id, err := e.Index(doc)
+	if err != nil {
+		return 0, err
+	}
+	return id, e.DeleteDocument(docID)
+}
+
+// インデクスからドキュメントを削除する
+// 削除したドキュメントは直ちに検索結果に含まれなくなり、Flushでインデクスから取り除かれる
+func (e *Engine) DeleteDocument(docID DocumentID) error {
+	if err := e.documentStore.delete(docID); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.wal.append(walRecord{Op: walDelete, DocID: docID}); err != nil {
+		return err
+	}
+	e.indexer.delete(docID)
+	// DocumentStoreからは削除済みなので、refreshを待たずに検索結果から除外する
+	e.nrt = nil
+	return nil
+}
+
+// インデクス作成時に使うメモリの上限をバイト数で設定する
+// 上限を超えたインデクスはセグメントとしてディスクに書き出され、Flushでマージされる
+func (e *Engine) SetRAMBufferSize(bytes int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.indexer.setRAMBudget(bytes, e.indexer.spillDir)
+}
+
+// 追加・削除したドキュメントを検索結果に反映する間隔を設定する
+// 0のときは検索のたびに反映する
+func (e *Engine) SetRefreshInterval(interval time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.refreshInterval = interval
+}
+
 // ドキュメントをインデクスに追加する処理
 func (e *Engine) CountTerm(reader io.Reader) int {
 	docLen := 0
@@ -62,35 +286,321 @@ func (e *Engine) CountTerm(reader io.Reader) int {
 	return docLen
 }
 
+// 追加・削除したドキュメントをインデクスに書き出してコミットする
+// パイプラインが開いている間はErrPipelineOpenを返す
 func (e *Engine) Flush() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// パイプラインのセグメントのドキュメントはWALにしかないので、WALを切り詰めると失われる
+	if e.pipelines > 0 {
+		return ErrPipelineOpen
+	}
+
+	titles, err := e.flushTitles()
+	if err != nil {
+		return err
+	}
 	writer := NewIndexWriter(e.indexDir)
-	return writer.Flush(e.indexer.index)
+	// メモリ上のインデクスと書き出し済みのセグメントをマージして保存する
+	// コミットポイントには反映したWALレコードの連番を記録し、再起動時に二重に再生しないようにする
+	seq := e.wal.lastSeq()
+	err = writer.flush(flushRequest{
+		index:     e.indexer.index,
+		segments:  e.indexer.segments,
+		stored:    e.indexer.stored,
+		titles:    titles,
+		added:     &e.indexer.added,
+		deleted:   e.indexer.deleted,
+		walSeq:    seq,
+		nextDocID: e.nextDocID,
+	})
+	if err != nil {
+		return err
+	}
+	// 書き出したインデクスを読み込み直すため、キャッシュを捨てる
+	e.indexReader = NewIndexReaderSize(e.indexDir, e.cacheBytes)
+	e.nrt = nil
+	e.segmentTerms = nil
+	if err := e.wal.truncate(seq); err != nil {
+		return err
+	}
+	if err := e.indexer.reset(); err != nil {
+		return err
+	}
+	return e.indexReader.loadStoredFields()
+}
+
+// 新しい世代に記録するタイトル
+// 直前の世代がタイトルを記録していない以前のインデクスであれば、DocumentStoreからまとめて読み込んで加える
+func (e *Engine) flushTitles() (documentTitles, error) {
+	if e.indexReader.hasTitles() {
+		return e.indexer.titles, nil
+	}
+	titles, err := e.documentStore.fetchTitles()
+	if err != nil {
+		return nil, err
+	}
+	for docID, title := range e.indexer.titles {
+		titles[docID] = title
+	}
+	return titles, nil
+}
+
+// 追加・削除したドキュメントを直ちに検索結果に反映する
+func (e *Engine) Refresh() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.refresh()
+}
+
+func (e *Engine) refresh() error {
+	if e.segmentTerms == nil {
+		e.segmentTerms = make(map[string]*segmentTerms)
+	}
+	// セグメントは書き出した後に変更されないので、用語の位置は1度だけ読み込む
+	segments := make([]*segmentTerms, len(e.indexer.segments))
+	for i, filename := range e.indexer.segments {
+		s, ok := e.segmentTerms[filename]
+		if !ok {
+			var err error
+			if s, err = openSegmentTerms(filename); err != nil {
+				return err
+			}
+			e.segmentTerms[filename] = s
+		}
+		segments[i] = s
+	}
+	e.nrt = newNRTReader(e.indexReader, segments, e.indexer)
+	e.refreshedAt = time.Now()
+	return nil
+}
+
+// 検索に使うインデクス読み取り器を返す
+// 前回のrefreshからrefreshInterval以上経過していれば、スナップショットを作り直す
+func (e *Engine) reader() (*nrtReader, error) {
+	e.mu.RLock()
+	nrt := e.nrt
+	fresh := nrt != nil && time.Since(e.refreshedAt) < e.refreshInterval
+	e.mu.RUnlock()
+	if fresh {
+		return nrt, nil
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// 他のgoroutineが作り直していれば、それを使う
+	if e.nrt != nil && e.nrt != nrt && time.Since(e.refreshedAt) < e.refreshInterval {
+		return e.nrt, nil
+	}
+	if err := e.refresh(); err != nil {
+		return nil, err
+	}
+	return e.nrt, nil
 }
 
+// scoreが空なら設定のスコアの計算方法を使う
 func (e *Engine) Search(query string, k int, score string) ([]*SearchResult, error) {
-	// クエリをトークンに分割
-	terms := e.tokenizer.TextToWordSequence(query)
+	res, err := e.SearchWith(SearchRequest{Query: query, K: k, Score: score})
+	if err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
+// SearchRequestのクエリに加える節
+type QueryClause struct {
+	Query string  // Queryと同じ構文のクエリ
+	Boost float64 // 節のすべての用語のスコアに掛ける重み。0のときは1
+}
+
+func (c QueryClause) boost() float64 {
+	if c.Boost == 0 {
+		return 1
+	}
+	return c.Boost
+}
+
+// 検索の条件
+type SearchRequest struct {
+	Query string
+	K     int         // 返す件数
+	Score string      // スコアの計算方法。空なら設定のスコアの計算方法を使う
+	Sort  []SortField // 結果の並び順。空ならスコアの降順
+
+	// 空ならすべての用語を含むドキュメントのみマッチする
+	// Exhaustive, WAND, BlockMaxWAND, MaxScoreを指定すると、いずれかの用語を含むドキュメントにマッチする(OR検索)
+	// WANDなどは上位K件に入りえないドキュメントのスコア計算を省略する。SortかFacetsを指定した場合はすべて評価する
+	Or string
+
+	// 重みをつけてQueryに加える節。節の用語もすべて含むドキュメントのみマッチする
+	Clauses []QueryClause
+	// フィールドの用語のスコアに掛ける重み。スキーマのBoostにさらに掛ける
+	FieldBoosts map[string]float64
+
+	// マッチするドキュメントを絞り込む条件。スコアには影響しない
+	// 「author:Shakespeare AND year:[1590 TO 1600] -genre:comedy」のようにフィールドの値と範囲をAND, OR, NOTで組み合わせる
+	Filter string
+
+	Facets    []string // 検索結果全体で値を集計するkeyword, numeric, dateのフィールド
+	FacetSize int      // フィールドごとに返す値の数。0なら10
+
+	Snippet bool // trueなら結果に本文の抜粋を含める
+}
+
+// 検索の結果
+type SearchResponse struct {
+	TotalHits  int // マッチしたドキュメントの総数。OR検索でスコア計算を省略した場合は、スコアを計算したうちマッチした数
+	ScoredDocs int // スコアを計算したドキュメント数
+	Results    []*SearchResult
+	Facets     map[string][]FacetValue // Facetsに指定したフィールドの、ドキュメント数の多い値
+}
+
+// 条件を指定して検索する
+func (e *Engine) SearchWith(req SearchRequest) (*SearchResponse, error) {
+	score := req.Score
+	if score == "" {
+		score = e.scorer
+	}
+	if err := checkOrAlgorithm(req.Or); err != nil {
+		return nil, err
+	}
+	// クエリを用語と範囲に分割
+	query, err := e.parseRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := e.searchFilter(query, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	sortFields, err := e.sortFields(req.Sort)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.facetFields(req.Facets); err != nil {
+		return nil, err
+	}
 
 	// 検索を実行
-	searcher := NewSearcher(e.indexDir, e.documentStore, score).SearchTopK(terms, k)
+	reader, err := e.reader()
+	if err != nil {
+		return nil, err
+	}
+	s := newSearcher(reader, e.documentStore, score)
+	s.deleted = reader.deleted
+	s.boosts = query.boosts
+	if filter != nil {
+		if s.filter, err = filter.docs(reader); err != nil {
+			return nil, err
+		}
+		// NOTのみの条件はドキュメントを列挙できないので、用語と組み合わせる必要がある
+		if s.filter.negated && len(query.terms) == 0 {
+			return nil, fmt.Errorf("%w: a filter that only excludes documents needs query terms", ErrInvalidQuery)
+		}
+	}
+	var collector topDocsCollector = NewTopKCollector(req.K)
+	if len(sortFields) > 0 {
+		collector = newSortCollector(req.K, sortFields, reader.storedFields, e.titles(reader))
+	}
+	var facets *facetCollector
+	var c Collector = collector
+	if len(req.Facets) > 0 {
+		facets = newFacetCollector(collector, req.Facets, reader.storedFields)
+		c = facets
+	}
+	if req.Or != "" {
+		s.SearchOr(query.terms, c, req.Or)
+	} else {
+		s.Search(query.terms, c)
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	top := collector.TopDocs()
 
-	// タイトルを取得
-	results := make([]*SearchResult, 0, k)
-	for _, result := range searcher.scoreDocs {
-		title, err := e.documentStore.fetchTitle(result.docID)
+	// タイトルを取得。世代に記録されていなければDocumentStoreから読み込む
+	res := &SearchResponse{TotalHits: top.totalHits, ScoredDocs: s.scoredDocs, Results: make([]*SearchResult, 0, len(top.scoreDocs))}
+	for _, result := range top.scoreDocs {
+		title, ok := reader.title(result.docID)
+		if !ok {
+			if title, err = e.documentStore.fetchTitle(result.docID); err != nil {
+				return nil, err
+			}
+		}
+		res.Results = append(res.Results, &SearchResult{
+			DocID: result.docID, Score: result.score, Title: title, Fields: e.schema.storedValues(reader.storedFields(result.docID)),
+		})
+	}
+	if req.Snippet {
+		for _, result := range res.Results {
+			if result.Snippet, err = e.snippet(reader, query.terms, result.DocID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if facets != nil {
+		size := req.FacetSize
+		if size <= 0 {
+			size = defaultFacetSize
+		}
+		res.Facets = facets.facets(size)
+	}
+	return res, nil
+}
+
+// クエリの範囲とフィルタを合わせた条件。どちらもなければnilを返す
+func (e *Engine) searchFilter(query *parsedQuery, filter string) (filterClause, error) {
+	var clauses andFilter
+	if f := query.filter(); f != nil {
+		clauses = append(clauses, f)
+	}
+	if strings.TrimSpace(filter) != "" {
+		f, err := e.parseFilter(filter)
 		if err != nil {
 			return nil, err
 		}
-		results = append(results, &SearchResult{
-			result.docID, result.score, title,
-		})
+		clauses = append(clauses, f)
+	}
+	if len(clauses) == 0 {
+		return nil, nil
 	}
-	return results, nil
+	return clauses, nil
 }
 
 // 検索結果を格納する構造体
 type SearchResult struct {
-	DocID DocumentID
-	Score float64
-	Title string
+	DocID  DocumentID
+	Score  float64
+	Title  string
+	Fields map[string]string // 保存したフィールドの値
+
+	Snippet []SnippetFragment // 本文の抜粋。SearchRequestのSnippetがtrueのときのみ
+}
+
+// DocumentStoreに保存した本文と用語の出現位置から、ドキュメントの抜粋を作る
+// フィールドの用語は本文に出現しないので使わない
+func (e *Engine) snippet(reader termReader, terms []string, docID DocumentID) ([]SnippetFragment, error) {
+	body, err := e.documentStore.fetchBody(docID)
+	if err != nil {
+		return nil, err
+	}
+	var positions []int
+	for _, term := range terms {
+		if strings.Contains(term, ":") {
+			continue
+		}
+		t, err := reader.term(term)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			continue
+		}
+		cursor := t.postings.OpenCursor()
+		cursor.NextDoc(docID)
+		if !cursor.Empty() && cursor.DocID() == docID {
+			positions = append(positions, cursor.Positions()...)
+		}
+	}
+	return e.tokenizer.snippet(body, positions, defaultSnippetWords), nil
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"log"
 	"os"
@@ -49,7 +50,11 @@ func TestMain(m *testing.M) {
 // インデックス構築処理のテスト
 func TestCreateIndex(t *testing.T) {
 	// 本検索エンジンでは、ドキュメントのID生成とIDとタイツろの関係をMySQLに保存します
-	engine := NewSearchEngine(testDB) // 検索エンジンを初期化する
+	engine, err := NewSearchEngine(DefaultOptions()) // 検索エンジンを初期化する
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer engine.Close()
 
 	type testDoc struct {
 		title string
@@ -64,7 +69,7 @@ func TestCreateIndex(t *testing.T) {
 	for _, doc := range docs {
 		// インデクスにドキュメントを追加する
 		r := strings.NewReader(doc.body)
-		if err := engine.AddDocument(doc.title, r); err != nil {
+		if _, err := engine.AddDocument(doc.title, r); err != nil {
 			t.Fatalf("failed to add document %s: %v", doc.title, err)
 		}
 	}
@@ -80,29 +85,29 @@ func TestCreateIndex(t *testing.T) {
 	}
 
 	testCases := []testCase{
-		{"_index_data/_0.dc", "3"},
+		{"_index_data/_gen_1/_0.dc", "3"},
 		{
-			"_index_data/better",
+			"_index_data/_gen_1/better",
 			`[{"DocID":2,"Positions":[1],"TermFrequency":1}]`,
 		},
 		{
-			"_index_data/no",
+			"_index_data/_gen_1/no",
 			`[{"DocID":2,"Positions":[0],"TermFrequency":1},{"DocID":3,"Positions":[2],"TermFrequency":1}]`,
 		},
 		{
-			"_index_data/do",
+			"_index_data/_gen_1/do",
 			`[{"DocID":1, "Positions":[0], "TermFrequency": 1}]`,
 		},
 		{
-			"_index_data/quarrel",
+			"_index_data/_gen_1/quarrel",
 			`[{"DocID":1,"Positions":[2],"TermFrequency":1},{"DocID":3,"Positions":[0],"TermFrequency":1}]`,
 		},
 		{
-			"_index_data/sir",
+			"_index_data/_gen_1/sir",
 			`[{"DocID":1,"Positions":[3],"TermFrequency":1},{"DocID":3,"Positions":[1,3],"TermFrequency":2}]`,
 		},
 		{
-			"_index_data/you",
+			"_index_data/_gen_1/you",
 			`[{"DocID":1,"Positions":[1],"TermFrequency":1}]`,
 		},
 	}
@@ -131,7 +136,11 @@ func TestCreateIndex(t *testing.T) {
 }
 
 func TestSearch(t *testing.T) {
-	engine := NewSearchEngine(testDB)
+	engine, err := NewSearchEngine(DefaultOptions())
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer engine.Close()
 	query := "Quarrel, sir."
 
 	actual, err := engine.Search(query, 5, "TFIDF")
@@ -140,11 +149,91 @@ func TestSearch(t *testing.T) {
 	}
 
 	expected := []*SearchResult{
-		{3, 1.754887502163469, "test3"},
-		{1, 1.1699250014423126, "test1"},
+		{DocID: 3, Score: 1.754887502163469, Title: "test3"},
+		{DocID: 1, Score: 1.1699250014423126, Title: "test1"},
 	}
 
 	for !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("got: %v\nwant: %v\n", actual, expected)
 	}
+
+	// OR検索はいずれかの用語を含むドキュメントを返す
+	res, err := engine.SearchWith(SearchRequest{Query: "quarrel better", K: 5, Score: "TFIDF", Or: WAND})
+	if err != nil {
+		t.Fatalf("failed to search with OR: %v", err)
+	}
+	expected = []*SearchResult{
+		{DocID: 2, Score: 1.5849625007211563, Title: "test2"},
+		{DocID: 1, Score: 0.5849625007211563, Title: "test1"},
+		{DocID: 3, Score: 0.5849625007211563, Title: "test3"},
+	}
+	if !reflect.DeepEqual(res.Results, expected) || res.TotalHits != 3 {
+		t.Fatalf("got: %v (%d hits)\nwant: %v\n", res.Results, res.TotalHits, expected)
+	}
+	if _, err := engine.SearchWith(SearchRequest{Query: "quarrel", Or: "Fastest"}); !errors.Is(err, ErrInvalidQuery) {
+		t.Fatalf("got: %v\nwant: %v\n", err, ErrInvalidQuery)
+	}
+
+	// 用語と節の重みで順位が変わる
+	for _, req := range []SearchRequest{
+		{Query: "better (quarrel sir)^2", K: 5, Score: "TFIDF", Or: Exhaustive},
+		{Query: "better", K: 5, Score: "TFIDF", Or: Exhaustive, Clauses: []QueryClause{{Query: "quarrel sir", Boost: 2}}},
+	} {
+		res, err := engine.SearchWith(req)
+		if err != nil {
+			t.Fatalf("failed to search with boosts: %v", err)
+		}
+		expected = []*SearchResult{
+			{DocID: 3, Score: 3.509775004326938, Title: "test3"},
+			{DocID: 1, Score: 2.339850002884625, Title: "test1"},
+			{DocID: 2, Score: 1.5849625007211563, Title: "test2"},
+		}
+		if !reflect.DeepEqual(res.Results, expected) {
+			t.Fatalf("%+v: got: %v\nwant: %v\n", req, res.Results, expected)
+		}
+	}
+
+	// 抜粋は本文の用語の出現位置の単語をMatchとする
+	res, err = engine.SearchWith(SearchRequest{Query: query, K: 1, Score: "TFIDF", Snippet: true})
+	if err != nil {
+		t.Fatalf("failed to search with snippets: %v", err)
+	}
+	snippet := []SnippetFragment{{"Quarrel", true}, {" ", false}, {"sir!", true}, {" no, ", false}, {"sir!", true}}
+	if !reflect.DeepEqual(res.Results[0].Snippet, snippet) {
+		t.Fatalf("got: %v\nwant: %v\n", res.Results[0].Snippet, snippet)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	engine, err := NewSearchEngine(DefaultOptions())
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	report, err := engine.Reconcile()
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+	expected := &ReconcileReport{IndexedDocs: 3, StoredDocs: 3, NextDocID: 4}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("got: %+v\nwant: %+v\n", report, expected)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	engine, err := NewSearchEngine(DefaultOptions())
+	if err != nil {
+		t.Fatalf("failed to create engine: %v", err)
+	}
+	defer engine.Close()
+
+	report, err := engine.Check(false)
+	if err != nil {
+		t.Fatalf("failed to check index: %v", err)
+	}
+	expected := &CheckReport{Generation: 1, Terms: 6, Postings: 9, DocCount: 3, ExpectedDocCount: 3}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("got: %+v\nwant: %+v\n", report, expected)
+	}
 }
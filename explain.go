@@ -0,0 +1,146 @@
+package ssego
+
+import (
+	"fmt"
+	"strings"
+)
+
+// スコアの計算過程を表す木
+// Valueは子のDetailsから計算した値で、Descriptionはその計算方法を表す
+type Explanation struct {
+	Value       float64
+	Description string
+	Details     []*Explanation `json:",omitempty"`
+}
+
+func newExplanation(value float64, format string, args ...interface{}) *Explanation {
+	return &Explanation{Value: value, Description: fmt.Sprintf(format, args...)}
+}
+
+// 子を1段ずつ字下げした木として表示する
+func (e *Explanation) String() string {
+	var b strings.Builder
+	e.write(&b, 0)
+	return b.String()
+}
+
+func (e *Explanation) write(b *strings.Builder, depth int) {
+	fmt.Fprintf(b, "%s%g = %s\n", strings.Repeat("  ", depth), e.Value, e.Description)
+	for _, detail := range e.Details {
+		detail.write(b, depth+1)
+	}
+}
+
+// ドキュメントがクエリにマッチしたかどうかと、そのスコアがどのように計算されたかを返す
+// scoreにはSearchと同じスコアの計算方法を指定する。空なら設定のスコアの計算方法を使う
+func (e *Engine) Explain(query string, docID DocumentID, score string) (*Explanation, error) {
+	return e.ExplainWith(SearchRequest{Query: query, Score: score}, docID)
+}
+
+// SearchWithでreqを検索したときに、ドキュメントがマッチするかどうかと、そのスコアがどのように計算されたかを返す
+// 結果の件数、並び順と集計の指定は使わない
+func (e *Engine) ExplainWith(req SearchRequest, docID DocumentID) (*Explanation, error) {
+	score := req.Score
+	if score == "" {
+		score = e.scorer
+	}
+	if err := checkOrAlgorithm(req.Or); err != nil {
+		return nil, err
+	}
+	parsed, err := e.parseRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := e.searchFilter(parsed, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := e.reader()
+	if err != nil {
+		return nil, err
+	}
+	s := newSearcher(reader, e.documentStore, score)
+	s.deleted = reader.deleted
+	s.boosts = parsed.boosts
+	if filter != nil {
+		if s.filter, err = filter.docs(reader); err != nil {
+			return nil, err
+		}
+	}
+	return s.explain(parsed.terms, docID, req.Or != "")
+}
+
+// SearchTopKでdocIDのスコアを計算する過程を説明する
+// Searcherと同様に、インデクスに存在しない用語は無視し、残りのすべての用語を含むドキュメントのみマッチする
+// orがtrueならSearchTopKOrと同様に、いずれかの用語を含むドキュメントがマッチし、含まれる用語のみスコアに寄与する
+func (s *Searcher) explain(query []string, docID DocumentID, or bool) (*Explanation, error) {
+	if s.deleted[docID] {
+		return newExplanation(0, "no match: document %d is deleted", docID), nil
+	}
+	if !s.accepts(docID) {
+		return newExplanation(0, "no match: document %d is outside the query ranges or filter", docID), nil
+	}
+	if len(query) == 0 && s.filter != nil {
+		return newExplanation(0, "match: document %d is within the query ranges and filter, which do not affect the score", docID), nil
+	}
+
+	scorer := &Scorer{indexReader: s.indexReader, score: s.score}
+	totalDocCount := s.indexReader.totalDocCount()
+	var termCount int
+	if s.score == "BM25" {
+		var err error
+		if termCount, err = s.documentStore.fetchTermCount(docID); err != nil {
+			return nil, err
+		}
+	}
+
+	result := newExplanation(0, "sum of:")
+	var ignored []string
+	for i, term := range query {
+		t, err := s.indexReader.term(term)
+		if err != nil {
+			return nil, err
+		}
+		if t == nil {
+			ignored = append(ignored, term)
+			continue
+		}
+		c := t.postings.OpenCursor()
+		if c.NextDoc(docID); c.Empty() || c.DocID() != docID {
+			if or {
+				continue
+			}
+			return newExplanation(0, "no match: document %d does not contain term %q", docID, term), nil
+		}
+
+		termFreq, docCount := c.TermFrequency(), t.postings.Len()
+		tf := newExplanation(calcTF(termFreq), "tf, computed as log2(freq) + 1 from:")
+		tf.Details = []*Explanation{newExplanation(float64(termFreq), "freq, occurrences of term within document")}
+		idf := newExplanation(calcIDF(totalDocCount, docCount), "idf, computed as log2(N / df) from:")
+		idf.Details = []*Explanation{
+			newExplanation(float64(totalDocCount), "N, total number of documents"),
+			newExplanation(float64(docCount), "df, number of documents containing term"),
+		}
+		boost := newExplanation(s.boost(i), "boost, weight of term in query")
+
+		weight := newExplanation(scorer.termScore(termFreq, docCount, termCount)*boost.Value, "weight(%s in %d), product of:", term, docID)
+		weight.Details = []*Explanation{boost, tf, idf}
+		if s.score == "BM25" {
+			// CalcBM25は文書長を受け取るが、現在の計算式では使われていない
+			weight.Details = append(weight.Details, newExplanation(float64(termCount), "dl, document length (not used by the current BM25 formula)"))
+		}
+		result.Value += weight.Value
+		result.Details = append(result.Details, weight)
+	}
+
+	if len(result.Details) == 0 {
+		if or && len(ignored) < len(query) {
+			return newExplanation(0, "no match: document %d contains none of the query terms", docID), nil
+		}
+		return newExplanation(0, "no match: no query terms are in the index"), nil
+	}
+	if len(ignored) > 0 {
+		result.Description = fmt.Sprintf("sum of (terms not in the index are ignored: %s):", strings.Join(ignored, ", "))
+	}
+	return result, nil
+}
@@ -0,0 +1,78 @@
+package ssego
+
+import (
+	"fmt"
+	"sort"
+)
+
+// フィールドごとに返す値の数のデフォルト値
+const defaultFacetSize = 10
+
+// フィールドの値と、その値を持つドキュメント数
+type FacetValue struct {
+	Value string
+	Count int
+}
+
+// facetCollectorはマッチしたドキュメントのフィールドの値をdoc valuesから数え、collectorに渡す
+// 上位K件に入らないドキュメントも含めて、検索結果全体の値を数える
+type facetCollector struct {
+	collector Collector
+	fields    []string
+	values    func(docID DocumentID) map[string]string // ドキュメントの保存したフィールドの値
+	counts    map[string]map[string]int                // フィールドごとの値の出現数
+}
+
+func newFacetCollector(collector Collector, fields []string, values func(docID DocumentID) map[string]string) *facetCollector {
+	counts := make(map[string]map[string]int, len(fields))
+	for _, field := range fields {
+		counts[field] = make(map[string]int)
+	}
+	return &facetCollector{collector: collector, fields: fields, values: values, counts: counts}
+}
+
+func (c *facetCollector) Collect(doc *ScoreDoc) {
+	stored := c.values(doc.docID)
+	for _, field := range c.fields {
+		if value, ok := stored[field]; ok {
+			c.counts[field][value]++
+		}
+	}
+	c.collector.Collect(doc)
+}
+
+// フィールドごとに、ドキュメント数の多い順(同数なら値の昇順)にsize件の値を返す
+func (c *facetCollector) facets(size int) map[string][]FacetValue {
+	facets := make(map[string][]FacetValue, len(c.fields))
+	for _, field := range c.fields {
+		values := make([]FacetValue, 0, len(c.counts[field]))
+		for value, count := range c.counts[field] {
+			values = append(values, FacetValue{value, count})
+		}
+		sort.Slice(values, func(i, j int) bool {
+			if values[i].Count != values[j].Count {
+				return values[i].Count > values[j].Count
+			}
+			return values[i].Value < values[j].Value
+		})
+		if len(values) > size {
+			values = values[:size]
+		}
+		facets[field] = values
+	}
+	return facets
+}
+
+// 集計するフィールドを検証する
+func (e *Engine) facetFields(fields []string) error {
+	for _, name := range fields {
+		field, ok := e.schema.Field(name)
+		if !ok {
+			return fmt.Errorf("%w: cannot count values of unknown field %s", ErrInvalidQuery, name)
+		}
+		if !field.hasDocValues() {
+			return fmt.Errorf("%w: cannot count values of %s field %s", ErrInvalidQuery, field.Type, name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,280 @@
+package ssego
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 検索結果を絞り込む条件
+// フィルタはマッチするドキュメントを限定するだけで、スコアには影響しない
+// 用語と範囲の条件にマッチするドキュメントの集合はbitsetとしてキャッシュし、以降の検索で使い回す
+type filterClause interface {
+	docs(reader filterReader) (*docSet, error)
+}
+
+// フィルタの条件ごとにマッチするドキュメントの集合を返すインデクス
+// IndexReaderとnrtReaderが実装する
+type filterReader interface {
+	termReader
+	filterDocs(key string, docs func(reader termReader) (*bitset, error)) (*bitset, error)
+}
+
+// 用語を含むドキュメント
+type termFilter struct {
+	term string
+}
+
+func (f termFilter) docs(reader filterReader) (*docSet, error) {
+	bits, err := reader.filterDocs("term:"+f.term, func(r termReader) (*bitset, error) {
+		t, err := r.term(f.term)
+		if err != nil {
+			return nil, err
+		}
+		docs := &bitset{}
+		if t != nil {
+			for _, docID := range t.postings.docIDs {
+				docs.add(docID)
+			}
+		}
+		return docs, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &docSet{bits: bits}, nil
+}
+
+// 範囲に含まれる値を持つドキュメント
+type rangeFilter struct {
+	*rangeQuery
+}
+
+func (f rangeFilter) docs(reader filterReader) (*docSet, error) {
+	key := fmt.Sprintf("range:%s:%x:%x", f.field, f.lo, f.hi)
+	bits, err := reader.filterDocs(key, f.docIDs)
+	if err != nil {
+		return nil, err
+	}
+	return &docSet{bits: bits}, nil
+}
+
+// すべての条件にマッチするドキュメント。条件がなければすべてのドキュメント
+type andFilter []filterClause
+
+func (f andFilter) docs(reader filterReader) (*docSet, error) {
+	docs := allDocs()
+	for _, clause := range f {
+		clauseDocs, err := clause.docs(reader)
+		if err != nil {
+			return nil, err
+		}
+		docs = docs.and(clauseDocs)
+	}
+	return docs, nil
+}
+
+// いずれかの条件にマッチするドキュメント
+type orFilter []filterClause
+
+func (f orFilter) docs(reader filterReader) (*docSet, error) {
+	docs := allDocs().not()
+	for _, clause := range f {
+		clauseDocs, err := clause.docs(reader)
+		if err != nil {
+			return nil, err
+		}
+		docs = docs.or(clauseDocs)
+	}
+	return docs, nil
+}
+
+// 条件にマッチしないドキュメント
+type notFilter struct {
+	clause filterClause
+}
+
+func (f notFilter) docs(reader filterReader) (*docSet, error) {
+	docs, err := f.clause.docs(reader)
+	if err != nil {
+		return nil, err
+	}
+	return docs.not(), nil
+}
+
+// フィルタを読み込む
+//   - 「フィールド名:値」はフィールドの値が一致するドキュメント、「year:[1590 TO 1600]」のような範囲はその範囲の値を持つドキュメントにマッチする
+//   - フィールド名のない語は本文にその用語を含むドキュメントにマッチする
+//   - 条件はAND(省略できる)、OR、NOT(-でもよい)と()で組み合わせられる。ANDはORより優先する
+//
+// クエリと異なり、スキーマにないフィールドはエラーとする
+func (e *Engine) parseFilter(filter string) (filterClause, error) {
+	words, err := splitQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{engine: e, tokens: splitParens(words)}
+	clause, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q in filter", ErrInvalidQuery, p.tokens[p.pos])
+	}
+	return clause, nil
+}
+
+// 語の前後の括弧を別の語に分ける
+// ""で囲んだ値は"で終わるので、値の中の括弧は分けない
+func splitParens(words []string) []string {
+	var tokens []string
+	for _, word := range words {
+		for strings.HasPrefix(word, "(") {
+			tokens = append(tokens, "(")
+			word = word[1:]
+		}
+		closing := 0
+		for strings.HasSuffix(word, ")") {
+			closing++
+			word = word[:len(word)-1]
+		}
+		if word != "" {
+			tokens = append(tokens, word)
+		}
+		for ; closing > 0; closing-- {
+			tokens = append(tokens, ")")
+		}
+	}
+	return tokens
+}
+
+// フィルタの再帰下降構文解析器
+type filterParser struct {
+	engine *Engine
+	tokens []string
+	pos    int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+// or = and { "OR" and }
+func (p *filterParser) or() (filterClause, error) {
+	var clauses orFilter
+	for {
+		clause, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+		if p.peek() != "OR" {
+			break
+		}
+		p.pos++
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return clauses, nil
+}
+
+// and = unary { ["AND"] unary }
+func (p *filterParser) and() (filterClause, error) {
+	var clauses andFilter
+	for {
+		if p.peek() == "AND" {
+			p.pos++
+		}
+		clause, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		clauses = append(clauses, clause)
+		if next := p.peek(); next == "" || next == "OR" || next == ")" {
+			break
+		}
+	}
+	if len(clauses) == 1 {
+		return clauses[0], nil
+	}
+	return clauses, nil
+}
+
+// unary = ("NOT" | "-") unary | "(" or ")" | clause
+func (p *filterParser) unary() (filterClause, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, fmt.Errorf("%w: filter ends unexpectedly", ErrInvalidQuery)
+	case token == "NOT":
+		p.pos++
+		clause, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{clause}, nil
+	case strings.HasPrefix(token, "-") && len(token) > 1:
+		p.tokens[p.pos] = token[1:]
+		clause, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{clause}, nil
+	case token == "(":
+		p.pos++
+		clause, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, fmt.Errorf("%w: missing ) in filter", ErrInvalidQuery)
+		}
+		p.pos++
+		return clause, nil
+	case token == ")" || token == "AND" || token == "OR":
+		return nil, fmt.Errorf("%w: unexpected %q in filter", ErrInvalidQuery, token)
+	}
+	p.pos++
+	return p.engine.filterClause(token)
+}
+
+// 1つの条件を読み込む
+func (e *Engine) filterClause(word string) (filterClause, error) {
+	name, value, ok := cutField(word)
+	if !ok {
+		name, value = DefaultField, word
+	}
+	field, defined := e.schema.Field(name)
+	if !defined {
+		return nil, fmt.Errorf("%w: field %s is not defined in the schema", ErrInvalidQuery, name)
+	}
+	if !field.Indexed {
+		return nil, fmt.Errorf("%w: field %s is not indexed", ErrInvalidQuery, name)
+	}
+	r, err := parseRange(field, value)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		return rangeFilter{r}, nil
+	}
+	value, err = field.normalize(unquote(value))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	if field.Type != FieldText {
+		return termFilter{fieldTerm(name, value)}, nil
+	}
+	// 本文とtextのフィールドは、値のすべての用語を含むドキュメントにマッチする
+	var clauses andFilter
+	for _, term := range e.tokenizer.TextToWordSequence(value) {
+		if name != DefaultField {
+			term = fieldTerm(name, term)
+		}
+		clauses = append(clauses, termFilter{term})
+	}
+	return clauses, nil
+}
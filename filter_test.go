@@ -0,0 +1,153 @@
+package ssego
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDocSet(t *testing.T) {
+	a, b := &bitset{}, &bitset{}
+	for _, docID := range []DocumentID{1, 2, 64, 130} {
+		a.add(docID)
+	}
+	for _, docID := range []DocumentID{2, 3, 130} {
+		b.add(docID)
+	}
+	x, y := &docSet{bits: a}, &docSet{bits: b}
+
+	// NOTを含む集合は、含まれないDocIDで比べる
+	type testCase struct {
+		name     string
+		set      *docSet
+		negated  bool
+		expected []DocumentID
+	}
+	testCases := []testCase{
+		{"a AND b", x.and(y), false, []DocumentID{2, 130}},
+		{"a OR b", x.or(y), false, []DocumentID{1, 2, 3, 64, 130}},
+		{"a AND NOT b", x.and(y.not()), false, []DocumentID{1, 64}},
+		{"NOT a AND b", x.not().and(y), false, []DocumentID{3}},
+		{"NOT (a OR b)", x.or(y).not(), true, []DocumentID{1, 2, 3, 64, 130}},
+		{"NOT a OR b", x.not().or(y), true, []DocumentID{1, 64}},
+	}
+	for _, testCase := range testCases {
+		var got []DocumentID
+		for docID := DocumentID(0); docID < 200; docID++ {
+			if testCase.set.contains(docID) != testCase.negated {
+				got = append(got, docID)
+			}
+		}
+		if testCase.set.negated != testCase.negated || !reflect.DeepEqual(got, testCase.expected) {
+			t.Fatalf("%s: got:%v\nexpected:%v\n", testCase.name, got, testCase.expected)
+		}
+	}
+	// 演算は元の集合を変更しない
+	if !a.contains(64) || a.contains(3) {
+		t.Fatalf("operands were modified: %v", a.words)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := &Engine{tokenizer: NewTokenizer(), schema: testSchema()}
+	docs := []Document{
+		{Body: strings.NewReader("Do you quarrel, sir?"), Fields: map[string]string{"author": "Shakespeare", "year": "1597"}},
+		{Body: strings.NewReader("Quarrel sir! no, sir!"), Fields: map[string]string{"author": "Shakespeare", "year": "1600"}},
+		{Body: strings.NewReader("No better."), Fields: map[string]string{"author": "Marlowe", "year": "1590"}},
+		{Body: strings.NewReader("Well, sir"), Fields: map[string]string{"author": "Jonson", "year": "1623"}},
+		{Body: strings.NewReader("I do bite my thumb, sir."), Fields: map[string]string{"author": "Shakespeare", "year": "1597"}},
+	}
+	// 先頭の3件はFlushし、残りはメモリ上に置く
+	flushed, unflushed := NewIndexer(e.tokenizer), NewIndexer(e.tokenizer)
+	for i, doc := range docs {
+		analyzed, err := e.analyze(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexer := unflushed
+		if i < 3 {
+			indexer = flushed
+		}
+		indexer.updateTerms(DocumentID(i+1), analyzed.terms)
+	}
+	if err := NewIndexWriter(dir).Flush(flushed.index); err != nil {
+		t.Fatal(err)
+	}
+	reader := newNRTReader(NewIndexReader(dir), nil, unflushed)
+
+	type testCase struct {
+		query    string
+		filter   string
+		expected []DocumentID
+	}
+	testCases := []testCase{
+		{"", "author:Shakespeare", []DocumentID{1, 2, 5}},
+		{"", "author:Shakespeare year:<1600", []DocumentID{1, 5}},
+		{"", "author:Marlowe OR year:>1600", []DocumentID{3, 4}},
+		{"", "(author:Marlowe OR author:Jonson) -year:1590", []DocumentID{4}},
+		{"", "sir AND NOT author:Shakespeare", []DocumentID{4}},
+		{"sir", "-author:Shakespeare", []DocumentID{4}},
+		{"sir", "author:Shakespeare OR NOT year:[* TO 1600]", []DocumentID{1, 2, 4, 5}},
+	}
+	for _, testCase := range testCases {
+		query, err := e.parseQuery(testCase.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		filter, err := e.parseFilter(testCase.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newSearcher(reader, nil, "TFIDF")
+		if s.filter, err = filter.docs(reader); err != nil {
+			t.Fatal(err)
+		}
+		var got []DocumentID
+		s.Search(query.terms, collectorFunc(func(doc *ScoreDoc) {
+			got = append(got, doc.DocID())
+		}))
+		if !reflect.DeepEqual(got, testCase.expected) {
+			t.Fatalf("%s | %s: got:%v\nexpected:%v\n", testCase.query, testCase.filter, got, testCase.expected)
+		}
+	}
+
+	// コミット済みの世代の集合はIndexReaderにキャッシュし、スナップショットを作り直しても使い回す
+	cached, ok := reader.disk.filterCache.get("term:author:Shakespeare")
+	if !ok {
+		t.Fatal("filter bitset is not cached")
+	}
+	expected := &bitset{}
+	expected.add(1)
+	expected.add(2)
+	if !reflect.DeepEqual(cached, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", cached, expected)
+	}
+	filter, _ := e.parseFilter("author:Shakespeare")
+	again := newNRTReader(reader.disk, nil, unflushed)
+	if got, err := filter.docs(again); err != nil {
+		t.Fatal(err)
+	} else if !got.contains(5) || !got.contains(1) || got.contains(3) {
+		t.Fatalf("got: %v", got.bits.words)
+	}
+
+	for _, invalid := range []string{"genre:comedy", "(author:Marlowe", "author:Marlowe OR", "AND", "modified:2026-01-01", "author:Marlowe)"} {
+		if _, err := e.parseFilter(invalid); err == nil {
+			t.Fatalf("%s: expected an error", invalid)
+		}
+	}
+}
+
+// テスト用に関数をCollectorとして使う
+type collectorFunc func(doc *ScoreDoc)
+
+func (f collectorFunc) Collect(doc *ScoreDoc) {
+	f(doc)
+}
@@ -0,0 +1,152 @@
+// grpcserverパッケージは検索エンジンをgRPCのサービスとして公開する
+// サービスの定義はssegopb/ssego.protoにある
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"ssego"
+	"ssego/ssegopb"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// サービスが使う検索エンジンの操作
+type Engine interface {
+	SearchWith(req ssego.SearchRequest) (*ssego.SearchResponse, error)
+	Index(doc ssego.Document) (ssego.DocumentID, error)
+	DeleteDocument(docID ssego.DocumentID) error
+	Stats(topN int) (*ssego.IndexStats, error)
+}
+
+const (
+	defaultResults = 10   // 検索結果の件数が指定されなかったときに返す件数
+	maxResults     = 1000 // 1回の検索で返す結果の上限
+)
+
+type Server struct {
+	ssegopb.UnimplementedSearchEngineServer
+	engine Engine
+}
+
+// engineを使うgRPCサービスを作成する
+// grpc.Serverにはssegopb.RegisterSearchEngineServerで登録する
+func New(engine Engine) *Server {
+	return &Server{engine: engine}
+}
+
+// エンジンのエラーをgRPCのステータスに変換する
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, ssego.ErrDocumentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ssego.ErrInvalidQuery), errors.Is(err, ssego.ErrInvalidDocument):
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func (s *Server) Search(req *ssegopb.SearchRequest, stream ssegopb.SearchEngine_SearchServer) error {
+	if strings.TrimSpace(req.GetQuery()) == "" {
+		return status.Error(codes.InvalidArgument, "query is required")
+	}
+	k := int(req.GetK())
+	if k == 0 {
+		k = defaultResults
+	}
+	if k < 1 || k > maxResults {
+		return status.Errorf(codes.InvalidArgument, "k must be between 1 and %d", maxResults)
+	}
+	score := req.GetScore()
+	switch score {
+	case "", "TFIDF", "BM25":
+		// 空ならエンジンに設定された計算方法を使う
+	default:
+		return status.Errorf(codes.InvalidArgument, "unknown score %q; use TFIDF or BM25", score)
+	}
+
+	res, err := s.engine.SearchWith(ssego.SearchRequest{Query: req.GetQuery(), K: k, Score: score, Or: req.GetOr()})
+	if err != nil {
+		return toStatus(err)
+	}
+	for i, result := range res.Results {
+		err := stream.Send(&ssegopb.SearchResult{
+			Rank:   int32(i + 1),
+			DocId:  int64(result.DocID),
+			Score:  result.Score,
+			Title:  result.Title,
+			Fields: result.Fields,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// クライアントがストリームを閉じるまでドキュメントを追加する
+// 途中でエラーになった場合、それまでに追加したドキュメントはインデクスに残る
+func (s *Server) Index(stream ssegopb.SearchEngine_IndexServer) error {
+	var docIDs []int64
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&ssegopb.IndexResponse{DocIds: docIDs})
+		}
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(req.GetTitle()) == "" {
+			return status.Errorf(codes.InvalidArgument, "title of document %d is required", len(docIDs)+1)
+		}
+		docID, err := s.engine.Index(ssego.Document{
+			Title:  req.GetTitle(),
+			Body:   strings.NewReader(req.GetBody()),
+			Fields: req.GetFields(),
+		})
+		if err != nil {
+			return toStatus(err)
+		}
+		docIDs = append(docIDs, int64(docID))
+	}
+}
+
+func (s *Server) Delete(ctx context.Context, req *ssegopb.DeleteRequest) (*ssegopb.DeleteResponse, error) {
+	if req.GetDocId() < 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid document id %d", req.GetDocId())
+	}
+	if err := s.engine.DeleteDocument(ssego.DocumentID(req.GetDocId())); err != nil {
+		return nil, toStatus(err)
+	}
+	return &ssegopb.DeleteResponse{}, nil
+}
+
+func (s *Server) Stats(ctx context.Context, req *ssegopb.StatsRequest) (*ssegopb.StatsResponse, error) {
+	if req.GetTop() < 0 || req.GetTop() > maxResults {
+		return nil, status.Errorf(codes.InvalidArgument, "top must be between 0 and %d", maxResults)
+	}
+	stats, err := s.engine.Stats(int(req.GetTop()))
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	res := &ssegopb.StatsResponse{
+		Generation:     int64(stats.Generation),
+		DocCount:       int64(stats.DocCount),
+		PendingDocs:    int64(stats.PendingDocs),
+		VocabularySize: int64(stats.VocabularySize),
+		PostingsCount:  int64(stats.PostingsCount),
+		PostingsBytes:  stats.PostingsBytes,
+		AvgDocLength:   stats.AvgDocLength,
+	}
+	for _, term := range stats.TopTerms {
+		res.TopTerms = append(res.TopTerms, &ssegopb.TermStats{
+			Term:          term.Term,
+			DocFreq:       int64(term.DocFreq),
+			TotalTermFreq: int64(term.TotalTermFreq),
+		})
+	}
+	return res, nil
+}
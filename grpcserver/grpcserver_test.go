@@ -0,0 +1,196 @@
+package grpcserver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"ssego"
+	"ssego/ssegopb"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// テスト用の検索エンジン
+type fakeEngine struct {
+	docs   map[ssego.DocumentID]string
+	nextID ssego.DocumentID
+}
+
+func (e *fakeEngine) SearchWith(req ssego.SearchRequest) (*ssego.SearchResponse, error) {
+	if req.Or != "" && req.Or != ssego.WAND {
+		return nil, fmt.Errorf("%w: unknown OR algorithm %q", ssego.ErrInvalidQuery, req.Or)
+	}
+	results := []*ssego.SearchResult{
+		{DocID: 3, Score: 1.75, Title: e.docs[3]},
+		{DocID: 1, Score: 1.25, Title: e.docs[1]},
+	}
+	if len(results) > req.K {
+		results = results[:req.K]
+	}
+	return &ssego.SearchResponse{TotalHits: len(results), Results: results}, nil
+}
+
+func (e *fakeEngine) Index(doc ssego.Document) (ssego.DocumentID, error) {
+	if _, err := ioutil.ReadAll(doc.Body); err != nil {
+		return 0, err
+	}
+	if year, ok := doc.Fields["year"]; ok && year == "" {
+		return 0, ssego.ErrInvalidDocument
+	}
+	id := e.nextID
+	e.nextID++
+	e.docs[id] = doc.Title
+	return id, nil
+}
+
+func (e *fakeEngine) DeleteDocument(docID ssego.DocumentID) error {
+	if _, ok := e.docs[docID]; !ok {
+		return ssego.ErrDocumentNotFound
+	}
+	delete(e.docs, docID)
+	return nil
+}
+
+func (e *fakeEngine) Stats(topN int) (*ssego.IndexStats, error) {
+	return &ssego.IndexStats{
+		Generation: 1,
+		DocCount:   len(e.docs),
+		TopTerms:   []ssego.TermStats{{Term: "sir", DocFreq: 2, TotalTermFreq: 3}},
+	}, nil
+}
+
+// プロセス内のbufconnでサービスを起動し、クライアントを返す
+func newTestClient(t *testing.T, engine Engine) ssegopb.SearchEngineClient {
+	listener := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	ssegopb.RegisterSearchEngineServer(s, New(engine))
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ssegopb.NewSearchEngineClient(conn)
+}
+
+func TestSearch(t *testing.T) {
+	engine := &fakeEngine{docs: map[ssego.DocumentID]string{1: "test1", 3: "test3"}}
+	client := newTestClient(t, engine)
+	ctx := context.Background()
+
+	stream, err := client.Search(ctx, &ssegopb.SearchRequest{Query: "quarrel sir"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		result, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, result.String())
+	}
+	expected := []string{
+		(&ssegopb.SearchResult{Rank: 1, DocId: 3, Score: 1.75, Title: "test3"}).String(),
+		(&ssegopb.SearchResult{Rank: 2, DocId: 1, Score: 1.25, Title: "test1"}).String(),
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+
+	stream, err = client.Search(ctx, &ssegopb.SearchRequest{Query: "quarrel sir", K: 1, Or: ssego.WAND})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "test3"; result.GetTitle() != expected {
+		t.Fatalf("got:%v\nexpected:%v\n", result.GetTitle(), expected)
+	}
+
+	for _, req := range []*ssegopb.SearchRequest{
+		{Query: "quarrel", Score: "PageRank"},
+		{Query: "quarrel", Or: "Fastest"},
+	} {
+		stream, err = client.Search(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := stream.Recv(); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("%v: got:%v\nexpected:%v\n", req, err, codes.InvalidArgument)
+		}
+	}
+}
+
+func TestIndexAndDelete(t *testing.T) {
+	engine := &fakeEngine{docs: map[ssego.DocumentID]string{}, nextID: 1}
+	client := newTestClient(t, engine)
+	ctx := context.Background()
+
+	stream, err := client.Index(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range []*ssegopb.IndexRequest{
+		{Title: "test1", Body: "Do you quarrel, sir?"},
+		{Title: "test2", Body: "No better.", Fields: map[string]string{"year": "1600"}},
+	} {
+		if err := stream.Send(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int64{1, 2}; !reflect.DeepEqual(res.GetDocIds(), expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", res.GetDocIds(), expected)
+	}
+
+	// スキーマに合わないドキュメントはInvalidArgumentになる
+	stream, err = client.Index(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Send(&ssegopb.IndexRequest{Title: "test3", Fields: map[string]string{"year": ""}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.CloseAndRecv(); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("got:%v\nexpected:%v\n", err, codes.InvalidArgument)
+	}
+
+	if _, err := client.Delete(ctx, &ssegopb.DeleteRequest{DocId: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Delete(ctx, &ssegopb.DeleteRequest{DocId: 2}); status.Code(err) != codes.NotFound {
+		t.Fatalf("got:%v\nexpected:%v\n", err, codes.NotFound)
+	}
+
+	stats, err := client.Stats(ctx, &ssegopb.StatsRequest{Top: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.GetDocCount() != 1 || len(stats.GetTopTerms()) != 1 || stats.GetTopTerms()[0].GetTerm() != "sir" {
+		t.Fatalf("got: %v", stats)
+	}
+}
@@ -1,7 +1,6 @@
 package ssego
 
 import (
-	"container/list"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -40,6 +39,7 @@ type DocumentID int64
 //                   |- Positions このドキュメント内の用語の出現いち位置
 //                   +- TermFrequency ドキュメント内の用語の出現回数
 // 転置インデックス
+// PostingsListはPostingごとにオブジェクトを確保せず、DocID・出現回数・出現位置をそれぞれ連続した配列で保持する
 type Index struct {
 	Dictionary     map[string]PostingsList // 辞書
 	TotalDocsCount int                     // ドキュメントの総数
@@ -55,6 +55,18 @@ func NewIndex() *Index {
 	}
 }
 
+// otherのポスティングリストとドキュメント数をidxにマージする
+func (idx *Index) merge(other *Index) {
+	for term, postingsList := range other.Dictionary {
+		if current, ok := idx.Dictionary[term]; ok {
+			idx.Dictionary[term] = mergePostingsLists(current, postingsList)
+		} else {
+			idx.Dictionary[term] = postingsList
+		}
+	}
+	idx.TotalDocsCount += other.TotalDocsCount
+}
+
 func (idx *Index) String() string {
 	var padding int
 
@@ -71,7 +83,7 @@ func (idx *Index) String() string {
 
 	sort.Strings(keys)
 	strs := make([]string, len(keys))
-	format := "  [%-]" + strconv.Itoa(padding) + "s] -> %s"
+	format := "  [%-" + strconv.Itoa(padding) + "s] -> %s"
 
 	for i, k := range keys {
 		if postingList, ok := idx.Dictionary[k]; ok {
@@ -82,85 +94,169 @@ func (idx *Index) String() string {
 	return fmt.Sprintf("total documents : %v\ndictionary:\n%v\n", idx.TotalDocsCount, strings.Join(strs, "\n"))
 }
 
+// PostingをあつめたPostingList
+// DocID, 出現回数, 出現位置を列ごとの配列で保持する
+// 値としてコピーしても同じ配列を参照するように、実体はポインタで持つ
 type PostingsList struct {
-	*list.List
+	*postingsColumns
+}
+
+type postingsColumns struct {
+	docIDs    []DocumentID // i番目のPostingのDocID
+	termFreqs []int        // i番目のPostingの出現回数
+	offsets   []int        // i番目のPostingの出現位置がpositionsのどこから始まるか
+	positions []int        // すべてのPostingの出現位置を連結した配列
 }
 
-// PostingをあつめたPostingList
 func NewPostingsList(postings ...*Posting) PostingsList {
-	l := list.New()
+	pl := PostingsList{&postingsColumns{}}
 
 	for _, posting := range postings {
-		l.PushBack(posting)
+		pl.add(posting)
 	}
 
-	return PostingsList{l}
+	return pl
 }
 
 func (pl PostingsList) add(p *Posting) {
-	pl.PushBack(p)
+	pl.docIDs = append(pl.docIDs, p.DocID)
+	pl.termFreqs = append(pl.termFreqs, p.TermFrequency)
+	pl.offsets = append(pl.offsets, len(pl.positions))
+	pl.positions = append(pl.positions, p.Positions...)
 }
 
-func (pl PostingsList) last() *Posting {
-	e := pl.List.Back()
+func (pl PostingsList) Len() int {
+	return len(pl.docIDs)
+}
 
-	if e == nil {
-		return nil
+// i番目のPostingの出現位置
+func (pl PostingsList) positionsAt(i int) []int {
+	end := len(pl.positions)
+	if i+1 < len(pl.offsets) {
+		end = pl.offsets[i+1]
 	}
+	return pl.positions[pl.offsets[i]:end:end]
+}
 
-	return e.Value.(*Posting)
+// i番目のPosting
+func (pl PostingsList) posting(i int) *Posting {
+	return &Posting{pl.docIDs[i], pl.positionsAt(i), pl.termFreqs[i]}
 }
 
 func (pl PostingsList) Add(new *Posting) {
-	last := pl.last()
+	last := pl.Len() - 1
 
-	if last == nil || last.DocID != new.DocID {
+	if last < 0 || pl.docIDs[last] != new.DocID {
 		pl.add(new)
 		return
 	}
 
-	last.Positions = append(last.Positions, new.Positions...)
-	last.TermFrequency++
+	// 最後のPostingの出現位置はpositionsの末尾にあるので、そのまま追加できる
+	pl.positions = append(pl.positions, new.Positions...)
+	pl.termFreqs[last]++
+}
+
+// 2つのポスティングリストをDocIDの昇順にマージした新しいポスティングリストを返す
+// 同じDocIDのPostingが両方にある場合は出現位置をまとめる
+func mergePostingsLists(a, b PostingsList) PostingsList {
+	merged := PostingsList{&postingsColumns{
+		docIDs:    make([]DocumentID, 0, a.Len()+b.Len()),
+		termFreqs: make([]int, 0, a.Len()+b.Len()),
+		offsets:   make([]int, 0, a.Len()+b.Len()),
+		positions: make([]int, 0, len(a.positions)+len(b.positions)),
+	}}
+
+	i, j := 0, 0
+	for i < a.Len() || j < b.Len() {
+		var p *Posting
+		if j >= b.Len() || (i < a.Len() && a.docIDs[i] <= b.docIDs[j]) {
+			p = a.posting(i)
+			i++
+		} else {
+			p = b.posting(j)
+			j++
+		}
+
+		last := merged.Len() - 1
+		if last >= 0 && merged.docIDs[last] == p.DocID {
+			merged.positions = append(merged.positions, p.Positions...)
+			merged.termFreqs[last] += p.TermFrequency
+			continue
+		}
+		merged.add(p)
+	}
+
+	return merged
+}
+
+// deletedに含まれるドキュメントのPostingを取り除いた新しいポスティングリストを返す
+// 取り除いたドキュメントはremovedに記録する
+func (pl PostingsList) without(deleted, removed map[DocumentID]bool) PostingsList {
+	if len(deleted) == 0 {
+		return pl
+	}
+	result := NewPostingsList()
+	for i, docID := range pl.docIDs {
+		if deleted[docID] {
+			removed[docID] = true
+			continue
+		}
+		result.add(pl.posting(i))
+	}
+	return result
 }
 
 func (pl PostingsList) String() string {
-	str := make([]string, 0, pl.Len())
-	for e := pl.Front(); e != nil; e.Next() {
-		str = append(str, e.Value.(*Posting).String())
+	str := make([]string, pl.Len())
+	for i := range str {
+		str[i] = pl.posting(i).String()
 	}
 
 	return strings.Join(str, "=>")
 }
 
 func (pl PostingsList) MarshalJSON() ([]byte, error) {
-	postings := make([]*Posting, 0, pl.Len())
+	postings := make([]Posting, pl.Len())
 
-	for e := pl.Front(); e != nil; e = e.Next() {
-		postings = append(postings, e.Value.(*Posting))
+	for i := range postings {
+		postings[i] = *pl.posting(i)
 	}
 
 	return json.Marshal(postings)
 }
 
 func (pl *PostingsList) UnmarshalJSON(b []byte) error {
-	var postings []*Posting
+	var postings []Posting
 	if err := json.Unmarshal(b, &postings); err != nil {
 		return err
 	}
 
-	pl.List = list.New()
-
+	n := len(postings)
+	var positions int
 	for _, posting := range postings {
-		pl.add(posting)
+		positions += len(posting.Positions)
+	}
+
+	pl.postingsColumns = &postingsColumns{
+		docIDs:    make([]DocumentID, 0, n),
+		termFreqs: make([]int, 0, n),
+		offsets:   make([]int, 0, n),
+		positions: make([]int, 0, positions),
+	}
+
+	for i := range postings {
+		pl.add(&postings[i])
 	}
 
 	return nil
 }
 
+// カーソルはリストを書き換えないので、同じリストに複数のカーソルを同時に開いてよい
+// NextDocの探索に使う配列はリストを作るときやデコードするときにできあがっている
 func (pl PostingsList) OpenCursor() *Cursor {
 	return &Cursor{
 		postingsList: &pl,
-		current:      pl.Front(),
+		current:      0,
 	}
 }
 
@@ -184,30 +280,56 @@ func (p Posting) String() string {
 // --------------
 type Cursor struct {
 	postingsList *PostingsList // cursorがたどっているポスティングリストへの参照
-	current      *list.Element // 現在の読み込み位置
+	current      int           // 現在の読み込み位置
 }
 
 func (c *Cursor) Next() {
-	c.current = c.current.Next()
+	c.current++
 }
 
 // id以上のドキュメントIDになるまでポインタを進める
+// DocIDの配列を指数的に間隔を広げながら探索(ギャロップ)して範囲を絞り、その範囲を二分探索する
 func (c *Cursor) NextDoc(id DocumentID) {
-	for !c.Empty() && c.DocID() < id {
-		c.Next()
+	docIDs := c.postingsList.docIDs
+	if c.Empty() || docIDs[c.current] >= id {
+		return
+	}
+
+	// docIDs[lo] < id <= docIDs[hi] となるhiを探す
+	lo, step := c.current, 1
+	hi := lo + step
+	for hi < len(docIDs) && docIDs[hi] < id {
+		lo = hi
+		step *= 2
+		hi = lo + step
 	}
+	if hi > len(docIDs) {
+		hi = len(docIDs)
+	}
+
+	c.current = lo + 1 + sort.Search(hi-lo-1, func(i int) bool {
+		return docIDs[lo+1+i] >= id
+	})
 }
 
 func (c *Cursor) Empty() bool {
-	return c.current == nil
+	return c.current >= c.postingsList.Len()
 }
 
 func (c *Cursor) Posting() *Posting {
-	return c.current.Value.(*Posting)
+	return c.postingsList.posting(c.current)
 }
 
 func (c *Cursor) DocID() DocumentID {
-	return c.current.Value.(*Posting).DocID
+	return c.postingsList.docIDs[c.current]
+}
+
+func (c *Cursor) TermFrequency() int {
+	return c.postingsList.termFreqs[c.current]
+}
+
+func (c *Cursor) Positions() []int {
+	return c.postingsList.positionsAt(c.current)
 }
 
 func (c *Cursor) String() string {
@@ -2,84 +2,208 @@ package ssego
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
+	"sync"
 )
 
+// ブロックごとの最大出現回数を保存するファイルの拡張子
+const blockMaxExt = ".bm"
+
+// ポスティングリストのキャッシュサイズのデフォルト値(バイト)
+const defaultPostingsCacheBytes = 64 << 20
+
+// フィルタにマッチするドキュメントの集合のキャッシュサイズ(バイト)
+// 1つの集合は最大のDocIDを8で割ったバイト数になる
+const defaultFilterCacheBytes = 16 << 20
+
+// Searcherが読み込むインデクス
+// コミット済みの世代を読むIndexReaderと、Flushされていないドキュメントも含めるnrtReaderがある
+type termReader interface {
+	term(term string) (*cachedTerm, error) // 用語のポスティングリストとメタデータ。用語が存在しなければnil
+	totalDocCount() int                    // インデクスされたドキュメント数
+}
+
+// IndexReaderは複数のgoroutineから同時に使用できる
 type IndexReader struct {
-	indexDir      string                   // インデクスファイルが保存されているディレクトリのパス
-	postingsCache map[string]*PostingsList // 読み込んだポスティングリストをキャッシュするフィールド
-	docCountCache int                      // インデクスされたドキュメント数をキャッシュするフィールド
+	indexDir      string         // 読み込む世代のインデクスファイルが保存されているディレクトリのパス
+	termCache     *lruCache      // 読み込んだポスティングリストをキャッシュするフィールド
+	loads         loadGroup      // 同じ用語の同時読み込みをまとめる
+	mu            sync.Mutex     // docCountCacheを保護する
+	docCountCache int            // インデクスされたドキュメント数をキャッシュするフィールド。-1なら未読み込み
+	dictOnce      sync.Once      // dictを1度だけ読み込む
+	dict          []TermStats    // 辞書順に並べた用語の統計情報。記録されていなければnil
+	vocab         []string       // dictが記録されていない以前の世代の、辞書順に並べた用語
+	storedOnce    sync.Once      // storedを1度だけ読み込む
+	stored        storedFields   // 保存したフィールドの値
+	storedErr     error          // storedを読み込んだときのエラー
+	titlesOnce    sync.Once      // titlesを1度だけ読み込む
+	titles        documentTitles // 世代に記録したタイトル。記録されていなければnil
+	liveOnce      sync.Once      // liveを1度だけ読み込む
+	live          *bitset        // 世代に含まれるドキュメント。記録されていなければnil
+	filterCache   *lruCache      // フィルタの条件ごとのマッチするドキュメントの集合をキャッシュする
 }
 
 func NewIndexReader(path string) *IndexReader {
-	cache := make(map[string]*PostingsList)
-	return &IndexReader{path, cache, -1}
+	return NewIndexReaderSize(path, defaultPostingsCacheBytes)
 }
 
-// 複数の検索キーワードtermsにマッチするpostingsを読み込んで[]*PostingsListを作成する
-func (r *IndexReader) postingsLists(terms []string) []*PostingsList {
-	// 複数のキーワードtermsなのでpostingsList"S"になる
-	postingsLists := make([]*PostingsList, 0, len(terms))
-	for _, term := range terms {
-		if postings := r.postings(term); postings != nil {
-			postingsLists = append(postingsLists, postings)
-		}
+// ポスティングリストのキャッシュサイズをバイト数で指定してIndexReaderを作成する
+// IndexReaderは作成した時点でコミットされている世代のみを読み込む
+func NewIndexReaderSize(path string, cacheBytes int64) *IndexReader {
+	return &IndexReader{
+		indexDir:      committedDir(path),
+		termCache:     newLRUCache(cacheBytes),
+		filterCache:   newLRUCache(defaultFilterCacheBytes),
+		docCountCache: -1,
 	}
-	return postingsLists
 }
 
+// 用語のポスティングリストを返す。用語が存在しないか読み込めなければnil
 func (r *IndexReader) postings(term string) *PostingsList {
-	// すでに取得図意味であればキャッシュを返す
-	if postingsList, ok := r.postingsCache[term]; ok {
-		return postingsList
+	if t, _ := r.term(term); t != nil {
+		return t.postings
 	}
+	return nil
+}
 
-	// インデクスファイルの取得
-	filename := filepath.Join(r.indexDir, term)
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil
+// 用語のポスティングリストとメタデータを返す
+func (r *IndexReader) term(term string) (*cachedTerm, error) {
+	// すでに取得済みであればキャッシュを返す
+	if t, ok := r.termCache.get(term); ok {
+		return t.(*cachedTerm), nil
 	}
-	defer file.Close()
 
-	bytes, err := ioutil.ReadAll(file)
+	// 他のgoroutineが同じ用語を読み込み中であれば、その結果を使う
+	return r.loads.do(term, func() (*cachedTerm, error) {
+		t, err := r.loadTerm(term)
+		if t != nil {
+			// キャッシュの更新
+			r.termCache.add(term, t, t.size)
+		}
+		return t, err
+	})
+}
+
+// 用語のファイルを読み込む。ファイルが存在しなければ用語が存在しないものとしてnilを返す
+func (r *IndexReader) loadTerm(term string) (*cachedTerm, error) {
+	// インデクスファイルの取得
+	filename := filepath.Join(r.indexDir, termFileName(term))
+	bytes, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
 	if err != nil {
-		return nil
+		return nil, err
 	}
 	var postingsList PostingsList
-	err = json.Unmarshal(bytes, &postingsList)
-	if err != nil {
-		return nil
+	if err := json.Unmarshal(bytes, &postingsList); err != nil {
+		return nil, fmt.Errorf("decode postings list of %q: %w", term, err)
 	}
 
-	// キャッシュの更新
-	r.postingsCache[term] = &postingsList
-	return &postingsList
+	// ブロックごとの最大出現回数の取得
+	// メタデータのファイルが存在しない場合はポスティングリストから計算する
+	var blockMaxes *BlockMaxes
+	bytes, err = ioutil.ReadFile(filepath.Join(r.indexDir, termFileName(term)+blockMaxExt))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(bytes, &blockMaxes); err != nil {
+			return nil, fmt.Errorf("decode block maxes of %q: %w", term, err)
+		}
+	}
+	if blockMaxes == nil {
+		blockMaxes = NewBlockMaxes(postingsList)
+	}
+
+	return newCachedTerm(&postingsList, blockMaxes), nil
 }
 
 func (r *IndexReader) totalDocCount() int {
-	// すでに取得済みであればキャッシュを返す
-	if r.docCountCache > 0 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// すでに取得済みであればキャッシュを返す。世代は変更されないので0件でもキャッシュする
+	if r.docCountCache >= 0 {
 		return r.docCountCache
 	}
-	filename := filepath.Join(r.indexDir, "_0.dc")
-	file, err := os.Open(filename)
+	count, err := readDocCount(r.indexDir)
 	if err != nil {
 		// 読み込みに失敗したら0件とする
-		return 0
+		count = 0
 	}
-	defer file.Close()
-	bytes, err := ioutil.ReadAll(file)
+	r.docCountCache = count
+	return count
+}
+
+// 世代のディレクトリに保存されたドキュメント数を読み込む
+func readDocCount(dir string) (int, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, "_0.dc"))
 	if err != nil {
-		return 0
+		return 0, err
+	}
+	return strconv.Atoi(string(bytes))
+}
+
+// ドキュメントの保存したフィールドの値。保存されていなければnilを返す
+func (r *IndexReader) storedFields(docID DocumentID) map[string]string {
+	r.loadStoredFields()
+	return r.stored[docID]
+}
+
+// すべてのドキュメントの保存したフィールドの値(doc values)を1度だけ読み込む
+// Engineはソートや集計のたびに読み込まないように、IndexReaderを開いたときに呼ぶ
+// 読み込めない場合は、用語と同様に値が存在しないものとしてエラーを返す
+func (r *IndexReader) loadStoredFields() error {
+	r.storedOnce.Do(func() {
+		r.stored, r.storedErr = readStoredFields(r.indexDir)
+	})
+	return r.storedErr
+}
+
+// 世代に記録したドキュメントのタイトル。記録されていなければfalseを返す
+func (r *IndexReader) title(docID DocumentID) (string, bool) {
+	r.loadTitles()
+	title, ok := r.titles[docID]
+	return title, ok
+}
+
+// 世代がタイトルを記録しているか。タイトルを記録していない以前の世代や、読み込めない場合はfalseを返す
+func (r *IndexReader) hasTitles() bool {
+	r.loadTitles()
+	return r.titles != nil
+}
+
+func (r *IndexReader) loadTitles() {
+	r.titlesOnce.Do(func() {
+		r.titles, _ = readTitles(r.indexDir)
+	})
+}
+
+// ドキュメントが世代に含まれるか
+// 世代に含まれるドキュメントを記録していない以前のインデクスでは、DocumentStoreから削除できたドキュメントはすべて含まれていたものとしてtrueを返す
+func (r *IndexReader) containsDoc(docID DocumentID) bool {
+	r.liveOnce.Do(func() {
+		r.live, _ = readLiveDocs(r.indexDir)
+	})
+	return r.live == nil || r.live.contains(docID)
+}
+
+// 条件にマッチするドキュメントの集合を返す
+// keyは条件を表す文字列で、同じ条件の集合は世代が変わるまでキャッシュして使い回す
+// 用語を読み込めなかった場合はキャッシュせずにエラーを返す
+func (r *IndexReader) filterDocs(key string, docs func(reader termReader) (*bitset, error)) (*bitset, error) {
+	if b, ok := r.filterCache.get(key); ok {
+		return b.(*bitset), nil
 	}
-	count, err := strconv.Atoi(string(bytes))
+	b, err := docs(r)
 	if err != nil {
-		return 0
+		return nil, err
 	}
-	r.docCountCache = count
-	return count
+	r.filterCache.add(key, b, b.size())
+	return b, nil
 }
@@ -0,0 +1,149 @@
+package ssego
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+// 0からstepおきにn件のドキュメントを含むポスティングリストを作成する
+func newTestPostingsList(n, step int) PostingsList {
+	postings := make([]*Posting, n)
+	for i := range postings {
+		postings[i] = NewPosting(DocumentID(i*step), 0)
+	}
+	return NewPostingsList(postings...)
+}
+
+func TestCursorNextDoc(t *testing.T) {
+	pl := newTestPostingsList(1000, 3)
+
+	type testCase struct {
+		target   DocumentID
+		expected DocumentID
+	}
+	testCases := []testCase{
+		{0, 0},
+		{1, 3},
+		{300, 300},
+		{301, 303},
+		{2997, 2997},
+		{1500, 2997}, // 後ろに戻ることはない
+	}
+
+	c := pl.OpenCursor()
+	for _, testCase := range testCases {
+		if c.NextDoc(testCase.target); c.Empty() || c.DocID() != testCase.expected {
+			t.Fatalf("NextDoc(%v): got: %v\nwant: %v\n", testCase.target, c, testCase.expected)
+		}
+	}
+
+	if c.NextDoc(2998); !c.Empty() {
+		t.Fatalf("NextDoc(2998): got: %v\nwant: empty\n", c)
+	}
+}
+
+func TestCursorConcurrent(t *testing.T) {
+	// インデックスから読み込んだリストはキャッシュを通して複数の検索で共有される
+	bytes, err := json.Marshal(newTestPostingsList(1000, 3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pl PostingsList
+	if err := json.Unmarshal(bytes, &pl); err != nil {
+		t.Fatal(err)
+	}
+
+	// -raceで実行すると、カーソルを開いたり進めたりするときにリストを書き換えていれば検出される
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(step DocumentID) {
+			defer wg.Done()
+			c := pl.OpenCursor()
+			for id := DocumentID(0); id <= 2997; id += step {
+				c.NextDoc(id)
+				if expected := (id + 2) / 3 * 3; c.Empty() || c.DocID() != expected {
+					t.Errorf("NextDoc(%v): got: %v\nwant: %v\n", id, c, expected)
+					return
+				}
+			}
+		}(DocumentID(i*7 + 1))
+	}
+	wg.Wait()
+}
+
+// 出現頻度の低い用語と高い用語のポスティングリストの積集合を求める
+func intersect(rare, common PostingsList, nextDoc func(c *Cursor, id DocumentID)) int {
+	var hits int
+	c := common.OpenCursor()
+	for r := rare.OpenCursor(); !r.Empty(); r.Next() {
+		if nextDoc(c, r.DocID()); c.Empty() {
+			break
+		}
+		if c.DocID() == r.DocID() {
+			hits++
+		}
+	}
+	return hits
+}
+
+func BenchmarkIntersectNextDoc(b *testing.B) {
+	rare := newTestPostingsList(100, 10007)
+	common := newTestPostingsList(1000000, 1)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		intersect(rare, common, (*Cursor).NextDoc)
+	}
+}
+
+func BenchmarkIntersectLinear(b *testing.B) {
+	rare := newTestPostingsList(100, 10007)
+	common := newTestPostingsList(1000000, 1)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		// 探索せずに1件ずつ進める
+		intersect(rare, common, func(c *Cursor, id DocumentID) {
+			for !c.Empty() && c.DocID() < id {
+				c.Next()
+			}
+		})
+	}
+}
+
+// ポスティングリストをファイルから読み込んで走査する
+func BenchmarkPostingsListDecode(b *testing.B) {
+	bytes, err := json.Marshal(newTestPostingsList(100000, 2))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var pl PostingsList
+		if err := json.Unmarshal(bytes, &pl); err != nil {
+			b.Fatal(err)
+		}
+		var sum int
+		for c := pl.OpenCursor(); !c.Empty(); c.Next() {
+			sum += c.TermFrequency()
+		}
+	}
+}
+
+func TestIndexString(t *testing.T) {
+	idx := NewIndex()
+	idx.Dictionary["sir"] = NewPostingsList(NewPosting(1, 3), NewPosting(3, 1, 3))
+	idx.Dictionary["no"] = NewPostingsList(NewPosting(2, 0))
+	idx.TotalDocsCount = 3
+
+	expected := "total documents : 3\ndictionary:\n" +
+		"  [no ] -> (2, [0], 1)\n" +
+		"  [sir] -> (1, [3], 1)=>(3, [1 3], 2)\n"
+	if got := idx.String(); got != expected {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+}
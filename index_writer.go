@@ -1,9 +1,9 @@
 package ssego
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -12,6 +12,9 @@ import (
 // IndexWriterはポスティングリストとインデクスの統計情報をファイルに保存する
 // 検索時にクエリに関連したポスティングリストのみロードできるように、ポスティングリストは用語ごとに別ファイルに保存する
 // ファイルにはポスティングリストのJSON文字列を保存する
+//
+// Flushのたびに直前にコミットされた世代と新しいドキュメントをマージした新しい世代を作成し、
+// すべてのファイルをディスクに同期してからコミットポイントを置き換える
 type IndexWriter struct {
 	indexDir string
 }
@@ -20,18 +23,273 @@ func NewIndexWriter(path string) *IndexWriter {
 	return &IndexWriter{path}
 }
 
+// Flushで新しい世代に書き込む内容
+type flushRequest struct {
+	index     *Index              // メモリ上のインデクス
+	segments  []string            // Indexerが書き出したセグメントファイル
+	stored    storedFields        // メモリ上のドキュメントの保存したフィールドの値
+	titles    documentTitles      // メモリ上のドキュメントのタイトル。直前の世代に記録されていないタイトルも含める
+	added     *bitset             // メモリ上のインデクスとセグメントに含まれるドキュメント。nilなら不明
+	deleted   map[DocumentID]bool // 取り除くドキュメント
+	walSeq    int64               // 新しい世代に反映されるWALレコードの最後の連番
+	nextDocID DocumentID          // 次に発行するドキュメントID
+}
+
 // インデクスの永続化処理
 func (w *IndexWriter) Flush(index *Index) error {
-	for term, postingsList := range index.Dictionary {
-		if err := w.postingsList(term, postingsList); err != nil {
-			fmt.Printf("failed to save %s postings list: %v", term, err)
+	return w.flush(flushRequest{index: index})
+}
+
+// メモリ上のインデクスとIndexerが書き出したセグメントファイルをマージして永続化する
+// セグメントは用語の昇順に並んでいるので先頭から順に読みながらマージでき、メモリ上に載るのは1用語分のポスティングリストのみとなる
+func (w *IndexWriter) FlushSegments(index *Index, segments []string) error {
+	return w.flush(flushRequest{index: index, segments: segments})
+}
+
+func (w *IndexWriter) flush(req flushRequest) error {
+	return w.commit(req.walSeq, req.nextDocID, func(dir string, prev commitPoint) (int, error) {
+		return w.merge(dir, prev, req)
+	})
+}
+
+// writeで新しい世代のディレクトリにファイルを書き込み、ディスクに同期してからコミットする
+// writeには直前にコミットされた世代が渡され、新しい世代のドキュメント数を返す
+func (w *IndexWriter) commit(walSeq int64, nextDocID DocumentID, write func(dir string, prev commitPoint) (int, error)) error {
+	if err := os.MkdirAll(w.indexDir, 0777); err != nil {
+		return err
+	}
+	commit, err := readCommit(w.indexDir)
+	if err != nil {
+		return err
+	}
+	// 前回の書き込み途中でクラッシュした世代が残っていれば削除する
+	if err := removeGenerations(w.indexDir, commit.Generation, 0); err != nil {
+		return err
+	}
+
+	next := commitPoint{Generation: commit.Generation + 1, WALSeq: commit.WALSeq}
+	if walSeq > next.WALSeq {
+		next.WALSeq = walSeq
+	}
+	// ドキュメントIDは単調増加なので、コミットポイントの値が戻ることはない
+	next.NextDocID = commit.NextDocID
+	if nextDocID > next.NextDocID {
+		next.NextDocID = nextDocID
+	}
+	dir := generationDir(w.indexDir, next.Generation)
+	tmpDir := dir + tmpSuffix
+	if err := os.MkdirAll(tmpDir, 0777); err != nil {
+		return err
+	}
+
+	next.DocCount, err = write(tmpDir, commit)
+	if err == nil {
+		err = syncDir(tmpDir)
+	}
+	if err == nil {
+		err = os.Rename(tmpDir, dir)
+	}
+	if err == nil {
+		err = syncDir(w.indexDir)
+	}
+	if err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+
+	if err := writeCommit(w.indexDir, next); err != nil {
+		return err
+	}
+	return removeGenerations(w.indexDir, next.Generation, commit.Generation)
+}
+
+// 直前にコミットされた世代のディレクトリとドキュメント数を返す
+// まだコミットされていなければ、世代を持たない以前の形式のインデクスを直前の世代とする。どちらもなければ空文字列を返す
+func (w *IndexWriter) previous(commit commitPoint) (string, int, error) {
+	if commit.Generation > 0 {
+		return generationDir(w.indexDir, commit.Generation), commit.DocCount, nil
+	}
+	docCount, err := readDocCount(w.indexDir)
+	if os.IsNotExist(err) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	return w.indexDir, docCount, nil
+}
+
+// 直前の世代、メモリ上のインデクス、セグメントをマージしてdirに書き込み、ドキュメント数を返す
+// 削除されたドキュメントのPostingはここで取り除く
+func (w *IndexWriter) merge(dir string, commit commitPoint, req flushRequest) (int, error) {
+	prevDir, prevDocCount, err := w.previous(commit)
+	if err != nil {
+		return 0, err
+	}
+	iterators := []termIterator{newIndexIterator(req.index)}
+	docCount := req.index.TotalDocsCount
+	if prevDir != "" {
+		it, err := openGeneration(prevDir)
+		if err != nil {
+			return 0, err
+		}
+		iterators = append(iterators, it)
+		docCount += prevDocCount
+	}
+	for _, segment := range req.segments {
+		r, err := openSegment(segment)
+		if err != nil {
+			closeIterators(iterators)
+			return 0, err
+		}
+		iterators = append(iterators, r)
+		docCount += r.docCount
+	}
+
+	merged, err := newMergeIterator(iterators...)
+	if err != nil {
+		closeIterators(iterators)
+		return 0, err
+	}
+	defer merged.close()
+
+	// 直前の世代に含まれるドキュメント。_docsのない以前の世代ではnil
+	live := &bitset{}
+	if prevDir != "" {
+		if live, err = readLiveDocs(prevDir); err != nil {
+			return 0, err
+		}
+	}
+	// ポスティングリストに現れるドキュメント
+	seen := &bitset{}
+	// 書き込んだ用語の統計情報。マージは用語の昇順に進むので辞書順に並ぶ
+	var dict []TermStats
+
+	removed := make(map[DocumentID]bool)
+	for {
+		ok, err := merged.next()
+		if err != nil {
+			return 0, err
+		}
+		if !ok {
+			break
+		}
+		for _, docID := range merged.postings().docIDs {
+			seen.add(docID)
+		}
+		term, postingsList := merged.term(), merged.postings().without(req.deleted, removed)
+		if postingsList.Len() == 0 {
+			continue
+		}
+		if err := w.postingsList(dir, term, postingsList); err != nil {
+			return 0, err
+		}
+		if err := w.blockMaxes(dir, term, postingsList); err != nil {
+			return 0, err
+		}
+		dict = append(dict, TermStats{Term: term, DocFreq: postingsList.Len(), TotalTermFreq: len(postingsList.positions)})
+	}
+	docCount -= w.appliedDeletes(commit, req, live, removed)
+	if err := writeTermDictionary(dir, dict); err != nil {
+		return 0, err
+	}
+
+	// 新しい世代に含まれるドキュメントを記録する
+	// 以前の世代の用語を持たないドキュメントはポスティングリストに現れないので記録されない
+	next := seen
+	if live != nil {
+		next = next.or(live)
+	}
+	if req.added != nil {
+		next = next.or(req.added)
+	}
+	deleted := &bitset{}
+	for docID := range req.deleted {
+		deleted.add(docID)
+	}
+	next = next.andNot(deleted)
+	if err := writeLiveDocs(dir, next); err != nil {
+		return 0, err
+	}
+	if err := w.storedFields(dir, prevDir, req); err != nil {
+		return 0, err
+	}
+	if err := w.titles(dir, prevDir, req, next); err != nil {
+		return 0, err
+	}
+	return docCount, w.docCount(dir, docCount)
+}
+
+// 削除のうち、直前の世代かFlushされていないドキュメントに含まれていたものの数
+// 用語を持たないドキュメントはポスティングリストに現れないので、removedに加えてドキュメントの集合で判定する
+func (w *IndexWriter) appliedDeletes(commit commitPoint, req flushRequest, live *bitset, removed map[DocumentID]bool) int {
+	applied := 0
+	for docID := range req.deleted {
+		switch {
+		case removed[docID]:
+		case req.added != nil && req.added.contains(docID):
+		case live != nil && live.contains(docID):
+		case live == nil && (commit.Generation == 0 || docID < commit.NextDocID):
+			// _docsのない以前の世代では、発行済みのIDのドキュメントは直前の世代に含まれていたものとする
+			// 世代を持たない以前の形式のインデクスは発行済みのIDを記録していないので、すべて含まれていたものとする
+			// DocumentStoreに存在するドキュメントのみ削除できるので、同じドキュメントを2度削除することはない
+		default:
+			continue
+		}
+		applied++
+	}
+	return applied
+}
+
+// 直前の世代とメモリ上のドキュメントの保存したフィールドの値をマージして書き込む
+// prevDirは直前の世代のディレクトリで、空文字列なら直前の世代はない
+func (w *IndexWriter) storedFields(dir, prevDir string, req flushRequest) error {
+	stored := storedFields{}
+	if prevDir != "" {
+		var err error
+		if stored, err = readStoredFields(prevDir); err != nil {
+			return err
+		}
+	}
+	for docID, fields := range req.stored {
+		stored[docID] = fields
+	}
+	for docID := range req.deleted {
+		delete(stored, docID)
+	}
+	return writeStoredFields(dir, stored)
+}
+
+// 直前の世代とメモリ上のドキュメントのタイトルをマージし、新しい世代に含まれるドキュメントのもののみ書き込む
+func (w *IndexWriter) titles(dir, prevDir string, req flushRequest, docs *bitset) error {
+	titles := documentTitles{}
+	if prevDir != "" {
+		prev, err := readTitles(prevDir)
+		if err != nil {
+			return err
+		}
+		for docID, title := range prev {
+			titles[docID] = title
+		}
+	}
+	for docID, title := range req.titles {
+		titles[docID] = title
+	}
+	for docID := range titles {
+		if !docs.contains(docID) {
+			delete(titles, docID)
 		}
 	}
-	return w.docCount(index.TotalDocsCount)
+	return writeTitles(dir, titles)
+}
 
+func closeIterators(iterators []termIterator) {
+	for _, it := range iterators {
+		it.close()
+	}
 }
 
-func (w *IndexWriter) postingsList(term string, list PostingsList) error {
+func (w *IndexWriter) postingsList(dir, term string, list PostingsList) error {
 
 	bytes, err := json.Marshal(list)
 
@@ -39,29 +297,80 @@ func (w *IndexWriter) postingsList(term string, list PostingsList) error {
 		return err
 	}
 
-	filename := filepath.Join(w.indexDir, term)
-	file, err := os.Create(filename)
+	return writeFileSync(filepath.Join(dir, termFileName(term)), bytes)
+}
+
+// 動的枝刈りで使うブロックごとの最大出現回数を用語ごとに保存する
+func (w *IndexWriter) blockMaxes(dir, term string, list PostingsList) error {
+	bytes, err := json.Marshal(NewBlockMaxes(list))
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	writer := bufio.NewWriter(file)
-	_, err = writer.Write(bytes)
+	return writeFileSync(filepath.Join(dir, termFileName(term)+blockMaxExt), bytes)
+}
+
+func (w *IndexWriter) docCount(dir string, count int) error {
+	return writeFileSync(filepath.Join(dir, "_0.dc"), []byte(strconv.Itoa(count)))
+}
+
+// 世代に含まれるドキュメントのDocIDを保存するファイル名
+const liveDocsFileName = "_docs"
+
+// 世代の用語とその統計情報を保存するファイル名
+const termDictFileName = "_terms"
+
+// 世代の用語を辞書順に並べ、ドキュメント頻度と出現回数の合計とともに書き込む
+// 補完候補を求めるときに、ポスティングリストを読み込まずに済む
+func writeTermDictionary(dir string, dict []TermStats) error {
+	if dict == nil {
+		dict = []TermStats{}
+	}
+	bytes, err := json.Marshal(dict)
 	if err != nil {
 		return err
 	}
+	return writeFileSync(filepath.Join(dir, termDictFileName), bytes)
+}
 
-	return writer.Flush()
+// 世代の用語の統計情報を読み込む。_termsのない以前の世代ではnilを返す
+func readTermDictionary(dir string) ([]TermStats, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, termDictFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dict := []TermStats{}
+	if err := json.Unmarshal(bytes, &dict); err != nil {
+		return nil, fmt.Errorf("invalid term dictionary: %v", err)
+	}
+	return dict, nil
 }
 
-func (w *IndexWriter) docCount(count int) error {
-	filename := filepath.Join(w.indexDir, "_0.dc")
-	file, err := os.Create(filename)
+// 世代に含まれるドキュメントの集合を書き込む
+// 用語を持たないドキュメントも含むので、削除したドキュメントが世代に含まれていたかを判定できる
+func writeLiveDocs(dir string, docs *bitset) error {
+	bytes, err := json.Marshal(docs.words)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	_, err = file.Write([]byte(strconv.Itoa(count)))
-	return err
+	return writeFileSync(filepath.Join(dir, liveDocsFileName), bytes)
+}
+
+// 世代に含まれるドキュメントの集合を読み込む。_docsのない以前の世代ではnilを返す
+func readLiveDocs(dir string) (*bitset, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(dir, liveDocsFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	docs := &bitset{}
+	if err := json.Unmarshal(bytes, &docs.words); err != nil {
+		return nil, fmt.Errorf("invalid live documents: %v", err)
+	}
+	return docs, nil
 }
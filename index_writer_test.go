@@ -0,0 +1,115 @@
+package ssego
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndexWriterCommit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	flush := func(docs map[DocumentID]string) {
+		indexer := NewIndexer(NewTokenizer())
+		for _, id := range []DocumentID{1, 2, 3, 4} {
+			if doc, ok := docs[id]; ok {
+				indexer.update(id, strings.NewReader(doc))
+			}
+		}
+		if err := NewIndexWriter(dir).Flush(indexer.index); err != nil {
+			t.Fatalf("failed to flush: %v", err)
+		}
+	}
+
+	flush(map[DocumentID]string{1: "Do you quarrel, sir?", 2: "Quarrel sir! no, sir!"})
+	before := NewIndexReader(dir)
+
+	// 書き込み途中でクラッシュした世代
+	crashed := generationDir(dir, 2) + tmpSuffix
+	if err := os.MkdirAll(crashed, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(crashed, "quarrel"), []byte("[{"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	flush(map[DocumentID]string{3: "No better.", 4: "Well, sir"})
+	after := NewIndexReader(dir)
+
+	// Flush前に作成したIndexReaderは前の世代を読み続ける
+	if got := before.postings("sir").Len(); got != 2 {
+		t.Errorf("old reader: got %d postings, want 2", got)
+	}
+	if got := before.totalDocCount(); got != 2 {
+		t.Errorf("old reader: got %d docs, want 2", got)
+	}
+
+	// 新しい世代には前の世代と追加したドキュメントがマージされている
+	expected := NewPostingsList(NewPosting(1, 3), NewPosting(2, 1, 3), NewPosting(4, 1))
+	if got := after.postings("sir"); !reflect.DeepEqual(*got, expected) {
+		t.Errorf("got: %v\nwant: %v\n", got, expected)
+	}
+	if got := after.totalDocCount(); got != 4 {
+		t.Errorf("got %d docs, want 4", got)
+	}
+
+	commit, err := readCommit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if commit != (commitPoint{Generation: 2, DocCount: 4}) {
+		t.Errorf("got commit %+v", commit)
+	}
+	if _, err := os.Stat(crashed); !os.IsNotExist(err) {
+		t.Errorf("uncommitted generation is not removed: %v", err)
+	}
+}
+
+func TestIndexWriterFlatIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// 世代を持たない以前の形式のインデクスを複製する
+	files, err := ioutil.ReadDir("testdata/index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		bytes, err := ioutil.ReadFile(filepath.Join("testdata/index", file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, file.Name()), bytes, 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 最初のFlushでは以前の形式のインデクスを直前の世代としてマージする
+	indexer := NewIndexer(NewTokenizer())
+	indexer.update(6, strings.NewReader("Sir, sir!"))
+	err = NewIndexWriter(dir).flush(flushRequest{index: indexer.index, deleted: map[DocumentID]bool{1: true}})
+	if err != nil {
+		t.Fatalf("failed to flush: %v", err)
+	}
+
+	reader := NewIndexReader(dir)
+	expected := NewPostingsList(NewPosting(2, 1, 3), NewPosting(3, 3), NewPosting(5, 1), NewPosting(6, 0, 1))
+	if got := reader.postings("sir"); !reflect.DeepEqual(*got, expected) {
+		t.Errorf("got: %v\nwant: %v\n", got, expected)
+	}
+	if got := reader.totalDocCount(); got != 5 {
+		t.Errorf("got %d docs, want 5", got)
+	}
+	if got := NewSearcher(dir, nil, "TFIDF").SearchTopK([]string{"quarrel"}, 10).TotalHits(); got != 1 {
+		t.Errorf("got %d hits for quarrel, want 1", got)
+	}
+}
@@ -3,11 +3,24 @@ package ssego
 import (
 	"bufio"
 	"io"
+	"io/ioutil"
+	"os"
 )
 
+// メモリ上のインデクスの大きさを見積もるときの、用語1つあたりの辞書とポスティングリストのオーバーヘッド(バイト)
+const termOverhead = 128
+
 type Indexer struct {
 	index     *Index
 	tokenizer *Tokenizer
+	ramBudget int64               // メモリ上のインデクスの大きさの上限(バイト)。0のときは上限なし
+	ramBytes  int64               // メモリ上のインデクスのおおよその大きさ(バイト)
+	spillDir  string              // 上限を超えたときにセグメントを書き出すディレクトリ
+	segments  []string            // 書き出したセグメントファイルのパス
+	added     bitset              // 追加されたがまだFlushされていないドキュメント
+	deleted   map[DocumentID]bool // 削除されたがまだFlushされていないドキュメント
+	stored    storedFields        // Flushされていないドキュメントの保存したフィールドの値
+	titles    documentTitles      // Flushされていないドキュメントのタイトル
 }
 
 func NewIndexer(tokenizer *Tokenizer) *Indexer {
@@ -17,6 +30,12 @@ func NewIndexer(tokenizer *Tokenizer) *Indexer {
 	}
 }
 
+// メモリ上のインデクスの大きさがramBudgetバイトを超えたら、dirにセグメントとして書き出すようにする
+func (idxr *Indexer) setRAMBudget(ramBudget int64, dir string) {
+	idxr.ramBudget = ramBudget
+	idxr.spillDir = dir
+}
+
 // ドキュメントをインデクスに追加する処理
 // ドキュメント本文を読み込んで、Tokenizerで分割
 // 分割した用語からポスティングリストを作成する
@@ -26,18 +45,128 @@ func (idxr *Indexer) update(docID DocumentID, reader io.Reader) {
 	// bufio.Scannerを使用することでファイルや標準入力などからデータを少しずつ読み込むことができる。
 	scanner := bufio.NewScanner(reader)
 	scanner.Split(idxr.tokenizer.SplitFunc) // 分割方法の指定
-	var position int
+	var terms []string
 	for scanner.Scan() {
-		term := scanner.Text() // 用語ごとに読み込み
+		terms = append(terms, scanner.Text()) // 用語ごとに読み込み
+	}
+	idxr.updateTerms(docID, terms)
+}
+
+// Tokenizerで分割済みの用語の列からポスティングリストを作成する
+func (idxr *Indexer) updateTerms(docID DocumentID, terms []string) {
+	for position, term := range terms {
 		// ポスティングリストの更新
 		if postingsList, ok := idxr.index.Dictionary[term]; !ok {
 			// termをキーとするポスティングリストが存在しない場合
 			idxr.index.Dictionary[term] = NewPostingsList(NewPosting(docID, position))
+			idxr.ramBytes += int64(len(term)) + termOverhead
 		} else {
 			// ポスティングリストがすでに存在する場合は追加
+			if postingsList.docIDs[postingsList.Len()-1] != docID {
+				// DocID, 出現回数, 出現位置の開始位置
+				idxr.ramBytes += 24
+			}
 			postingsList.Add(NewPosting(docID, position))
 		}
-		position++
+		// 出現位置
+		idxr.ramBytes += 8
 	}
 	idxr.index.TotalDocsCount++
+	idxr.added.add(docID)
+}
+
+// ドキュメントの保存するフィールドの値を記録する
+// セグメントを書き出しても、Flushするまでメモリ上に残す
+func (idxr *Indexer) store(docID DocumentID, fields map[string]string) {
+	if len(fields) == 0 {
+		return
+	}
+	if idxr.stored == nil {
+		idxr.stored = make(storedFields)
+	}
+	idxr.stored[docID] = fields
+}
+
+// タイトルで並べるために、ドキュメントのタイトルを記録する
+// 保存したフィールドの値と同じく、Flushするまでメモリ上に残す
+func (idxr *Indexer) setTitle(docID DocumentID, title string) {
+	if idxr.titles == nil {
+		idxr.titles = make(documentTitles)
+	}
+	idxr.titles[docID] = title
+}
+
+// ドキュメントを削除する
+// 削除したドキュメントのポスティングはFlushでインデクスから取り除かれる
+func (idxr *Indexer) delete(docID DocumentID) {
+	if idxr.deleted == nil {
+		idxr.deleted = make(map[DocumentID]bool)
+	}
+	idxr.deleted[docID] = true
+}
+
+// メモリ上のインデクスの大きさが上限を超えていたら、セグメントファイルに書き出してメモリを空にする
+func (idxr *Indexer) maybeSpill() error {
+	if idxr.ramBudget <= 0 || idxr.ramBytes < idxr.ramBudget {
+		return nil
+	}
+	return idxr.spill()
+}
+
+func (idxr *Indexer) spill() error {
+	if len(idxr.index.Dictionary) == 0 && idxr.index.TotalDocsCount == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(idxr.spillDir, 0777); err != nil {
+		return err
+	}
+	file, err := ioutil.TempFile(idxr.spillDir, "segment")
+	if err != nil {
+		return err
+	}
+	file.Close()
+
+	if err := writeSegment(file.Name(), idxr.index); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	idxr.segments = append(idxr.segments, file.Name())
+	idxr.index = NewIndex()
+	idxr.ramBytes = 0
+	return nil
+}
+
+// 書き出したセグメントファイルを削除し、メモリ上のインデクスを空にする
+func (idxr *Indexer) reset() error {
+	var err error
+	for _, segment := range idxr.segments {
+		if e := os.Remove(segment); e != nil && err == nil {
+			err = e
+		}
+	}
+	idxr.segments = nil
+	idxr.added = bitset{}
+	idxr.deleted = nil
+	idxr.stored = nil
+	idxr.titles = nil
+	idxr.index = NewIndex()
+	idxr.ramBytes = 0
+	return err
+}
+
+// otherのメモリ上のインデクスとセグメントを引き継ぐ
+func (idxr *Indexer) merge(other *Indexer) {
+	idxr.index.merge(other.index)
+	idxr.ramBytes += other.ramBytes
+	idxr.segments = append(idxr.segments, other.segments...)
+	idxr.added = *idxr.added.or(&other.added)
+	for docID := range other.deleted {
+		idxr.delete(docID)
+	}
+	for docID, fields := range other.stored {
+		idxr.store(docID, fields)
+	}
+	for docID, title := range other.titles {
+		idxr.setTitle(docID, title)
+	}
 }
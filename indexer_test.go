@@ -1,6 +1,10 @@
 package ssego
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -56,3 +60,122 @@ func TestUpdate(t *testing.T) {
 		t.Errorf("wrong index. \n\nwant: \n%v\n\n got:\n%v\n", expected, actual)
 	}
 }
+
+// テスト用コーパスと生成したドキュメントからインデクスを構築する
+func BenchmarkIndexerUpdate(b *testing.B) {
+	files, err := filepath.Glob("testdata/document/*.txt")
+	if err != nil {
+		b.Fatal(err)
+	}
+	var docs []string
+	for _, file := range files {
+		bytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			b.Fatal(err)
+		}
+		docs = append(docs, string(bytes))
+	}
+	docs = append(docs, generateDocs(10000)...)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		indexer := NewIndexer(NewTokenizer())
+		for id, doc := range docs {
+			indexer.update(DocumentID(id+1), strings.NewReader(doc))
+		}
+	}
+}
+
+func TestIndexMerge(t *testing.T) {
+	collection := generateDocs(300)
+
+	// 1つのIndexerで順番に追加したインデクス
+	expected := NewIndexer(NewTokenizer())
+	for i, doc := range collection {
+		expected.update(DocumentID(i+1), strings.NewReader(doc))
+	}
+
+	// 3つのセグメントにDocIDが交互になるように追加してマージしたインデクス
+	segments := []*Indexer{
+		NewIndexer(NewTokenizer()),
+		NewIndexer(NewTokenizer()),
+		NewIndexer(NewTokenizer()),
+	}
+	for i, doc := range collection {
+		segments[(i/7)%len(segments)].update(DocumentID(i+1), strings.NewReader(doc))
+	}
+	actual := NewIndex()
+	for _, segment := range segments {
+		actual.merge(segment.index)
+	}
+
+	if !reflect.DeepEqual(actual, expected.index) {
+		t.Errorf("wrong index. \n\nwant: \n%v\n\n got:\n%v\n", expected.index, actual)
+	}
+}
+
+func TestIndexerSpill(t *testing.T) {
+	collection := generateDocs(500)
+	tmp, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	expectedDir := filepath.Join(tmp, "expected")
+	actualDir := filepath.Join(tmp, "actual")
+	for _, dir := range []string{expectedDir, actualDir} {
+		if err := os.Mkdir(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// メモリの上限なしで作成したインデクス
+	expected := NewIndexer(NewTokenizer())
+	for i, doc := range collection {
+		expected.update(DocumentID(i+1), strings.NewReader(doc))
+	}
+	if err := NewIndexWriter(expectedDir).Flush(expected.index); err != nil {
+		t.Fatal(err)
+	}
+
+	// 上限を小さくしてセグメントを書き出しながら作成したインデクス
+	indexer := NewIndexer(NewTokenizer())
+	indexer.setRAMBudget(4096, filepath.Join(tmp, "_segments"))
+	for i, doc := range collection {
+		indexer.update(DocumentID(i+1), strings.NewReader(doc))
+		if err := indexer.maybeSpill(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(indexer.segments) < 2 {
+		t.Fatalf("expected several segments, got %d", len(indexer.segments))
+	}
+	if err := NewIndexWriter(actualDir).FlushSegments(indexer.index, indexer.segments); err != nil {
+		t.Fatal(err)
+	}
+	if err := indexer.reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedDir = generationDir(expectedDir, 1)
+	actualDir = generationDir(actualDir, 1)
+	files, err := ioutil.ReadDir(expectedDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		want, _ := ioutil.ReadFile(filepath.Join(expectedDir, file.Name()))
+		got, err := ioutil.ReadFile(filepath.Join(actualDir, file.Name()))
+		if err != nil {
+			t.Fatalf("failed to load index: %v", err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: got: %s\nwant: %s\n", file.Name(), got, want)
+		}
+	}
+
+	if segments, _ := ioutil.ReadDir(filepath.Join(tmp, "_segments")); len(segments) != 0 {
+		t.Errorf("segments are not removed: %v", segments)
+	}
+}
@@ -7,6 +7,7 @@ CREATE TABLE IF NOT EXISTS documents (
   document_id    INT UNSIGNED AUTO_INCREMENT NOT NULL,
   document_title TEXT                        NOT NULL,
   document_terms INT                         NOT NULL,
+  document_body  MEDIUMTEXT                  NOT NULL,
   updated_at     DATETIME default current_timestamp on update current_timestamp,
   created_at     DATETIME default current_timestamp
 ) ENGINE=InnoDB DEFAULT CHARSET utf8mb4 COLLATE utf8mb4_bin;
@@ -0,0 +1,260 @@
+package ssego
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// nrtReaderはコミット済みの世代に、まだFlushされていないドキュメントを重ねて読み込む
+// Engineはrefresh間隔ごとにIndexerのスナップショットを取り直すので、
+// AddDocumentしたドキュメントはFlushを待たずに検索できるようになる
+//
+// スナップショットは作成後に変更されないので、nrtReaderは複数のgoroutineから同時に使用できる
+type nrtReader struct {
+	disk     *IndexReader        // コミット済みの世代
+	segments []*segmentTerms     // Indexerが書き出したセグメント
+	memory   *Index              // メモリ上のインデクスのスナップショット
+	deleted  map[DocumentID]bool // Flushされていない削除済みのドキュメント
+	stored   storedFields        // Flushされていないドキュメントの保存したフィールドの値
+	titles   documentTitles      // Flushされていないドキュメントのタイトル
+	docCount int                 // Flushされていないドキュメント数
+	removed  int                 // deletedのうち、コミット済みかFlushされていないドキュメントの数
+
+	mu      sync.Mutex             // termsとfiltersを保護する
+	terms   map[string]*cachedTerm // マージしたポスティングリスト
+	filters map[string]*bitset     // フィルタの条件ごとのマッチするドキュメントの集合
+}
+
+func newNRTReader(disk *IndexReader, segments []*segmentTerms, indexer *Indexer) *nrtReader {
+	r := &nrtReader{
+		disk:     disk,
+		segments: segments,
+		memory:   indexer.index.snapshot(),
+		deleted:  make(map[DocumentID]bool, len(indexer.deleted)),
+		stored:   make(storedFields, len(indexer.stored)),
+		titles:   make(documentTitles, len(indexer.titles)),
+		terms:    make(map[string]*cachedTerm),
+		filters:  make(map[string]*bitset),
+	}
+	for docID := range indexer.deleted {
+		r.deleted[docID] = true
+		if indexer.added.contains(docID) || disk.containsDoc(docID) {
+			r.removed++
+		}
+	}
+	// フィールドの値は追加後に変更されないので、mapのみ複製する
+	for docID, fields := range indexer.stored {
+		r.stored[docID] = fields
+	}
+	for docID, title := range indexer.titles {
+		r.titles[docID] = title
+	}
+	r.docCount = r.memory.TotalDocsCount
+	for _, segment := range segments {
+		r.docCount += segment.docCount
+	}
+	return r
+}
+
+// コミット済みの世代、セグメント、メモリ上のインデクスのポスティングリストをDocIDの順にマージして返す
+func (r *nrtReader) term(term string) (*cachedTerm, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t, ok := r.terms[term]; ok {
+		return t, nil
+	}
+
+	t, err := r.disk.term(term)
+	if err != nil {
+		return nil, err
+	}
+	// Flushされていないドキュメントに含まれない用語は、IndexReaderのキャッシュをそのまま使う
+	if merged, ok := r.unflushedPostings(term); ok {
+		if t != nil {
+			merged = mergePostingsLists(*t.postings, merged)
+		}
+		t = newCachedTerm(&merged, NewBlockMaxes(merged))
+	}
+	r.terms[term] = t
+	return t, nil
+}
+
+// セグメントとメモリ上のインデクスのポスティングリストをDocIDの順にマージして返す
+func (r *nrtReader) unflushedPostings(term string) (PostingsList, bool) {
+	var lists []PostingsList
+	for _, segment := range r.segments {
+		if list, ok := segment.postings(term); ok {
+			lists = append(lists, list)
+		}
+	}
+	if list, ok := r.memory.Dictionary[term]; ok {
+		lists = append(lists, list)
+	}
+	if len(lists) == 0 {
+		return PostingsList{}, false
+	}
+	merged := lists[0]
+	for _, list := range lists[1:] {
+		merged = mergePostingsLists(merged, list)
+	}
+	return merged, true
+}
+
+// 条件にマッチするドキュメントの集合を返す
+// コミット済みの世代の集合はIndexReaderにキャッシュしてスナップショットを作り直しても使い回し、
+// Flushされていないドキュメントの集合のみを求めて加える
+func (r *nrtReader) filterDocs(key string, docs func(reader termReader) (*bitset, error)) (*bitset, error) {
+	r.mu.Lock()
+	b, ok := r.filters[key]
+	r.mu.Unlock()
+	if ok {
+		return b, nil
+	}
+
+	b, err := r.disk.filterDocs(key, docs)
+	if err != nil {
+		return nil, err
+	}
+	if r.docCount > 0 {
+		unflushed, err := docs(unflushedReader{r})
+		if err != nil {
+			return nil, err
+		}
+		b = b.or(unflushed)
+	}
+	r.mu.Lock()
+	r.filters[key] = b
+	r.mu.Unlock()
+	return b, nil
+}
+
+// unflushedReaderはFlushされていないドキュメントのみを読み込む
+type unflushedReader struct {
+	r *nrtReader
+}
+
+func (u unflushedReader) term(term string) (*cachedTerm, error) {
+	list, ok := u.r.unflushedPostings(term)
+	if !ok {
+		return nil, nil
+	}
+	return newCachedTerm(&list, NewBlockMaxes(list)), nil
+}
+
+func (u unflushedReader) totalDocCount() int {
+	return u.r.docCount
+}
+
+// 削除済みのドキュメントを除いたドキュメント数
+// IDFのNに使うので、Flushの前後で同じクエリのスコアが変わらないように、Flushで取り除かれるドキュメントを除く
+func (r *nrtReader) totalDocCount() int {
+	return r.disk.totalDocCount() + r.docCount - r.removed
+}
+
+// ドキュメントの保存したフィールドの値。保存されていなければnilを返す
+func (r *nrtReader) storedFields(docID DocumentID) map[string]string {
+	if fields, ok := r.stored[docID]; ok {
+		return fields
+	}
+	return r.disk.storedFields(docID)
+}
+
+// 世代とFlushされていないドキュメントに記録したタイトル。記録されていなければfalseを返す
+func (r *nrtReader) title(docID DocumentID) (string, bool) {
+	if title, ok := r.titles[docID]; ok {
+		return title, true
+	}
+	return r.disk.title(docID)
+}
+
+// 書き込みが続いても変わらないスナップショットを作成する
+// ポスティングリストへの追加は配列の末尾にのみ行われるので、各配列の長さを固定したものを共有する
+func (idx *Index) snapshot() *Index {
+	snapshot := &Index{
+		Dictionary:     make(map[string]PostingsList, len(idx.Dictionary)),
+		TotalDocsCount: idx.TotalDocsCount,
+	}
+	for term, list := range idx.Dictionary {
+		columns := *list.postingsColumns
+		columns.docIDs = columns.docIDs[:len(columns.docIDs):len(columns.docIDs)]
+		columns.termFreqs = columns.termFreqs[:len(columns.termFreqs):len(columns.termFreqs)]
+		columns.offsets = columns.offsets[:len(columns.offsets):len(columns.offsets)]
+		columns.positions = columns.positions[:len(columns.positions):len(columns.positions)]
+		snapshot.Dictionary[term] = PostingsList{&columns}
+	}
+	return snapshot
+}
+
+// セグメントファイル内の用語ごとの位置
+// セグメントは用語の昇順に並んでいるだけなので、検索で読み込めるように用語から行の位置を引けるようにする
+type segmentTerms struct {
+	filename string
+	docCount int
+	offsets  map[string]int64 // 用語の行の先頭のバイト位置
+}
+
+func openSegmentTerms(filename string) (*segmentTerms, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	s := &segmentTerms{filename: filename, offsets: make(map[string]int64)}
+	reader := bufio.NewReader(file)
+	line, err := reader.ReadString('\n')
+	if err == nil {
+		s.docCount, err = strconv.Atoi(strings.TrimSpace(line))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid segment %s: %v", filename, err)
+	}
+
+	offset := int64(len(line))
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if tab := strings.IndexByte(line, '\t'); tab >= 0 {
+			s.offsets[line[:tab]] = offset
+		}
+		offset += int64(len(line))
+	}
+	return s, nil
+}
+
+// 用語のポスティングリストを読み込む
+// 読み込みに失敗した場合は、IndexReaderと同様に用語が存在しないものとする
+func (s *segmentTerms) postings(term string) (PostingsList, bool) {
+	offset, ok := s.offsets[term]
+	if !ok {
+		return PostingsList{}, false
+	}
+	file, err := os.Open(s.filename)
+	if err != nil {
+		return PostingsList{}, false
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return PostingsList{}, false
+	}
+	line, err := bufio.NewReader(file).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return PostingsList{}, false
+	}
+	var list PostingsList
+	if err := json.Unmarshal([]byte(line[len(term)+1:]), &list); err != nil {
+		return PostingsList{}, false
+	}
+	return list, true
+}
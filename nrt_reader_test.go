@@ -0,0 +1,171 @@
+package ssego
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNRTReader(t *testing.T) {
+	collection := generateDocs(500)
+	tmp, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	// すべてのドキュメントをFlushしたインデクス
+	expectedDir := filepath.Join(tmp, "expected")
+	expected := NewIndexer(NewTokenizer())
+	for i, doc := range collection {
+		expected.update(DocumentID(i+1), strings.NewReader(doc))
+	}
+	if err := NewIndexWriter(expectedDir).Flush(expected.index); err != nil {
+		t.Fatal(err)
+	}
+
+	// 先頭の200件だけFlushし、残りはセグメントとメモリ上に置く
+	actualDir := filepath.Join(tmp, "actual")
+	flushed := NewIndexer(NewTokenizer())
+	for i, doc := range collection[:200] {
+		flushed.update(DocumentID(i+1), strings.NewReader(doc))
+	}
+	if err := NewIndexWriter(actualDir).Flush(flushed.index); err != nil {
+		t.Fatal(err)
+	}
+	indexer := NewIndexer(NewTokenizer())
+	indexer.setRAMBudget(4096, filepath.Join(tmp, "_segments"))
+	for i, doc := range collection[200:] {
+		indexer.update(DocumentID(i+201), strings.NewReader(doc))
+		if err := indexer.maybeSpill(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(indexer.segments) == 0 {
+		t.Fatal("expected spilled segments")
+	}
+
+	var segments []*segmentTerms
+	for _, filename := range indexer.segments {
+		s, err := openSegmentTerms(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		segments = append(segments, s)
+	}
+	reader := newNRTReader(NewIndexReader(actualDir), segments, indexer)
+
+	// スナップショットを作成した後に追加したドキュメントは見えない
+	indexer.update(501, strings.NewReader("rare rare rare"))
+
+	if got := reader.totalDocCount(); got != len(collection) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, len(collection))
+	}
+	queries := [][]string{{"rare"}, {"medium", "common"}, {"rare", "medium", "common", "other"}}
+	for _, query := range queries {
+		want := newSearcher(NewIndexReader(expectedDir), nil, "TFIDF").SearchTopK(query, 10)
+		got := newSearcher(reader, nil, "TFIDF").SearchTopK(query, 10)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%v: got:%v\nexpected:%v\n", query, got, want)
+		}
+		want = newSearcher(NewIndexReader(expectedDir), nil, "TFIDF").SearchTopKOr(query, 10, BlockMaxWAND)
+		got = newSearcher(reader, nil, "TFIDF").SearchTopKOr(query, 10, BlockMaxWAND)
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("%v: got:%v\nexpected:%v\n", query, got, want)
+		}
+	}
+}
+
+func TestNRTReaderDeleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	indexer := NewIndexer(NewTokenizer())
+	indexer.update(1, strings.NewReader("Do you quarrel, sir?"))
+	indexer.update(2, strings.NewReader("No better."))
+	indexer.update(3, strings.NewReader("Quarrel sir! no, sir!"))
+	writer := NewIndexWriter(dir)
+	if err := writer.flush(flushRequest{index: indexer.index, added: &indexer.added}); err != nil {
+		t.Fatal(err)
+	}
+
+	// コミット済みのドキュメントと、Flushされていない用語を持たないドキュメントを削除する
+	indexer = NewIndexer(NewTokenizer())
+	indexer.update(4, strings.NewReader("Well, sir"))
+	indexer.update(5, strings.NewReader(""))
+	indexer.delete(2)
+	indexer.delete(5)
+	reader := newNRTReader(NewIndexReader(dir), nil, indexer)
+	if got := reader.totalDocCount(); got != 3 {
+		t.Fatalf("got:%v\nexpected:%v\n", got, 3)
+	}
+	before := newSearcher(reader, nil, "TFIDF").SearchTopK([]string{"sir"}, 10)
+
+	// Flushしてもドキュメント数とスコアは変わらない
+	if err := writer.flush(flushRequest{index: indexer.index, added: &indexer.added, deleted: indexer.deleted}); err != nil {
+		t.Fatal(err)
+	}
+	flushed := NewIndexReader(dir)
+	if got := flushed.totalDocCount(); got != 3 {
+		t.Fatalf("got:%v\nexpected:%v\n", got, 3)
+	}
+	after := newSearcher(flushed, nil, "TFIDF").SearchTopK([]string{"sir"}, 10)
+	if !reflect.DeepEqual(before, after) {
+		t.Fatalf("got:%v\nexpected:%v\n", before, after)
+	}
+}
+
+func TestIndexSnapshot(t *testing.T) {
+	indexer := NewIndexer(NewTokenizer())
+	indexer.update(1, strings.NewReader("Do you quarrel, sir?"))
+	snapshot := indexer.index.snapshot()
+	indexer.update(2, strings.NewReader("Quarrel sir! no, sir!"))
+
+	expected := NewPostingsList(NewPosting(1, 3))
+	if got := snapshot.Dictionary["sir"]; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+	if _, ok := snapshot.Dictionary["no"]; ok {
+		t.Fatal("snapshot contains a term added later")
+	}
+	if snapshot.TotalDocsCount != 1 {
+		t.Fatalf("got:%v\nexpected:%v\n", snapshot.TotalDocsCount, 1)
+	}
+}
+
+func TestNRTReaderTermStats(t *testing.T) {
+	dir := writeTestIndex(t, []string{"Do you quarrel, sir?", "No better."})
+	defer os.RemoveAll(dir)
+
+	indexer := NewIndexer(NewTokenizer())
+	indexer.update(3, strings.NewReader("Quarrel sir! no, sir!"))
+	indexer.update(4, strings.NewReader("Well, quiet sir"))
+
+	expected := []TermStats{{"quarrel", 2, 2}, {"quiet", 1, 1}}
+	reader := newNRTReader(NewIndexReader(dir), nil, indexer)
+	if got := reader.termStats("qu"); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+	if got := reader.termStats("x"); len(got) != 0 {
+		t.Fatalf("got:%v\nexpected:[]\n", got)
+	}
+	// 用語の統計情報を読むので、ポスティングリストはキャッシュされない
+	if _, ok := reader.disk.termCache.get("quarrel"); ok {
+		t.Fatal("postings list is loaded")
+	}
+
+	// _termsのない以前の世代ではポスティングリストから求める
+	if err := os.Remove(filepath.Join(committedDir(dir), termDictFileName)); err != nil {
+		t.Fatal(err)
+	}
+	reader = newNRTReader(NewIndexReader(dir), nil, indexer)
+	if got := reader.termStats("qu"); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+}
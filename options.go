@@ -0,0 +1,198 @@
+package ssego
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// 検索エンジンの設定
+// 値はデフォルト値、設定ファイル、環境変数、コマンドラインのフラグの順に上書きする
+//
+//	index_dir: _index_data
+//	store:
+//	  backend: mysql
+//	  dsn: root@tcp(127.0.0.1:3306)/ssego
+//	analyzer: standard
+//	scorer: TFIDF
+//	cache:
+//	  postings_bytes: 67108864
+//	  ram_buffer_bytes: 268435456
+//	refresh_interval: 1s
+//	schema:
+//	  fields:
+//	    - {name: body, type: text, analyzer: standard, indexed: true}
+//	    - {name: author, type: keyword, indexed: true, stored: true}
+type Options struct {
+	IndexDir        string        `yaml:"index_dir" toml:"index_dir"`               // インデクスファイルを保存するディレクトリ
+	Store           StoreOptions  `yaml:"store" toml:"store"`                       // ドキュメントの保存先
+	Analyzer        string        `yaml:"analyzer" toml:"analyzer"`                 // ドキュメントとクエリを用語に分割する方法
+	Scorer          string        `yaml:"scorer" toml:"scorer"`                     // スコアの計算方法が指定されなかったときに使う計算方法
+	Cache           CacheOptions  `yaml:"cache" toml:"cache"`                       // キャッシュとバッファの大きさ
+	RefreshInterval time.Duration `yaml:"refresh_interval" toml:"refresh_interval"` // 追加したドキュメントが検索できるようになるまでの間隔
+	Schema          *Schema       `yaml:"schema" toml:"schema"`                     // 新しいインデクスのスキーマ。既存のインデクスでは保存されたスキーマと一致する必要がある
+}
+
+type StoreOptions struct {
+	Backend string `yaml:"backend" toml:"backend"` // database/sqlのドライバ名
+	DSN     string `yaml:"dsn" toml:"dsn"`
+}
+
+type CacheOptions struct {
+	PostingsBytes  int64 `yaml:"postings_bytes" toml:"postings_bytes"`     // 読み込んだポスティングリストのキャッシュの上限(バイト)
+	RAMBufferBytes int64 `yaml:"ram_buffer_bytes" toml:"ram_buffer_bytes"` // メモリ上のインデクスの上限(バイト)
+}
+
+// 設定できるドキュメントの保存先とアナライザ
+var (
+	storeBackends = []string{"mysql"}
+	analyzers     = []string{"standard"}
+)
+
+// デフォルトの設定
+// インデクスディレクトリはカレントディレクトリの_index_data
+func DefaultOptions() Options {
+	current, _ := os.Getwd()
+	return Options{
+		IndexDir: filepath.Join(current, "_index_data"),
+		Store: StoreOptions{
+			Backend: "mysql",
+			DSN:     "root@tcp(127.0.0.1:3306)/ssego",
+		},
+		Analyzer: "standard",
+		Scorer:   "TFIDF",
+		Cache: CacheOptions{
+			PostingsBytes:  defaultPostingsCacheBytes,
+			RAMBufferBytes: defaultRAMBufferBytes,
+		},
+		RefreshInterval: defaultRefreshInterval,
+	}
+}
+
+// デフォルトの設定を設定ファイルで上書きする
+// 拡張子が.tomlならTOML、.yamlか.ymlならYAMLとして読み込む。書かれていない項目はデフォルト値のまま
+func LoadOptions(path string) (Options, error) {
+	options := DefaultOptions()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return options, err
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		metadata, err := toml.Decode(string(data), &options)
+		if err != nil {
+			return options, fmt.Errorf("%s: %v", path, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return options, fmt.Errorf("%s: unknown field %q", path, undecoded[0].String())
+		}
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&options); err != nil {
+			return options, fmt.Errorf("%s: %v", path, err)
+		}
+	default:
+		return options, fmt.Errorf("%s: unknown config format %q; use .yaml, .yml or .toml", path, ext)
+	}
+	return options, nil
+}
+
+// 環境変数で設定を上書きする
+//
+//	SSEGO_INDEX_DIR (INDEX_DIR_PATHも使える)
+//	SSEGO_STORE_BACKEND, SSEGO_STORE_DSN
+//	SSEGO_ANALYZER, SSEGO_SCORER
+//	SSEGO_POSTINGS_CACHE_BYTES, SSEGO_RAM_BUFFER_BYTES
+//	SSEGO_REFRESH_INTERVAL
+func (o *Options) LoadEnv() error {
+	return o.loadEnv(os.LookupEnv)
+}
+
+func (o *Options) loadEnv(lookup func(key string) (string, bool)) error {
+	if value, ok := lookup("INDEX_DIR_PATH"); ok {
+		o.IndexDir = value
+	}
+	stringFields := map[string]*string{
+		"SSEGO_INDEX_DIR":     &o.IndexDir,
+		"SSEGO_STORE_BACKEND": &o.Store.Backend,
+		"SSEGO_STORE_DSN":     &o.Store.DSN,
+		"SSEGO_ANALYZER":      &o.Analyzer,
+		"SSEGO_SCORER":        &o.Scorer,
+	}
+	for key, field := range stringFields {
+		if value, ok := lookup(key); ok {
+			*field = value
+		}
+	}
+	intFields := map[string]*int64{
+		"SSEGO_POSTINGS_CACHE_BYTES": &o.Cache.PostingsBytes,
+		"SSEGO_RAM_BUFFER_BYTES":     &o.Cache.RAMBufferBytes,
+	}
+	for key, field := range intFields {
+		if value, ok := lookup(key); ok {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("%s: %q is not an integer", key, value)
+			}
+			*field = n
+		}
+	}
+	if value, ok := lookup("SSEGO_REFRESH_INTERVAL"); ok {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("SSEGO_REFRESH_INTERVAL: %v", err)
+		}
+		o.RefreshInterval = interval
+	}
+	return nil
+}
+
+// 設定の値を検証する
+func (o *Options) Validate() error {
+	if o.IndexDir == "" {
+		return fmt.Errorf("index dir is required")
+	}
+	if !contains(storeBackends, o.Store.Backend) {
+		return fmt.Errorf("unknown store backend %q; use %s", o.Store.Backend, strings.Join(storeBackends, " or "))
+	}
+	if o.Store.DSN == "" {
+		return fmt.Errorf("store dsn is required")
+	}
+	if !contains(analyzers, o.Analyzer) {
+		return fmt.Errorf("unknown analyzer %q; use %s", o.Analyzer, strings.Join(analyzers, " or "))
+	}
+	if o.Scorer != "TFIDF" && o.Scorer != "BM25" {
+		return fmt.Errorf("unknown scorer %q; use TFIDF or BM25", o.Scorer)
+	}
+	if o.Cache.PostingsBytes <= 0 {
+		return fmt.Errorf("postings cache size must be positive")
+	}
+	if o.Cache.RAMBufferBytes <= 0 {
+		return fmt.Errorf("ram buffer size must be positive")
+	}
+	if o.RefreshInterval < 0 {
+		return fmt.Errorf("refresh interval must not be negative")
+	}
+	if o.Schema != nil {
+		return o.Schema.Validate()
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,125 @@
+package ssego
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLoadOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configs := map[string]string{
+		"ssego.yaml": `
+index_dir: /var/lib/ssego
+store:
+  dsn: ssego@tcp(db:3306)/ssego
+scorer: BM25
+cache:
+  postings_bytes: 1024
+refresh_interval: 5s
+`,
+		"ssego.toml": `
+index_dir = "/var/lib/ssego"
+scorer = "BM25"
+refresh_interval = "5s"
+
+[store]
+dsn = "ssego@tcp(db:3306)/ssego"
+
+[cache]
+postings_bytes = 1024
+`,
+	}
+	expected := DefaultOptions()
+	expected.IndexDir = "/var/lib/ssego"
+	expected.Store.DSN = "ssego@tcp(db:3306)/ssego"
+	expected.Scorer = "BM25"
+	expected.Cache.PostingsBytes = 1024
+	expected.RefreshInterval = 5 * time.Second
+
+	for name, config := range configs {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(config), 0666); err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadOptions(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("%s: got:%+v\nexpected:%+v\n", name, got, expected)
+		}
+	}
+
+	// 知らない項目はエラーにする
+	for name, config := range map[string]string{"typo.yaml": "scorrer: BM25\n", "typo.toml": "scorrer = \"BM25\"\n"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(config), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadOptions(path); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOptionsLoadEnv(t *testing.T) {
+	env := map[string]string{
+		"INDEX_DIR_PATH":         "/tmp/legacy",
+		"SSEGO_INDEX_DIR":        "/tmp/index",
+		"SSEGO_SCORER":           "BM25",
+		"SSEGO_RAM_BUFFER_BYTES": "4096",
+	}
+	options := DefaultOptions()
+	err := options.loadEnv(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := DefaultOptions()
+	expected.IndexDir = "/tmp/index"
+	expected.Scorer = "BM25"
+	expected.Cache.RAMBufferBytes = 4096
+	if !reflect.DeepEqual(options, expected) {
+		t.Fatalf("got:%+v\nexpected:%+v\n", options, expected)
+	}
+
+	env["SSEGO_RAM_BUFFER_BYTES"] = "4KB"
+	if err := options.loadEnv(func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	options := DefaultOptions()
+	if err := options.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []func(o *Options){
+		func(o *Options) { o.IndexDir = "" },
+		func(o *Options) { o.Store.Backend = "sqlite" },
+		func(o *Options) { o.Analyzer = "kuromoji" },
+		func(o *Options) { o.Scorer = "PageRank" },
+		func(o *Options) { o.Cache.PostingsBytes = 0 },
+	}
+	for i, modify := range invalid {
+		o := DefaultOptions()
+		modify(&o)
+		if err := o.Validate(); err == nil {
+			t.Fatalf("%d: expected an error", i)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package ssego
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DocumentStoreにまとめて保存するドキュメント数のデフォルト値
+const defaultBatchSize = 100
+
+// Closeされていないパイプラインがあるため、Flushできない
+var ErrPipelineOpen = errors.New("an indexing pipeline is open; close it before flushing")
+
+// IndexingPipelineは複数のgoroutineで並列にドキュメントをインデクスに追加する
+//   - 各ワーカーはドキュメントを読み込んで用語に分割し、自分専用のインデクス(セグメント)に追加する
+//   - DocumentStoreへの保存はbatchSize件ずつまとめて行う
+//   - ワーカーごとのインデクスがメモリの上限を超えたらディスクに書き出す
+//   - Closeですべてのセグメントをエンジンのインデクスにマージする
+//
+// 追加したドキュメントはセグメントに追加する前にWALに記録する
+// セグメント上のドキュメントはWALにしかないので、Closeするまでエンジンのflushはエラーになる
+type IndexingPipeline struct {
+	engine    *Engine
+	batchSize int
+	docs      chan pendingDocument
+	segments  []*Indexer // ワーカーごとのインデクス
+	wg        sync.WaitGroup
+	mu        sync.Mutex // errを保護する
+	err       error      // セグメントの書き出しで最初に発生したエラー
+
+	// OnDocumentはドキュメントの追加が完了または失敗するたびに呼ばれる
+	// Addを呼ぶ前に設定する。複数のワーカーから同時に呼ばれることがある
+	OnDocument func(title string, err error)
+}
+
+// 追加待ちのドキュメント
+type pendingDocument struct {
+	title string
+	open  func() (io.ReadCloser, error)
+}
+
+// 用語に分割済みのドキュメント
+type tokenizedDocument struct {
+	title string
+	body  string
+	terms []string
+}
+
+func NewIndexingPipeline(engine *Engine, workers int) *IndexingPipeline {
+	return newIndexingPipeline(engine, workers, defaultBatchSize)
+}
+
+// batchSize件ずつDocumentStoreに保存するパイプラインを作成する
+func newIndexingPipeline(engine *Engine, workers, batchSize int) *IndexingPipeline {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &IndexingPipeline{
+		engine:    engine,
+		batchSize: batchSize,
+		docs:      make(chan pendingDocument, workers),
+		segments:  make([]*Indexer, workers),
+	}
+	// メモリの上限はワーカーで均等に分ける
+	engine.mu.Lock()
+	ramBudget := engine.indexer.ramBudget / int64(workers)
+	spillDir := engine.indexer.spillDir
+	engine.pipelines++
+	engine.mu.Unlock()
+
+	for i := range p.segments {
+		p.segments[i] = NewIndexer(engine.tokenizer)
+		p.segments[i].setRAMBudget(ramBudget, spillDir)
+		p.wg.Add(1)
+		go p.work(p.segments[i])
+	}
+	return p
+}
+
+// ドキュメントを追加する
+// openはワーカーがドキュメントを読み込むときに呼ばれ、読み込み後にCloseされる
+func (p *IndexingPipeline) Add(title string, open func() (io.ReadCloser, error)) {
+	p.docs <- pendingDocument{title, open}
+}
+
+// 追加したすべてのドキュメントの処理を待ち、各ワーカーのインデクスをエンジンのインデクスにマージする
+func (p *IndexingPipeline) Close() error {
+	close(p.docs)
+	p.wg.Wait()
+
+	p.engine.mu.Lock()
+	defer p.engine.mu.Unlock()
+	for _, segment := range p.segments {
+		p.engine.indexer.merge(segment)
+	}
+	p.engine.pipelines--
+	if p.err != nil {
+		return p.err
+	}
+	return p.engine.indexer.maybeSpill()
+}
+
+func (p *IndexingPipeline) work(segment *Indexer) {
+	defer p.wg.Done()
+
+	batch := make([]tokenizedDocument, 0, p.batchSize)
+	for doc := range p.docs {
+		body, terms, err := p.tokenize(doc)
+		if err != nil {
+			p.done(doc.title, err)
+			continue
+		}
+		batch = append(batch, tokenizedDocument{doc.title, body, terms})
+		if len(batch) == p.batchSize {
+			p.index(segment, batch)
+			batch = batch[:0]
+		}
+	}
+	p.index(segment, batch)
+}
+
+// ドキュメントを読み込んで、本文と用語の列を返す
+func (p *IndexingPipeline) tokenize(doc pendingDocument) (string, []string, error) {
+	reader, err := doc.open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer reader.Close()
+	var body strings.Builder
+	terms, err := p.engine.tokenizer.ReaderToWordSequence(io.TeeReader(reader, &body))
+	return body.String(), terms, err
+}
+
+// ドキュメントをまとめてDocumentStoreに保存し、発行されたIDでセグメントに追加する
+// 1つのワーカーが保存するバッチのIDは単調に増加するので、セグメントのポスティングリストはDocIDの昇順になる
+// WALに記録できなければ、インデクスに含まれないドキュメントが残らないように保存を取り消す
+func (p *IndexingPipeline) index(segment *Indexer, batch []tokenizedDocument) {
+	if len(batch) == 0 {
+		return
+	}
+
+	first := p.engine.allocateDocIDs(len(batch))
+	records := make([]documentRecord, len(batch))
+	for i, doc := range batch {
+		records[i] = documentRecord{first + DocumentID(i), doc.title, doc.body, len(doc.terms)}
+	}
+	if err := p.engine.documentStore.saveBatch(records); err != nil {
+		for _, doc := range batch {
+			p.done(doc.title, err)
+		}
+		return
+	}
+
+	walRecords := make([]walRecord, len(batch))
+	for i, doc := range batch {
+		walRecords[i] = walRecord{Op: walAdd, DocID: records[i].docID, Title: doc.title, Terms: doc.terms}
+	}
+	if err := p.engine.wal.append(walRecords...); err != nil {
+		docIDs := make([]DocumentID, len(records))
+		for i, record := range records {
+			docIDs[i] = record.docID
+		}
+		p.engine.documentStore.deleteBatch(docIDs)
+		for _, doc := range batch {
+			p.done(doc.title, err)
+		}
+		return
+	}
+
+	for i, doc := range batch {
+		segment.updateTerms(records[i].docID, doc.terms)
+		segment.setTitle(records[i].docID, doc.title)
+		p.done(doc.title, nil)
+	}
+
+	if err := segment.maybeSpill(); err != nil {
+		// 書き出しに失敗してもインデクスはメモリ上に残っているので、処理は続ける
+		p.mu.Lock()
+		if p.err == nil {
+			p.err = err
+		}
+		p.mu.Unlock()
+	}
+}
+
+func (p *IndexingPipeline) done(title string, err error) {
+	if p.OnDocument != nil {
+		p.OnDocument(title, err)
+	}
+}
@@ -0,0 +1,233 @@
+package ssego
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// データベースを使わずにドキュメントをメモリに保存するdocumentStorage
+type memoryStore struct {
+	mu           sync.Mutex
+	docs         map[DocumentID]documentRecord
+	saveErr      error // nilでなければsaveとsaveBatchはこのエラーを返す
+	titleFetches int   // fetchTitleでタイトルを読み込んだ回数
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{docs: make(map[DocumentID]documentRecord)}
+}
+
+func (s *memoryStore) save(docID DocumentID, title, body string, termCount int) error {
+	return s.saveBatch([]documentRecord{{docID, title, body, termCount}})
+}
+
+func (s *memoryStore) saveBatch(docs []documentRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	for _, doc := range docs {
+		s.docs[doc.docID] = doc
+	}
+	return nil
+}
+
+func (s *memoryStore) deleteBatch(docIDs []DocumentID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, docID := range docIDs {
+		delete(s.docs, docID)
+	}
+	return nil
+}
+
+func (s *memoryStore) maxDocID() (DocumentID, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var max DocumentID
+	for docID := range s.docs {
+		if docID > max {
+			max = docID
+		}
+	}
+	return max, nil
+}
+
+func (s *memoryStore) fetchTermCounts() (map[DocumentID]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	termCounts := make(map[DocumentID]int, len(s.docs))
+	for docID, doc := range s.docs {
+		termCounts[docID] = doc.termCount
+	}
+	return termCounts, nil
+}
+
+func (s *memoryStore) delete(docID DocumentID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.docs[docID]; !ok {
+		return ErrDocumentNotFound
+	}
+	delete(s.docs, docID)
+	return nil
+}
+
+func (s *memoryStore) fetch(docID DocumentID) (documentRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.docs[docID]
+	if !ok {
+		return doc, ErrDocumentNotFound
+	}
+	return doc, nil
+}
+
+func (s *memoryStore) fetchTitle(docID DocumentID) (string, error) {
+	doc, err := s.fetch(docID)
+	s.mu.Lock()
+	s.titleFetches++
+	s.mu.Unlock()
+	return doc.title, err
+}
+
+func (s *memoryStore) fetchTitles() (documentTitles, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	titles := make(documentTitles, len(s.docs))
+	for docID, doc := range s.docs {
+		titles[docID] = doc.title
+	}
+	return titles, nil
+}
+
+func (s *memoryStore) fetchBody(docID DocumentID) (string, error) {
+	doc, err := s.fetch(docID)
+	return doc.body, err
+}
+
+func (s *memoryStore) fetchTermCount(docID DocumentID) (int, error) {
+	doc, err := s.fetch(docID)
+	return doc.termCount, err
+}
+
+// 一時ディレクトリにインデクスを作成し、storeにドキュメントを保存するエンジンを返す
+func newTestEngine(t *testing.T, store documentStorage) *Engine {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	options := DefaultOptions()
+	options.IndexDir = dir
+	options.RefreshInterval = 0
+	e, err := newEngine(options, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// パイプラインでn件のドキュメントを追加し、失敗したドキュメント数を返す
+func runPipeline(t *testing.T, e *Engine, n int) int {
+	p := newIndexingPipeline(e, 4, 3)
+	var mu sync.Mutex
+	var failed int
+	p.OnDocument = func(title string, err error) {
+		if err != nil {
+			mu.Lock()
+			failed++
+			mu.Unlock()
+		}
+	}
+	for i := 0; i < n; i++ {
+		body := fmt.Sprintf("quarrel sir %d", i)
+		p.Add(fmt.Sprintf("doc%d", i), func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(strings.NewReader(body)), nil
+		})
+	}
+
+	// セグメントのドキュメントはWALにしかないので、Closeするまでコミットできない
+	if err := e.Flush(); !errors.Is(err, ErrPipelineOpen) {
+		t.Fatalf("got: %v\nwant: %v\n", err, ErrPipelineOpen)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return failed
+}
+
+func TestIndexingPipeline(t *testing.T) {
+	store := newMemoryStore()
+	e := newTestEngine(t, store)
+	defer e.Close()
+	// 毎回セグメントを書き出して、Flushでマージする
+	e.SetRAMBufferSize(1)
+
+	if failed := runPipeline(t, e, 50); failed != 0 {
+		t.Fatalf("%d documents failed", failed)
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := e.SearchWith(SearchRequest{Query: "quarrel", K: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalHits != 50 || len(store.docs) != 50 {
+		t.Fatalf("got: %d hits, %d stored\nwant: 50 hits, 50 stored", res.TotalHits, len(store.docs))
+	}
+	// 発行したIDで保存したドキュメントとインデクスの用語が対応する
+	for _, result := range res.Results {
+		doc := store.docs[result.DocID]
+		number := strings.TrimPrefix(doc.title, "doc")
+		hits, err := e.SearchWith(SearchRequest{Query: number, K: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(hits.Results) != 1 || hits.Results[0].DocID != result.DocID || doc.body != "quarrel sir "+number {
+			t.Fatalf("%s: got: %v, %q", doc.title, hits.Results, doc.body)
+		}
+	}
+}
+
+func TestIndexingPipelineErrors(t *testing.T) {
+	store := newMemoryStore()
+	e := newTestEngine(t, store)
+	defer e.Close()
+
+	// 保存に失敗したドキュメントはWALにもインデクスにも追加しない
+	store.saveErr = errors.New("store is unavailable")
+	if failed := runPipeline(t, e, 10); failed != 10 {
+		t.Fatalf("got: %d failed\nwant: 10 failed", failed)
+	}
+	if seq := e.wal.lastSeq(); seq != 0 {
+		t.Fatalf("got: WAL seq %d\nwant: 0", seq)
+	}
+
+	// WALに記録できなければ保存を取り消す
+	store.saveErr = nil
+	e.wal.file.Close()
+	if failed := runPipeline(t, e, 10); failed != 10 {
+		t.Fatalf("got: %d failed\nwant: 10 failed", failed)
+	}
+	if len(store.docs) != 0 {
+		t.Fatalf("got: %d stored\nwant: 0 stored", len(store.docs))
+	}
+
+	res, err := e.SearchWith(SearchRequest{Query: "quarrel", K: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalHits != 0 {
+		t.Fatalf("got: %d hits\nwant: 0 hits", res.TotalHits)
+	}
+}
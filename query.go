@@ -0,0 +1,260 @@
+package ssego
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// クエリの構文や値がスキーマに合わない
+var ErrInvalidQuery = errors.New("invalid query")
+
+// 解析したクエリ
+type parsedQuery struct {
+	terms  []string      // スコアを計算する用語
+	boosts []float64     // termsと同じ順の、用語のスコアに掛ける重み
+	ranges []*rangeQuery // マッチするドキュメントが満たす範囲
+}
+
+// 語の末尾の「^重み」
+var boostPattern = regexp.MustCompile(`\^([^^()"]*)$`)
+
+// クエリを検索する用語と範囲に分割する
+//   - 「フィールド名:値」の語はそのフィールドの用語とする。値に空白を含める場合は「author:"William Shakespeare"」のように""で囲む
+//   - 数値と日付のフィールドは「year:[1590 TO 1600]」「modified:>2026-01-01」のように範囲を指定できる。範囲はスコアに影響しない
+//   - それ以外の語は本文(DefaultField)の用語とする
+//   - 「quarrel^3」のように語の末尾に^と数値をつけると、その用語のスコアに重みを掛ける。「(quarrel sir)^2」は括弧内のすべての用語に掛ける
+//
+// スキーマにないフィールド名は本文の一部として扱う。フィールドの用語にはスキーマのBoostも掛ける
+func (e *Engine) parseQuery(query string) (*parsedQuery, error) {
+	return e.parseRequest(SearchRequest{Query: query})
+}
+
+// SearchRequestのクエリと重みをつけた節を1つのクエリとして解析する
+func (e *Engine) parseRequest(req SearchRequest) (*parsedQuery, error) {
+	for name, boost := range req.FieldBoosts {
+		if _, ok := e.schema.Field(name); !ok {
+			return nil, fmt.Errorf("%w: cannot boost unknown field %s", ErrInvalidQuery, name)
+		}
+		if err := checkBoost(boost); err != nil {
+			return nil, err
+		}
+	}
+	p := &queryParser{engine: e, fieldBoosts: req.FieldBoosts, parsed: &parsedQuery{}}
+	if err := p.parse(req.Query, 1); err != nil {
+		return nil, err
+	}
+	for _, clause := range req.Clauses {
+		if err := checkBoost(clause.Boost); err != nil {
+			return nil, err
+		}
+		if err := p.parse(clause.Query, clause.boost()); err != nil {
+			return nil, err
+		}
+	}
+	return p.parsed, nil
+}
+
+// 重みは0以上の有限の数とする
+func checkBoost(boost float64) error {
+	if boost < 0 || math.IsNaN(boost) || math.IsInf(boost, 0) {
+		return fmt.Errorf("%w: boost must be a non-negative number, got %v", ErrInvalidQuery, boost)
+	}
+	return nil
+}
+
+// クエリを読み込んでparsedに用語と範囲を加える
+type queryParser struct {
+	engine      *Engine
+	fieldBoosts map[string]float64 // クエリ時にフィールドの用語に掛ける重み
+	parsed      *parsedQuery
+}
+
+// boostはクエリのすべての用語に掛ける重み
+// 対応しない括弧は無視する
+func (p *queryParser) parse(query string, boost float64) error {
+	words, err := splitQuery(query)
+	if err != nil {
+		return err
+	}
+	var groups []int // 開いている括弧の、最初の用語の位置
+	for _, word := range words {
+		for strings.HasPrefix(word, "(") {
+			groups = append(groups, len(p.parsed.terms))
+			word = word[1:]
+		}
+		// 閉じ括弧とその重みを外側から取り出す
+		var closing []float64
+		for {
+			if strings.HasSuffix(word, ")") {
+				closing = append(closing, 1)
+				word = word[:len(word)-1]
+				continue
+			}
+			m := boostPattern.FindStringSubmatchIndex(word)
+			if m == nil || m[0] == 0 || word[m[0]-1] != ')' {
+				break
+			}
+			b, err := parseBoost(word[m[2]:m[3]])
+			if err != nil {
+				return err
+			}
+			closing = append(closing, b)
+			word = word[:m[0]-1]
+		}
+		if word != "" {
+			if err := p.word(word, boost); err != nil {
+				return err
+			}
+		}
+		// 内側の括弧から閉じる
+		for i := len(closing) - 1; i >= 0; i-- {
+			if len(groups) == 0 {
+				continue
+			}
+			start := groups[len(groups)-1]
+			groups = groups[:len(groups)-1]
+			for j := start; j < len(p.parsed.boosts); j++ {
+				p.parsed.boosts[j] *= closing[i]
+			}
+		}
+	}
+	return nil
+}
+
+// 1つの語を読み込む
+func (p *queryParser) word(word string, boost float64) error {
+	if m := boostPattern.FindStringSubmatchIndex(word); m != nil && m[0] > 0 {
+		b, err := parseBoost(word[m[2]:m[3]])
+		if err != nil {
+			return err
+		}
+		word, boost = word[:m[0]], boost*b
+	}
+
+	name, value, ok := cutField(word)
+	field, defined := p.engine.schema.Field(name)
+	if !ok || !defined {
+		name, value = DefaultField, word
+		field, _ = p.engine.schema.Field(DefaultField)
+	}
+	boost *= field.boost()
+	if b, ok := p.fieldBoosts[name]; ok {
+		boost *= b
+	}
+	if name == DefaultField {
+		p.add(boost, p.engine.tokenizer.TextToWordSequence(unquote(value))...)
+		return nil
+	}
+	if !field.Indexed {
+		return fmt.Errorf("%w: field %s is not indexed", ErrInvalidQuery, name)
+	}
+	r, err := parseRange(field, value)
+	if err != nil {
+		return err
+	}
+	if r != nil {
+		p.parsed.ranges = append(p.parsed.ranges, r)
+		return nil
+	}
+	value, err = field.normalize(unquote(value))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	if field.Type != FieldText {
+		p.add(boost, fieldTerm(name, value))
+		return nil
+	}
+	for _, term := range p.engine.tokenizer.TextToWordSequence(value) {
+		p.add(boost, fieldTerm(name, term))
+	}
+	return nil
+}
+
+func (p *queryParser) add(boost float64, terms ...string) {
+	for _, term := range terms {
+		p.parsed.terms = append(p.parsed.terms, term)
+		p.parsed.boosts = append(p.parsed.boosts, boost)
+	}
+}
+
+// 「^」に続く重みを読み込む
+func parseBoost(s string) (float64, error) {
+	boost, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid boost %q", ErrInvalidQuery, s)
+	}
+	if err := checkBoost(boost); err != nil {
+		return 0, err
+	}
+	return boost, nil
+}
+
+// すべての範囲を満たすドキュメントのフィルタ。範囲がなければnilを返す
+func (q *parsedQuery) filter() filterClause {
+	if len(q.ranges) == 0 {
+		return nil
+	}
+	clauses := make(andFilter, len(q.ranges))
+	for i, r := range q.ranges {
+		clauses[i] = rangeFilter{r}
+	}
+	return clauses
+}
+
+// クエリを空白で語に分割する。""で囲まれた空白と、「フィールド名:[lo TO hi]」の範囲の中の空白では分割しない
+func splitQuery(query string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	quoted, ranged := false, false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			word.WriteRune(r)
+		case !quoted && (r == '[' || r == '{') && strings.HasSuffix(word.String(), ":"):
+			ranged = true
+			word.WriteRune(r)
+		case !quoted && ranged && (r == ']' || r == '}'):
+			ranged = false
+			word.WriteRune(r)
+		case !quoted && !ranged && (r == ' ' || r == '\t' || r == '\n' || r == '\r'):
+			if word.Len() > 0 {
+				words = append(words, word.String())
+				word.Reset()
+			}
+		default:
+			word.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("%w: unterminated quote", ErrInvalidQuery)
+	}
+	if ranged {
+		return nil, fmt.Errorf("%w: unterminated range", ErrInvalidQuery)
+	}
+	if word.Len() > 0 {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// 「フィールド名:値」の語をフィールド名と値に分ける
+func cutField(word string) (name, value string, ok bool) {
+	i := strings.IndexByte(word, ':')
+	if i <= 0 || strings.Contains(word[:i], `"`) {
+		return "", "", false
+	}
+	return word[:i], word[i+1:], true
+}
+
+// 値を囲む""を取り除く
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,108 @@
+package ssego
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	e := &Engine{tokenizer: NewTokenizer(), schema: testSchema()}
+	type testCase struct {
+		query string
+		want  []string
+		err   bool
+	}
+	testCases := []testCase{
+		{"Quarrel, sir!", []string{"quarrel", "sir"}, false},
+		{`title:Quarrel author:"William Shakespeare" sir`, []string{"title:quarrel", "author:William Shakespeare", "sir"}, false},
+		{"year:1600.0 body:sir", []string{"year:1600", "sir"}, false},
+		{"note:sir", []string{"notesir"}, false},
+		{"year:MDC", nil, true},
+		{"modified:2026-01-01", nil, true},
+		{`author:"William`, nil, true},
+	}
+	for _, testCase := range testCases {
+		var got []string
+		parsed, err := e.parseQuery(testCase.query)
+		if err == nil {
+			got = parsed.terms
+		}
+		if (err != nil) != testCase.err || !reflect.DeepEqual(got, testCase.want) {
+			t.Fatalf("%s: got: %q, %v\nwant: %q\n", testCase.query, got, err, testCase.want)
+		}
+	}
+}
+
+func TestParseQueryBoost(t *testing.T) {
+	e := &Engine{tokenizer: NewTokenizer(), schema: testSchema()}
+	type testCase struct {
+		req   SearchRequest
+		terms []string
+		want  []float64
+		err   bool
+	}
+	testCases := []testCase{
+		{SearchRequest{Query: "quarrel^3 sir"}, []string{"quarrel", "sir"}, []float64{3, 1}, false},
+		{SearchRequest{Query: "title:quarrel^0.5 author:\"William Shakespeare\"^2"}, []string{"title:quarrel", "author:William Shakespeare"}, []float64{1, 2}, false},
+		{SearchRequest{Query: "(quarrel (sir no)^3)^2 better"}, []string{"quarrel", "sir", "no", "better"}, []float64{2, 6, 6, 1}, false},
+		{SearchRequest{Query: "quarrel", Clauses: []QueryClause{{Query: "sir^2", Boost: 1.5}, {Query: "no"}}}, []string{"quarrel", "sir", "no"}, []float64{1, 3, 1}, false},
+		{SearchRequest{Query: "title:sir sir", FieldBoosts: map[string]float64{"title": 3}}, []string{"title:sir", "sir"}, []float64{6, 1}, false},
+		{SearchRequest{Query: "sir)^2 (no"}, []string{"sir", "no"}, []float64{1, 1}, false},
+		{SearchRequest{Query: "quarrel^x"}, nil, nil, true},
+		{SearchRequest{Query: "quarrel^-1"}, nil, nil, true},
+		{SearchRequest{Query: "sir", FieldBoosts: map[string]float64{"note": 2}}, nil, nil, true},
+		{SearchRequest{Query: "sir", Clauses: []QueryClause{{Query: "no", Boost: -1}}}, nil, nil, true},
+	}
+	for _, testCase := range testCases {
+		var terms []string
+		var got []float64
+		parsed, err := e.parseRequest(testCase.req)
+		if err == nil {
+			terms, got = parsed.terms, parsed.boosts
+		}
+		if (err != nil) != testCase.err || !reflect.DeepEqual(terms, testCase.terms) || !reflect.DeepEqual(got, testCase.want) {
+			t.Fatalf("%+v: got: %q %v, %v\nwant: %q %v\n", testCase.req, terms, got, err, testCase.terms, testCase.want)
+		}
+	}
+}
+
+// 重みをつけた用語と節で、検索結果の順位が変わる
+func TestSearchBoost(t *testing.T) {
+	dir := writeTestIndex(t, []string{
+		"Do you quarrel, sir?",
+		"Quarrel sir! no, sir!",
+		"No better.",
+		"Well, sir",
+		"No better, no better, sir",
+	})
+	defer os.RemoveAll(dir)
+	e := &Engine{tokenizer: NewTokenizer(), schema: testSchema()}
+
+	type testCase struct {
+		req      SearchRequest
+		expected []DocumentID
+	}
+	testCases := []testCase{
+		{SearchRequest{Query: "better quarrel sir"}, []DocumentID{5, 2, 1, 3, 4}},
+		{SearchRequest{Query: "better (quarrel sir)^2"}, []DocumentID{2, 1, 5, 3, 4}},
+		{SearchRequest{Query: "better", Clauses: []QueryClause{{Query: "quarrel sir", Boost: 2}}}, []DocumentID{2, 1, 5, 3, 4}},
+	}
+	for _, testCase := range testCases {
+		parsed, err := e.parseRequest(testCase.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newSearcher(NewIndexReader(dir), nil, "TFIDF")
+		s.boosts = parsed.boosts
+		collector := NewTopKCollector(10)
+		s.SearchOr(parsed.terms, collector, Exhaustive)
+		var got []DocumentID
+		for _, doc := range collector.TopDocs().scoreDocs {
+			got = append(got, doc.docID)
+		}
+		if !reflect.DeepEqual(got, testCase.expected) {
+			t.Fatalf("%+v: got:%v\nexpected:%v\n", testCase.req, got, testCase.expected)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package ssego
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// 数値と日付のフィールドの範囲検索
+// 値は大小関係を保った64ビットの符号なし整数(キー)に変換し、キーの下位ビットをtrieStepずつ落とした値もそれぞれ用語として索引する(trie符号化)
+// 範囲は両端の端数部分を細かい桁の用語で、中央の部分をまとめて上位の桁の用語で覆うので、範囲の広さによらず少ない用語の和集合で検索できる
+
+// 1桁で落とすビット数
+// 小さいほど1つの値を索引する用語が増え、範囲を覆う用語は減る
+const trieStep = 4
+
+// 値をキーに変換する。valueは正規化した値とする
+func (f *Field) rangeKey(value string) (uint64, error) {
+	switch f.Type {
+	case FieldNumeric:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("field %s: %q is not a number", f.Name, value)
+		}
+		return floatKey(n), nil
+	case FieldDate:
+		t, err := parseDate(value)
+		if err != nil {
+			return 0, fmt.Errorf("field %s: %q is not a date", f.Name, value)
+		}
+		return uint64(t.Unix()) ^ 1<<63, nil
+	}
+	return 0, fmt.Errorf("field %s: %s fields do not support ranges", f.Name, f.Type)
+}
+
+// キーを索引する用語。キーそのものから順に、下位ビットを落とした値を並べる
+func trieTerms(field string, key uint64) []string {
+	terms := make([]string, 0, 64/trieStep)
+	for shift := uint(0); shift < 64; shift += trieStep {
+		terms = append(terms, trieTerm(field, shift, key>>shift))
+	}
+	return terms
+}
+
+// 下位shiftビットを落としたキーの用語
+// フィールドの値の用語と区別できるように、値には現れない#を付ける
+func trieTerm(field string, shift uint, prefix uint64) string {
+	return fmt.Sprintf("%s:#%d:%x", field, shift, prefix)
+}
+
+// trie符号化で索引した用語か
+func isTrieTerm(term string) bool {
+	return strings.Contains(term, ":#")
+}
+
+// lo以上hi以下のキーを覆う用語を、下位shiftビットを落とした値の範囲としてemitに渡す
+func splitRange(lo, hi uint64, emit func(shift uint, first, last uint64)) {
+	const block = 1 << trieStep
+	for shift := uint(0); lo <= hi; shift += trieStep {
+		// 最上位の桁ではそれ以上まとめられない
+		if shift+trieStep >= 64 {
+			emit(shift, lo, hi)
+			return
+		}
+		// 上位の桁の境界に揃っていない下端の端数
+		if lo%block != 0 {
+			last := lo | (block - 1)
+			if last >= hi {
+				emit(shift, lo, hi)
+				return
+			}
+			emit(shift, lo, last)
+			lo = last + 1
+		}
+		// 上位の桁の境界に揃っていない上端の端数
+		if hi%block != block-1 {
+			first := hi &^ (block - 1)
+			if first <= lo {
+				emit(shift, lo, hi)
+				return
+			}
+			emit(shift, first, hi)
+			hi = first - 1
+		}
+		lo, hi = lo>>trieStep, hi>>trieStep
+	}
+}
+
+// フィールドの値の範囲。キーがlo以上hi以下のドキュメントにマッチする
+// lo > hiのときはどのドキュメントにもマッチしない
+type rangeQuery struct {
+	field  string
+	lo, hi uint64
+}
+
+// 範囲の構文なら範囲を返す。範囲の構文でなければnilを返す
+//   - [lo TO hi]はloとhiを含み、{lo TO hi}は含まない。[lo TO hi}のように組み合わせられ、*は上限・下限を設けない
+//   - >lo, >=lo, <hi, <=hiは片側のみの範囲
+func parseRange(field *Field, value string) (*rangeQuery, error) {
+	var lower, upper string
+	lowerInclusive, upperInclusive := true, true
+	switch {
+	case strings.HasPrefix(value, ">="):
+		lower = value[2:]
+	case strings.HasPrefix(value, ">"):
+		lower, lowerInclusive = value[1:], false
+	case strings.HasPrefix(value, "<="):
+		upper = value[2:]
+	case strings.HasPrefix(value, "<"):
+		upper, upperInclusive = value[1:], false
+	case strings.HasPrefix(value, "[") || strings.HasPrefix(value, "{"):
+		end := value[len(value)-1]
+		var parts []string
+		if len(value) >= 2 {
+			parts = strings.Fields(value[1 : len(value)-1])
+		}
+		if (end != ']' && end != '}') || len(parts) != 3 || parts[1] != "TO" {
+			return nil, fmt.Errorf("%w: invalid range %s; use [lo TO hi]", ErrInvalidQuery, value)
+		}
+		lower, upper = parts[0], parts[2]
+		lowerInclusive, upperInclusive = value[0] == '[', end == ']'
+	default:
+		return nil, nil
+	}
+	if !field.isRange() {
+		return nil, fmt.Errorf("%w: field %s: %s fields do not support ranges", ErrInvalidQuery, field.Name, field.Type)
+	}
+	if lower == "" && upper == "" {
+		return nil, fmt.Errorf("%w: invalid range %s: missing bound", ErrInvalidQuery, value)
+	}
+
+	r := &rangeQuery{field: field.Name, lo: 0, hi: math.MaxUint64}
+	if lower != "" && lower != "*" {
+		key, err := field.boundKey(lower)
+		if err != nil {
+			return nil, err
+		}
+		if !lowerInclusive {
+			if key == math.MaxUint64 {
+				return &rangeQuery{field: field.Name, lo: 1, hi: 0}, nil
+			}
+			key++
+		}
+		r.lo = key
+	}
+	if upper != "" && upper != "*" {
+		key, err := field.boundKey(upper)
+		if err != nil {
+			return nil, err
+		}
+		if !upperInclusive {
+			if key == 0 {
+				return &rangeQuery{field: field.Name, lo: 1, hi: 0}, nil
+			}
+			key--
+		}
+		r.hi = key
+	}
+	return r, nil
+}
+
+// 範囲の端の値をキーに変換する
+func (f *Field) boundKey(value string) (uint64, error) {
+	value, err := f.normalize(unquote(value))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	return f.rangeKey(value)
+}
+
+// 範囲に含まれる値を持つドキュメントの集合を返す
+func (q *rangeQuery) docIDs(reader termReader) (*bitset, error) {
+	docs := &bitset{}
+	if q.lo > q.hi {
+		return docs, nil
+	}
+	var err error
+	splitRange(q.lo, q.hi, func(shift uint, first, last uint64) {
+		for prefix := first; err == nil; prefix++ {
+			var t *cachedTerm
+			if t, err = reader.term(trieTerm(q.field, shift, prefix)); t != nil {
+				for _, docID := range t.postings.docIDs {
+					docs.add(docID)
+				}
+			}
+			if prefix == last {
+				break
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return docs, nil
+}
@@ -0,0 +1,168 @@
+package ssego
+
+import (
+	"math"
+	"math/rand"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestSplitRange(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	ranges := [][2]uint64{{0, math.MaxUint64}, {0, 0}, {math.MaxUint64, math.MaxUint64}, {15, 16}, {17, 4111}}
+	for i := 0; i < 100; i++ {
+		lo, hi := rnd.Uint64(), rnd.Uint64()
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		ranges = append(ranges, [2]uint64{lo, hi}, [2]uint64{lo, lo + uint64(rnd.Intn(1000))})
+	}
+	for _, r := range ranges {
+		lo, hi := r[0], r[1]
+		type cover struct {
+			shift       uint
+			first, last uint64
+		}
+		var covers []cover
+		splitRange(lo, hi, func(shift uint, first, last uint64) {
+			covers = append(covers, cover{shift, first, last})
+		})
+		// 範囲の内外の値が、ちょうど1つの用語で覆われるかどうかを確かめる
+		values := []uint64{lo, hi, lo + (hi-lo)/2, lo - 1, hi + 1}
+		for _, v := range values {
+			n := 0
+			for _, c := range covers {
+				if prefix := v >> c.shift; c.first <= prefix && prefix <= c.last {
+					n++
+				}
+			}
+			expected := 0
+			if lo <= v && v <= hi {
+				expected = 1
+			}
+			if n != expected {
+				t.Fatalf("[%d, %d] %d: got:%v\nexpected:%v\n%v", lo, hi, v, n, expected, covers)
+			}
+		}
+	}
+}
+
+func TestRangeKey(t *testing.T) {
+	schema := testSchema()
+	year, _ := schema.Field("year")
+	numbers := []string{"-1e+300", "-1600", "-0.5", "0", "0.5", "1597", "1600", "1e+300"}
+	modified, _ := schema.Field("modified")
+	dates := []string{"1969-12-31T23:59:59Z", "1970-01-01T00:00:00Z", "2026-01-01T00:00:00Z", "2026-01-02T00:00:00Z"}
+	for _, testCase := range []struct {
+		field  *Field
+		values []string
+	}{{year, numbers}, {modified, dates}} {
+		var keys []uint64
+		for _, value := range testCase.values {
+			key, err := testCase.field.rangeKey(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, key)
+		}
+		if !sort.SliceIsSorted(keys, func(i, j int) bool { return keys[i] < keys[j] }) {
+			t.Fatalf("%s: keys are not in the order of values: %v", testCase.field.Name, keys)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	year, _ := testSchema().Field("year")
+	key := func(value string) uint64 {
+		k, err := year.rangeKey(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	type testCase struct {
+		value string
+		want  *rangeQuery
+		err   bool
+	}
+	testCases := []testCase{
+		{"1600", nil, false},
+		{"[1590 TO 1600]", &rangeQuery{"year", key("1590"), key("1600")}, false},
+		{"{1590 TO 1600]", &rangeQuery{"year", key("1590") + 1, key("1600")}, false},
+		{"[* TO 1600}", &rangeQuery{"year", 0, key("1600") - 1}, false},
+		{">=1590", &rangeQuery{"year", key("1590"), math.MaxUint64}, false},
+		{"<1600", &rangeQuery{"year", 0, key("1600") - 1}, false},
+		{"[1590 1600]", nil, true},
+		{"[1590 TO MDC]", nil, true},
+		{">", nil, true},
+	}
+	for _, testCase := range testCases {
+		got, err := parseRange(year, testCase.value)
+		if (err != nil) != testCase.err || !reflect.DeepEqual(got, testCase.want) {
+			t.Fatalf("%s: got: %v, %v\nwant: %v\n", testCase.value, got, err, testCase.want)
+		}
+	}
+	author, _ := testSchema().Field("author")
+	if _, err := parseRange(author, "[a TO b]"); err == nil {
+		t.Fatal("expected an error for a keyword range")
+	}
+}
+
+func TestRangeSearch(t *testing.T) {
+	schema := testSchema()
+	schema.Fields[4].Indexed = true
+	e := &Engine{tokenizer: NewTokenizer(), schema: schema}
+	docs := []Document{
+		{Body: strings.NewReader("Do you quarrel, sir?"), Fields: map[string]string{"year": "1597", "modified": "2025-12-31"}},
+		{Body: strings.NewReader("Quarrel sir! no, sir!"), Fields: map[string]string{"year": "1600", "modified": "2026-01-02"}},
+		{Body: strings.NewReader("No better."), Fields: map[string]string{"year": "1590", "modified": "2026-03-01"}},
+		{Body: strings.NewReader("Well, sir"), Fields: map[string]string{"year": "1623"}},
+	}
+	indexer := NewIndexer(e.tokenizer)
+	for i, doc := range docs {
+		analyzed, err := e.analyze(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		indexer.updateTerms(DocumentID(i+1), analyzed.terms)
+		indexer.store(DocumentID(i+1), analyzed.stored)
+	}
+	dir := writeTestIndex(t, nil)
+	defer os.RemoveAll(dir)
+	reader := newNRTReader(NewIndexReader(dir), nil, indexer)
+
+	type testCase struct {
+		query    string
+		expected []DocumentID
+	}
+	testCases := []testCase{
+		{"year:[1590 TO 1600]", []DocumentID{1, 2, 3}},
+		{"sir year:[1590 TO 1600}", []DocumentID{1}},
+		{"quarrel modified:>2026-01-01", []DocumentID{2}},
+		{"year:>=1597 year:<=1623 modified:<2026-01-02", []DocumentID{1}},
+		{"year:[1601 TO 1622]", nil},
+	}
+	for _, testCase := range testCases {
+		query, err := e.parseQuery(testCase.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := newSearcher(reader, nil, "TFIDF")
+		if filter := query.filter(); filter != nil {
+			if s.filter, err = filter.docs(reader); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got []DocumentID
+		for _, doc := range s.SearchTopK(query.terms, 10).ScoreDocs() {
+			got = append(got, doc.DocID())
+		}
+		sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+		if !reflect.DeepEqual(got, testCase.expected) {
+			t.Fatalf("%s: got:%v\nexpected:%v\n", testCase.query, got, testCase.expected)
+		}
+	}
+}
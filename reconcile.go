@@ -0,0 +1,100 @@
+package ssego
+
+import "sort"
+
+// インデクスとDocumentStoreの照合結果
+type ReconcileReport struct {
+	IndexedDocs      int          // インデクスに含まれるドキュメント数
+	StoredDocs       int          // DocumentStoreに保存されているドキュメント数
+	NextDocID        DocumentID   // 次に発行するドキュメントID
+	MissingFromStore []DocumentID // インデクスにあるがDocumentStoreにないドキュメント
+	MissingFromIndex []DocumentID // DocumentStoreにあるがインデクスにないドキュメント(用語を持たないものを除く)
+	BeyondAllocator  []DocumentID // 発行済みのドキュメントIDより大きいIDを持つドキュメント
+}
+
+// インデクスとDocumentStoreが一致していればtrue
+func (r *ReconcileReport) OK() bool {
+	return len(r.MissingFromStore) == 0 && len(r.MissingFromIndex) == 0 && len(r.BeyondAllocator) == 0
+}
+
+// インデクスに含まれるドキュメントと、DocumentStoreに保存されているドキュメントを照合する
+// Flushされていないドキュメントも含め、削除済みのドキュメントは除く
+// 照合中はドキュメントの追加とFlushを待たせる
+func (e *Engine) Reconcile() (*ReconcileReport, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	indexed, err := e.indexedDocIDs()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := e.documentStore.fetchTermCounts()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{
+		IndexedDocs: len(indexed),
+		StoredDocs:  len(stored),
+		NextDocID:   e.nextDocID,
+	}
+	for docID := range indexed {
+		if _, ok := stored[docID]; !ok {
+			report.MissingFromStore = append(report.MissingFromStore, docID)
+		}
+	}
+	for docID, termCount := range stored {
+		if !indexed[docID] && termCount > 0 {
+			report.MissingFromIndex = append(report.MissingFromIndex, docID)
+		}
+		if docID >= e.nextDocID {
+			report.BeyondAllocator = append(report.BeyondAllocator, docID)
+		}
+	}
+	for _, docIDs := range [][]DocumentID{report.MissingFromStore, report.MissingFromIndex, report.BeyondAllocator} {
+		sort.Slice(docIDs, func(i, j int) bool { return docIDs[i] < docIDs[j] })
+	}
+	return report, nil
+}
+
+// コミット済みの世代、セグメント、メモリ上のインデクスのポスティングリストに現れるドキュメントIDを集める
+func (e *Engine) indexedDocIDs() (map[DocumentID]bool, error) {
+	iterators := []termIterator{newIndexIterator(e.indexer.index)}
+	if commit, err := readCommit(e.indexDir); err != nil {
+		return nil, err
+	} else if commit.Generation > 0 {
+		it, err := openGeneration(generationDir(e.indexDir, commit.Generation))
+		if err != nil {
+			return nil, err
+		}
+		iterators = append(iterators, it)
+	}
+	for _, segment := range e.indexer.segments {
+		r, err := openSegment(segment)
+		if err != nil {
+			closeIterators(iterators)
+			return nil, err
+		}
+		iterators = append(iterators, r)
+	}
+
+	docIDs := make(map[DocumentID]bool)
+	for _, it := range iterators {
+		defer it.close()
+		for {
+			ok, err := it.next()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				break
+			}
+			for _, docID := range it.postings().docIDs {
+				if !e.indexer.deleted[docID] {
+					docIDs[docID] = true
+				}
+			}
+		}
+	}
+	return docIDs, nil
+}
@@ -0,0 +1,65 @@
+package ssego
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReconcileStore(t *testing.T) {
+	store := newMemoryStore()
+	e := newTestEngine(t, store)
+	defer e.Close()
+
+	add := func(title, body string) DocumentID {
+		docID, err := e.AddDocument(title, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return docID
+	}
+	// コミット済みの世代、メモリ上のインデクスの両方のドキュメントを照合する
+	add("doc1", "Do you quarrel, sir?")
+	flushed := add("doc2", "Quarrel sir! no, sir!")
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	add("doc3", "No better.")
+	deleted := add("doc4", "Well, sir")
+	if err := e.DeleteDocument(deleted); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := e.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ReconcileReport{IndexedDocs: 3, StoredDocs: 3, NextDocID: 5}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("got: %+v\nwant: %+v\n", report, expected)
+	}
+
+	// DocumentStoreだけが変更された場合
+	delete(store.docs, flushed)
+	store.docs[7] = documentRecord{7, "orphan", "Well, sir", 2}
+	store.docs[8] = documentRecord{8, "empty", "", 0}
+	report, err = e.Reconcile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 用語を持たないドキュメントはインデクスに現れないので、欠けているとはみなさない
+	expected = &ReconcileReport{
+		IndexedDocs:      3,
+		StoredDocs:       4,
+		NextDocID:        5,
+		MissingFromStore: []DocumentID{flushed},
+		MissingFromIndex: []DocumentID{7},
+		BeyondAllocator:  []DocumentID{7, 8},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("got: %+v\nwant: %+v\n", report, expected)
+	}
+	if report.OK() {
+		t.Fatal("expected the report not to be OK")
+	}
+}
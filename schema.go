@@ -0,0 +1,251 @@
+package ssego
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// スキーマを保存するファイル名
+const schemaFileName = "_schema"
+
+// 本文を索引するフィールドの名前
+// AddDocumentのreaderから読み込んだテキストはこのフィールドに索引し、クエリのフィールドを指定しない用語もこのフィールドから探す
+const DefaultField = "body"
+
+// フィールドの型
+type FieldType string
+
+const (
+	FieldText    FieldType = "text"    // アナライザで用語に分割して索引する
+	FieldKeyword FieldType = "keyword" // 値全体を1つの用語として索引する
+	FieldNumeric FieldType = "numeric" // 数値
+	FieldDate    FieldType = "date"    // 日付。2006-01-02かRFC 3339の形式で指定する
+)
+
+// フィールドの定義
+type Field struct {
+	Name     string    `yaml:"name" toml:"name"`
+	Type     FieldType `yaml:"type" toml:"type"`
+	Analyzer string    `json:",omitempty" yaml:"analyzer" toml:"analyzer"` // textのフィールドを用語に分割する方法
+	Indexed  bool      `yaml:"indexed" toml:"indexed"`                     // 検索できるように索引するかどうか
+	Stored   bool      `yaml:"stored" toml:"stored"`                       // 検索結果で値を返せるように保存するかどうか
+	Boost    float64   `json:",omitempty" yaml:"boost" toml:"boost"`       // 用語のスコアに掛ける重み。0のときは1
+}
+
+// インデクスのスキーマ
+// インデクスディレクトリに保存し、作成時と異なるアナライザで索引や検索をしないように開くたびに検証する
+type Schema struct {
+	Fields []Field `yaml:"fields" toml:"fields"`
+}
+
+var fieldNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// analyzerで本文のみを索引するスキーマ
+// スキーマを持たない以前のインデクスもこのスキーマで作成されたものとして扱う
+func DefaultSchema(analyzer string) *Schema {
+	return &Schema{Fields: []Field{
+		{Name: DefaultField, Type: FieldText, Analyzer: analyzer, Indexed: true},
+	}}
+}
+
+// 名前がnameのフィールドを返す
+func (s *Schema) Field(name string) (*Field, bool) {
+	for i := range s.Fields {
+		if s.Fields[i].Name == name {
+			return &s.Fields[i], true
+		}
+	}
+	return nil, false
+}
+
+// doc valuesも含めて保存した値から、storedのフィールドの値のみを返す
+func (s *Schema) storedValues(values map[string]string) map[string]string {
+	var stored map[string]string
+	for name, value := range values {
+		if field, ok := s.Field(name); ok && field.Stored {
+			if stored == nil {
+				stored = make(map[string]string)
+			}
+			stored[name] = value
+		}
+	}
+	return stored
+}
+
+// スキーマを検証する
+func (s *Schema) Validate() error {
+	seen := make(map[string]bool)
+	for _, field := range s.Fields {
+		if !fieldNamePattern.MatchString(field.Name) {
+			return fmt.Errorf("invalid field name %q; use lowercase letters, digits and underscores", field.Name)
+		}
+		if seen[field.Name] {
+			return fmt.Errorf("field %s is defined more than once", field.Name)
+		}
+		seen[field.Name] = true
+
+		switch field.Type {
+		case FieldText:
+			if !contains(analyzers, field.Analyzer) {
+				return fmt.Errorf("field %s: unknown analyzer %q; use %s", field.Name, field.Analyzer, strings.Join(analyzers, " or "))
+			}
+			if field.Stored {
+				return fmt.Errorf("field %s: text fields cannot be stored", field.Name)
+			}
+		case FieldKeyword, FieldNumeric, FieldDate:
+			if field.Analyzer != "" {
+				return fmt.Errorf("field %s: %s fields are not analyzed", field.Name, field.Type)
+			}
+		default:
+			return fmt.Errorf("field %s: unknown type %q; use text, keyword, numeric or date", field.Name, field.Type)
+		}
+		if !field.Indexed && !field.Stored {
+			return fmt.Errorf("field %s is neither indexed nor stored", field.Name)
+		}
+		if field.Boost < 0 {
+			return fmt.Errorf("field %s: boost must not be negative", field.Name)
+		}
+	}
+
+	body, ok := s.Field(DefaultField)
+	if !ok || body.Type != FieldText || !body.Indexed {
+		return fmt.Errorf("schema requires an indexed text field %s", DefaultField)
+	}
+	return nil
+}
+
+// 用語のスコアに掛ける重み
+func (f *Field) boost() float64 {
+	if f.Boost == 0 {
+		return 1
+	}
+	return f.Boost
+}
+
+// 範囲検索とソートができるフィールドか
+func (f *Field) isRange() bool {
+	return f.Type == FieldNumeric || f.Type == FieldDate
+}
+
+// doc valuesを持つフィールドか
+// keyword, numeric, dateの値はstoredでなくてもドキュメントごとに保存し、ソートや集計に使う
+func (f *Field) hasDocValues() bool {
+	return f.Type != FieldText
+}
+
+// ドキュメントのフィールドの値を検証し、索引と保存に使う正規化した値を返す
+func (f *Field) normalize(value string) (string, error) {
+	switch f.Type {
+	case FieldNumeric:
+		n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return "", fmt.Errorf("field %s: %q is not a number", f.Name, value)
+		}
+		if math.IsNaN(n) {
+			return "", fmt.Errorf("field %s: NaN cannot be compared", f.Name)
+		}
+		// -0と0を同じ値として索引する
+		if n == 0 {
+			n = 0
+		}
+		return strconv.FormatFloat(n, 'g', -1, 64), nil
+	case FieldDate:
+		t, err := parseDate(strings.TrimSpace(value))
+		if err != nil {
+			return "", fmt.Errorf("field %s: %q is not a date; use 2006-01-02 or RFC 3339", f.Name, value)
+		}
+		return t.UTC().Format(time.RFC3339), nil
+	case FieldKeyword:
+		// セグメントファイルは用語をタブと改行で区切るので、制御文字は含められない
+		if strings.IndexFunc(value, unicode.IsControl) >= 0 {
+			return "", fmt.Errorf("field %s: keyword values cannot contain control characters", f.Name)
+		}
+	}
+	return value, nil
+}
+
+// 2006-01-02かRFC 3339の形式の日付を読み込む
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// フィールドを指定した用語
+// 本文の用語は英数字のみからなるので、区切り文字を含む用語と区別できる
+func fieldTerm(field, value string) string {
+	return field + ":" + value
+}
+
+// インデクスディレクトリに保存されたスキーマを読み込む。保存されていなければnilを返す
+func readSchema(indexDir string) (*Schema, error) {
+	bytes, err := ioutil.ReadFile(filepath.Join(indexDir, schemaFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var schema Schema
+	if err := json.Unmarshal(bytes, &schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %v", err)
+	}
+	return &schema, nil
+}
+
+func writeSchema(indexDir string, schema *Schema) error {
+	bytes, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(indexDir, schemaFileName)
+	if err := writeFileSync(filename+tmpSuffix, bytes); err != nil {
+		return err
+	}
+	if err := os.Rename(filename+tmpSuffix, filename); err != nil {
+		return err
+	}
+	return syncDir(indexDir)
+}
+
+// インデクスのスキーマを読み込み、設定と一致することを確かめる
+// スキーマが保存されていなければ、設定のスキーマ(指定されていなければDefaultSchema)を保存する
+func openSchema(indexDir string, options Options) (*Schema, error) {
+	schema, err := readSchema(indexDir)
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		schema = options.Schema
+		if schema == nil {
+			schema = DefaultSchema(options.Analyzer)
+		}
+		if err := schema.Validate(); err != nil {
+			return nil, err
+		}
+		if err := writeSchema(indexDir, schema); err != nil {
+			return nil, err
+		}
+	} else if err := schema.Validate(); err != nil {
+		return nil, fmt.Errorf("schema of %s: %v", indexDir, err)
+	}
+
+	if options.Schema != nil && !reflect.DeepEqual(options.Schema, schema) {
+		return nil, fmt.Errorf("schema in the options differs from the schema of %s", indexDir)
+	}
+	if body, _ := schema.Field(DefaultField); body.Analyzer != options.Analyzer {
+		return nil, fmt.Errorf("index %s was built with analyzer %q, but %q is configured", indexDir, body.Analyzer, options.Analyzer)
+	}
+	return schema, nil
+}
@@ -0,0 +1,140 @@
+package ssego
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// テストで使うスキーマ
+func testSchema() *Schema {
+	return &Schema{Fields: []Field{
+		{Name: DefaultField, Type: FieldText, Analyzer: "standard", Indexed: true},
+		{Name: "title", Type: FieldText, Analyzer: "standard", Indexed: true, Boost: 2},
+		{Name: "author", Type: FieldKeyword, Indexed: true, Stored: true},
+		{Name: "year", Type: FieldNumeric, Indexed: true, Stored: true},
+		{Name: "modified", Type: FieldDate, Stored: true},
+	}}
+}
+
+func TestSchemaValidate(t *testing.T) {
+	if err := testSchema().Validate(); err != nil {
+		t.Fatal(err)
+	}
+	invalid := []func(s *Schema){
+		func(s *Schema) { s.Fields[1].Name = "Title" },
+		func(s *Schema) { s.Fields[1].Name = "author" },
+		func(s *Schema) { s.Fields[1].Analyzer = "kuromoji" },
+		func(s *Schema) { s.Fields[1].Stored = true },
+		func(s *Schema) { s.Fields[2].Analyzer = "standard" },
+		func(s *Schema) { s.Fields[2].Type = "geo" },
+		func(s *Schema) { s.Fields[3].Indexed, s.Fields[3].Stored = false, false },
+		func(s *Schema) { s.Fields[1].Boost = -1 },
+		func(s *Schema) { s.Fields = s.Fields[1:] },
+		func(s *Schema) { s.Fields[0].Type = FieldKeyword },
+	}
+	for i, modify := range invalid {
+		s := testSchema()
+		modify(s)
+		if err := s.Validate(); err == nil {
+			t.Fatalf("%d: expected an error", i)
+		}
+	}
+}
+
+func TestFieldNormalize(t *testing.T) {
+	schema := testSchema()
+	type testCase struct {
+		field string
+		value string
+		want  string
+		err   bool
+	}
+	testCases := []testCase{
+		{"author", "William Shakespeare", "William Shakespeare", false},
+		{"author", "William\tShakespeare", "", true},
+		{"year", " 1600 ", "1600", false},
+		{"year", "1.60e3", "1600", false},
+		{"year", "MDC", "", true},
+		{"modified", "2026-01-02", "2026-01-02T00:00:00Z", false},
+		{"modified", "2026-01-02T09:00:00+09:00", "2026-01-02T00:00:00Z", false},
+		{"modified", "yesterday", "", true},
+	}
+	for _, testCase := range testCases {
+		field, _ := schema.Field(testCase.field)
+		got, err := field.normalize(testCase.value)
+		if (err != nil) != testCase.err || got != testCase.want {
+			t.Fatalf("%s %q: got: %q, %v\nwant: %q\n", testCase.field, testCase.value, got, err, testCase.want)
+		}
+	}
+}
+
+func TestOpenSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// スキーマのないインデクスには設定のスキーマを保存する
+	options := DefaultOptions()
+	options.Schema = testSchema()
+	if _, err := openSchema(dir, options); err != nil {
+		t.Fatal(err)
+	}
+	// 設定でスキーマを指定しなければ、保存されたスキーマを使う
+	got, err := openSchema(dir, DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, testSchema()) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, testSchema())
+	}
+
+	options.Schema = DefaultSchema("standard")
+	if _, err := openSchema(dir, options); err == nil {
+		t.Fatal("expected an error for a different schema")
+	}
+	options = DefaultOptions()
+	options.Analyzer = "whitespace"
+	if _, err := openSchema(dir, options); err == nil {
+		t.Fatal("expected an error for a different analyzer")
+	}
+}
+
+func TestTermFileName(t *testing.T) {
+	terms := []string{"quarrel", "author:William Shakespeare", "ext:.txt", "path:../etc/passwd", "author:"}
+	for _, term := range terms {
+		name := termFileName(term)
+		if !isTermFile(name) {
+			t.Fatalf("%q: %q is not a term file name", term, name)
+		}
+		got, err := termFromFileName(name)
+		if err != nil || got != term {
+			t.Fatalf("got: %q, %v\nwant: %q\n", got, err, term)
+		}
+	}
+
+	// ファイル名ではなく用語の順に並べる
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writer := NewIndexWriter(dir)
+	for _, term := range terms {
+		if err := writer.postingsList(dir, term, NewPostingsList(NewPosting(1, 0))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := termFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(terms)
+	if !reflect.DeepEqual(got, terms) {
+		t.Fatalf("got:%q\nexpected:%q\n", got, terms)
+	}
+}
@@ -6,8 +6,23 @@ import (
 
 // SearchTopKの検索結果を保持する
 type TopDocs struct {
-	totalHits int         // ヒット件数
-	scoreDocs []*ScoreDoc // 検索結果
+	totalHits  int         // ヒット件数
+	scoredDocs int         // スコアを計算したドキュメント数
+	scoreDocs  []*ScoreDoc // 検索結果
+}
+
+func (t *TopDocs) TotalHits() int {
+	return t.totalHits
+}
+
+// スコアを計算したドキュメント数
+// SearchTopKOrで上位K件に入りえないドキュメントを読み飛ばした場合にのみ、TotalHitsより少なくなる
+func (t *TopDocs) ScoredDocs() int {
+	return t.scoredDocs
+}
+
+func (t *TopDocs) ScoreDocs() []*ScoreDoc {
+	return t.scoreDocs
 }
 
 func (t *TopDocs) String() string {
@@ -23,3 +38,11 @@ type ScoreDoc struct {
 func (d ScoreDoc) String() string {
 	return fmt.Sprintf("docID: %v, Score: %v", d.docID, d.score)
 }
+
+func (d *ScoreDoc) DocID() DocumentID {
+	return d.docID
+}
+
+func (d *ScoreDoc) Score() float64 {
+	return d.score
+}
@@ -1,7 +1,15 @@
 package ssego
 
 import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
 )
 
@@ -9,9 +17,492 @@ func TestSearchTopK(t *testing.T) {
 	s := NewSearcher("testdata/index", nil, "TFIDF")      // searcherの初期化
 	actual := s.SearchTopK([]string{"quarrel", "sir"}, 1) // 検索の実行
 
-	expected := &TopDocs{2, []*ScoreDoc{{2, 1.9657842846620868}}}
+	expected := &TopDocs{totalHits: 2, scoredDocs: 2, scoreDocs: []*ScoreDoc{{2, 1.9657842846620868}}}
 
 	for !reflect.DeepEqual(actual, expected) {
 		t.Fatalf("got:%v\nexpected:%v\n", actual, expected)
 	}
 }
+
+func TestTopKCollector(t *testing.T) {
+	collector := NewTopKCollector(3)
+	docs := []*ScoreDoc{
+		{1, 0.5},
+		{2, 1.5},
+		{3, 0.5},
+		{4, 2.0},
+		{5, 1.5},
+		{6, 0.1},
+	}
+	for _, doc := range docs {
+		collector.Collect(doc)
+	}
+	actual := collector.TopDocs()
+
+	// 同点の場合はDocIDの小さい順になる
+	expected := &TopDocs{totalHits: 6, scoreDocs: []*ScoreDoc{{4, 2.0}, {2, 1.5}, {5, 1.5}}}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", actual, expected)
+	}
+}
+
+func TestSortCollector(t *testing.T) {
+	e := &Engine{schema: testSchema()}
+	values := map[DocumentID]map[string]string{
+		1: {"year": "1600"},
+		2: {"year": "1597"},
+		4: {"year": "1600"},
+		5: {"year": "-44"},
+	}
+	titles := map[DocumentID]string{1: "Hamlet", 2: "Romeo and Juliet", 3: "Faustus", 4: "As You Like It", 5: "Julius Caesar"}
+	docs := []*ScoreDoc{{1, 0.5}, {2, 1.5}, {3, 2.0}, {4, 1.0}, {5, 0.1}}
+
+	type testCase struct {
+		spec     string
+		expected []*ScoreDoc
+	}
+	testCases := []testCase{
+		// 値を持たないドキュメントは最後に並べ、同じ値のドキュメントはスコアの降順に並べる
+		{"year", []*ScoreDoc{{5, 0.1}, {2, 1.5}, {4, 1.0}, {1, 0.5}}},
+		{"year:desc", []*ScoreDoc{{4, 1.0}, {1, 0.5}, {2, 1.5}, {5, 0.1}}},
+		{"year:desc, _title", []*ScoreDoc{{4, 1.0}, {1, 0.5}, {2, 1.5}, {5, 0.1}}},
+		{"year:desc,_title:desc", []*ScoreDoc{{1, 0.5}, {4, 1.0}, {2, 1.5}, {5, 0.1}}},
+		{"_title", []*ScoreDoc{{4, 1.0}, {3, 2.0}, {1, 0.5}, {5, 0.1}}},
+		{"_score", []*ScoreDoc{{3, 2.0}, {2, 1.5}, {4, 1.0}, {1, 0.5}}},
+		{"_score:asc", []*ScoreDoc{{5, 0.1}, {1, 0.5}, {4, 1.0}, {2, 1.5}}},
+		{"_doc:desc", []*ScoreDoc{{5, 0.1}, {4, 1.0}, {3, 2.0}, {2, 1.5}}},
+	}
+	for _, testCase := range testCases {
+		spec, err := ParseSort(testCase.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields, err := e.sortFields(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		collector := newSortCollector(4, fields, func(docID DocumentID) map[string]string {
+			return values[docID]
+		}, func(docID DocumentID) (string, bool) {
+			title, ok := titles[docID]
+			return title, ok
+		})
+		for _, doc := range docs {
+			collector.Collect(doc)
+		}
+		expected := &TopDocs{totalHits: 5, scoreDocs: testCase.expected}
+		if actual := collector.TopDocs(); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("%s: got:%v\nexpected:%v\n", testCase.spec, actual, expected)
+		}
+	}
+
+	for _, spec := range []string{"year:up", "author", "title", "genre"} {
+		fields, err := ParseSort(spec)
+		if err == nil {
+			_, err = e.sortFields(fields)
+		}
+		if err == nil {
+			t.Fatalf("%s: expected an error", spec)
+		}
+	}
+}
+
+// タイトルを取得する関数から読み込んで並べる
+func TestSortByTitle(t *testing.T) {
+	dir := writeTestIndex(t, []string{"Do you quarrel, sir?", "Quarrel sir! no, sir!", "No better.", "Well, sir"})
+	defer os.RemoveAll(dir)
+	reader := NewIndexReader(dir)
+	titles := map[DocumentID]string{1: "Romeo and Juliet", 2: "Hamlet", 3: "Faustus"}
+
+	e := &Engine{schema: testSchema()}
+	spec, err := ParseSort("_title")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields, err := e.sortFields(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := newSortCollector(10, fields, reader.storedFields, func(docID DocumentID) (string, bool) {
+		title, ok := titles[docID]
+		return title, ok
+	})
+	newSearcher(reader, nil, "TFIDF").Search([]string{"sir"}, collector)
+
+	// タイトルを取得できないドキュメントは最後に並べる
+	var got []DocumentID
+	for _, doc := range collector.TopDocs().scoreDocs {
+		got = append(got, doc.docID)
+	}
+	expected := []DocumentID{2, 1, 4}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+}
+
+func TestFacetCollector(t *testing.T) {
+	values := map[DocumentID]map[string]string{
+		1: {"author": "Shakespeare", "year": "1600"},
+		2: {"author": "Marlowe", "year": "1590"},
+		3: {"year": "1600"},
+		4: {"author": "Shakespeare"},
+		5: {"author": "Jonson"},
+	}
+	collector := NewTopKCollector(1)
+	facets := newFacetCollector(collector, []string{"author", "year"}, func(docID DocumentID) map[string]string {
+		return values[docID]
+	})
+	for docID := DocumentID(1); docID <= 5; docID++ {
+		facets.Collect(&ScoreDoc{docID, float64(docID)})
+	}
+
+	// 上位K件に入らないドキュメントも数え、同数の値は昇順に並べる
+	expected := map[string][]FacetValue{
+		"author": {{"Shakespeare", 2}, {"Jonson", 1}},
+		"year":   {{"1600", 2}, {"1590", 1}},
+	}
+	if got := facets.facets(2); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+	if got := collector.TopDocs(); got.TotalHits() != 5 {
+		t.Fatalf("got:%v\nexpected:%v\n", got.TotalHits(), 5)
+	}
+}
+
+func TestTotalHitCountCollector(t *testing.T) {
+	s := NewSearcher("testdata/index", nil, "TFIDF")
+	collector := NewTotalHitCountCollector()
+	s.Search([]string{"sir"}, collector)
+
+	if got := collector.TotalHits(); got != 4 {
+		t.Fatalf("got:%v\nexpected:%v\n", got, 4)
+	}
+}
+
+// テスト用のインデクスを一時ディレクトリに書き出す
+func writeTestIndex(t testing.TB, docs []string) string {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatalf("failed to create index dir: %v", err)
+	}
+	indexer := NewIndexer(NewTokenizer())
+	for i, doc := range docs {
+		indexer.update(DocumentID(i+1), strings.NewReader(doc))
+	}
+	if err := NewIndexWriter(dir).Flush(indexer.index); err != nil {
+		t.Fatalf("failed to save index: %v", err)
+	}
+	return dir
+}
+
+// 出現頻度の異なる用語からなるドキュメントを生成する
+func generateDocs(n int) []string {
+	rnd := rand.New(rand.NewSource(1))
+	docs := make([]string, n)
+	for i := range docs {
+		var words []string
+		for j := 0; j < 20; j++ {
+			switch x := rnd.Intn(100); {
+			case x < 1:
+				words = append(words, "rare")
+			case x < 10:
+				words = append(words, "medium")
+			case x < 60:
+				words = append(words, "common")
+			default:
+				words = append(words, "other")
+			}
+		}
+		docs[i] = strings.Join(words, " ")
+	}
+	return docs
+}
+
+func TestSearchTopKOr(t *testing.T) {
+	dir := writeTestIndex(t, generateDocs(2000))
+	defer os.RemoveAll(dir)
+
+	query := []string{"rare", "medium", "common"}
+	s := NewSearcher(dir, nil, "TFIDF")
+	expected := s.SearchTopKOr(query, 10, Exhaustive)
+	exhaustive := expected.ScoredDocs()
+
+	for _, algorithm := range []string{WAND, BlockMaxWAND, MaxScore} {
+		actual := s.SearchTopKOr(query, 10, algorithm)
+		if !reflect.DeepEqual(actual.scoreDocs, expected.scoreDocs) {
+			t.Errorf("%s: got:%v\nexpected:%v\n", algorithm, actual.scoreDocs, expected.scoreDocs)
+		}
+		if actual.ScoredDocs() >= exhaustive {
+			t.Errorf("%s: scored %d documents, exhaustive scored %d", algorithm, actual.ScoredDocs(), exhaustive)
+		}
+	}
+
+	// 重みをつけても、スコアの上限値で読み飛ばした結果はすべてを評価した結果と一致する
+	s.boosts = []float64{0.5, 4, 1}
+	expected = s.SearchTopKOr(query, 10, Exhaustive)
+	for _, algorithm := range []string{WAND, BlockMaxWAND, MaxScore} {
+		actual := s.SearchTopKOr(query, 10, algorithm)
+		if !reflect.DeepEqual(actual.scoreDocs, expected.scoreDocs) {
+			t.Errorf("%s with boosts: got:%v\nexpected:%v\n", algorithm, actual.scoreDocs, expected.scoreDocs)
+		}
+	}
+}
+
+func TestSearchTopKOrBM25(t *testing.T) {
+	dir := writeTestIndex(t, generateDocs(500))
+	defer os.RemoveAll(dir)
+
+	// 1語のクエリでは、OR検索のスコアはAND検索と同じ計算方法で求まる
+	s := NewSearcher(dir, nil, "BM25")
+	expected := s.SearchTopK([]string{"medium"}, 10)
+	for _, algorithm := range []string{Exhaustive, WAND, BlockMaxWAND, MaxScore} {
+		actual := s.SearchTopKOr([]string{"medium"}, 10, algorithm)
+		if !reflect.DeepEqual(actual.scoreDocs, expected.scoreDocs) {
+			t.Errorf("%s: got:%v\nexpected:%v\n", algorithm, actual.scoreDocs, expected.scoreDocs)
+		}
+	}
+}
+
+func TestSearchCorruptedPostings(t *testing.T) {
+	dir := writeTestIndex(t, []string{"Do you quarrel, sir?", "Quarrel sir! no, sir!"})
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(committedDir(dir), "sir"), []byte("[{"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// 読み込めない用語は存在しない用語として無視せず、エラーにする
+	s := NewSearcher(dir, nil, "TFIDF")
+	if term, err := s.indexReader.term("sir"); term != nil || err == nil {
+		t.Fatalf("got: %v, %v\nwant: a decode error", term, err)
+	}
+	if top := s.SearchTopK([]string{"quarrel", "sir"}, 10); s.err == nil || len(top.scoreDocs) != 0 {
+		t.Fatalf("got: %v, %v\nwant: no results and an error", top.scoreDocs, s.err)
+	}
+	if top := s.SearchTopKOr([]string{"quarrel", "sir"}, 10, WAND); s.err == nil || len(top.scoreDocs) != 0 {
+		t.Fatalf("got: %v, %v\nwant: no results and an error", top.scoreDocs, s.err)
+	}
+	// 存在しない用語はこれまでどおり無視する
+	if top := s.SearchTopK([]string{"quarrel", "better"}, 10); s.err != nil || len(top.scoreDocs) != 2 {
+		t.Fatalf("got: %v, %v\nwant: 2 results and no error", top.scoreDocs, s.err)
+	}
+}
+
+func TestIndexReaderEmptyDocCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// 0件も世代のドキュメント数としてキャッシュし、ファイルを読み直さない
+	r := NewIndexReader(dir)
+	if got := r.totalDocCount(); got != 0 {
+		t.Fatalf("got:%v\nexpected:%v\n", got, 0)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "_0.dc"), []byte("3"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.totalDocCount(); got != 0 {
+		t.Fatalf("got:%v\nexpected:%v\n", got, 0)
+	}
+}
+
+func TestSearcherConcurrent(t *testing.T) {
+	dir := writeTestIndex(t, generateDocs(500))
+	defer os.RemoveAll(dir)
+
+	queries := [][]string{{"rare"}, {"medium", "common"}, {"rare", "other"}, {"common"}}
+	expected := make([]*TopDocs, len(queries))
+	for i, query := range queries {
+		expected[i] = NewSearcher(dir, nil, "TFIDF").SearchTopK(query, 5)
+	}
+
+	// キャッシュを小さくして、読み込みと追い出しが同時に起こるようにする
+	reader := NewIndexReaderSize(dir, 4096)
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			query := queries[i%len(queries)]
+			actual := newSearcher(reader, nil, "TFIDF").SearchTopK(query, 5)
+			if !reflect.DeepEqual(actual, expected[i%len(queries)]) {
+				errs <- fmt.Errorf("%v: got:%v\nexpected:%v\n", query, actual, expected[i%len(queries)])
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	dir := writeTestIndex(t, []string{
+		"Do you quarrel, sir?",
+		"Quarrel sir! no, sir!",
+		"No better.",
+		"Well, sir",
+	})
+	defer os.RemoveAll(dir)
+	searcher := newSearcher(NewIndexReader(dir), nil, "TFIDF")
+
+	query := []string{"quarrel", "sir", "unknown"}
+	for _, doc := range searcher.SearchTopK(query, 10).ScoreDocs() {
+		explanation, err := searcher.explain(query, doc.DocID(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(explanation.Value-doc.Score()) > 1e-9 {
+			t.Fatalf("doc %d: got:%v\nexpected:%v\n%v", doc.DocID(), explanation.Value, doc.Score(), explanation)
+		}
+	}
+
+	explanation, err := searcher.explain(query, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `1.8300749985576874 = sum of (terms not in the index are ignored: unknown):
+  1 = weight(quarrel in 2), product of:
+    1 = boost, weight of term in query
+    1 = tf, computed as log2(freq) + 1 from:
+      1 = freq, occurrences of term within document
+    1 = idf, computed as log2(N / df) from:
+      4 = N, total number of documents
+      2 = df, number of documents containing term
+  0.8300749985576874 = weight(sir in 2), product of:
+    1 = boost, weight of term in query
+    2 = tf, computed as log2(freq) + 1 from:
+      2 = freq, occurrences of term within document
+    0.4150374992788437 = idf, computed as log2(N / df) from:
+      4 = N, total number of documents
+      3 = df, number of documents containing term
+`
+	if got := explanation.String(); got != expected {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+
+	// 重みをつけた用語はスコアへの寄与も重みの倍になる
+	searcher.boosts = []float64{3, 1, 1}
+	for _, doc := range searcher.SearchTopK(query, 10).ScoreDocs() {
+		explanation, err := searcher.explain(query, doc.DocID(), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(explanation.Value-doc.Score()) > 1e-9 {
+			t.Fatalf("doc %d: got:%v\nexpected:%v\n%v", doc.DocID(), explanation.Value, doc.Score(), explanation)
+		}
+	}
+	explanation, err = searcher.explain(query, 2, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := 3.8300749985576874; math.Abs(explanation.Value-expected) > 1e-9 {
+		t.Fatalf("got:%v\nexpected:%v\n", explanation.Value, expected)
+	}
+	searcher.boosts = nil
+
+	// OR検索では含まれる用語のみスコアに寄与する
+	for _, doc := range searcher.SearchTopKOr(query, 10, WAND).ScoreDocs() {
+		explanation, err := searcher.explain(query, doc.DocID(), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(explanation.Value-doc.Score()) > 1e-9 {
+			t.Fatalf("doc %d: got:%v\nexpected:%v\n%v", doc.DocID(), explanation.Value, doc.Score(), explanation)
+		}
+	}
+	explanation, err = searcher.explain(query, 3, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `0 = no match: document 3 contains none of the query terms` + "\n"; explanation.String() != expected {
+		t.Fatalf("got:%v\nexpected:%v\n", explanation, expected)
+	}
+
+	explanation, err = searcher.explain(query, 3, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `0 = no match: document 3 does not contain term "quarrel"` + "\n"; explanation.String() != expected {
+		t.Fatalf("got:%v\nexpected:%v\n", explanation, expected)
+	}
+}
+
+// タイトルは世代とFlushされていないドキュメントに記録し、DocumentStoreから1件ずつ読み込まずに並べる
+func TestSortByTitleDocValues(t *testing.T) {
+	store := newMemoryStore()
+	e := newTestEngine(t, store)
+	defer e.Close()
+	index := func(title, body string) DocumentID {
+		docID, err := e.Index(Document{Title: title, Body: strings.NewReader(body)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return docID
+	}
+	sortByTitle := func() []string {
+		fields, err := ParseSort("_title")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := e.SearchWith(SearchRequest{Query: "sir", K: 10, Sort: fields})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, result := range res.Results {
+			titles = append(titles, result.Title)
+		}
+		return titles
+	}
+
+	index("Romeo and Juliet", "Do you quarrel, sir?")
+	deleted := index("Macbeth", "Well, sir")
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	index("Hamlet", "Quarrel sir! no, sir!")
+	if err := e.DeleteDocument(deleted); err != nil {
+		t.Fatal(err)
+	}
+	store.titleFetches = 0
+
+	expected := []string{"Hamlet", "Romeo and Juliet"}
+	if got := sortByTitle(); !reflect.DeepEqual(got, expected) || store.titleFetches != 0 {
+		t.Fatalf("got:%v (%d fetches)\nexpected:%v\n", got, store.titleFetches, expected)
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if got := sortByTitle(); !reflect.DeepEqual(got, expected) || store.titleFetches != 0 {
+		t.Fatalf("got:%v (%d fetches)\nexpected:%v\n", got, store.titleFetches, expected)
+	}
+	titles, err := readTitles(e.indexReader.indexDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 2 {
+		t.Fatalf("got:%v\nexpected: 2 titles without the deleted document\n", titles)
+	}
+
+	// タイトルを記録していない以前の世代は、次のFlushでDocumentStoreから読み込んで記録する
+	if err := os.Remove(filepath.Join(e.indexReader.indexDir, titlesFileName)); err != nil {
+		t.Fatal(err)
+	}
+	e.indexReader = NewIndexReader(e.indexDir)
+	e.nrt = nil
+	index("Faustus", "No better. Well, sir")
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	store.titleFetches = 0
+	expected = []string{"Faustus", "Hamlet", "Romeo and Juliet"}
+	if got := sortByTitle(); !reflect.DeepEqual(got, expected) || store.titleFetches != 0 {
+		t.Fatalf("got:%v (%d fetches)\nexpected:%v\n", got, store.titleFetches, expected)
+	}
+}
@@ -6,60 +6,84 @@ import (
 )
 
 // 検索処理を担う構造体Searcher
+// Searcherは1回の検索リクエストごとに作成する
+// IndexReaderは複数のSearcherで共有できる
 type Searcher struct {
-	indexReader   *IndexReader // インデクス読み取り器
-	cursors       []*Cursor    // ポスティングリストのポインタ配列
-	documentStore *DocumentStore
+	indexReader   termReader // インデクス読み取り器
+	documentStore documentStorage
 	score         string
+	scoredDocs    int                 // 直前の検索でスコアを計算したドキュメント数
+	deleted       map[DocumentID]bool // 検索結果から除外する削除済みのドキュメント
+	filter        *docSet             // nilでなければ、含まれるドキュメントのみ結果に含める
+	boosts        []float64           // クエリの用語ごとのスコアに掛ける重み。nilならすべて1
+	err           error               // 直前の検索で用語のポスティングリストを読み込めなかったときのエラー
 }
 
 func NewSearcher(path string, docStore *DocumentStore, score string) *Searcher {
-	return &Searcher{indexReader: NewIndexReader(path), documentStore: docStore, score: score}
+	// nilの*DocumentStoreをそのまま渡すと、nilでないインターフェースになる
+	var store documentStorage
+	if docStore != nil {
+		store = docStore
+	}
+	return newSearcher(NewIndexReader(path), store, score)
+}
+
+func newSearcher(reader termReader, docStore documentStorage, score string) *Searcher {
+	return &Searcher{indexReader: reader, documentStore: docStore, score: score}
 }
 
 // 検索を実行し、スコアが高い順にK件結果を返す
 func (s *Searcher) SearchTopK(query []string, k int) *TopDocs {
-	// マッチするドキュメントを抽出しスコアを計算する
-	results := s.search(query)
-
-	// 結果をスコアの降順でソートする
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].score > results[j].score
-	})
+	// 上位k件のみをヒープで保持しながらマッチするドキュメントを収集する
+	collector := NewTopKCollector(k)
+	s.Search(query, collector)
+	top := collector.TopDocs()
+	top.scoredDocs = s.scoredDocs
+	return top
+}
 
-	total := len(results)
-	if len(results) > k {
-		results = results[:k] // 上位k件のみ取得
-	}
+// 検索を実行し、マッチしたドキュメントをスコアとともにcollectorに渡す
+func (s *Searcher) Search(query []string, collector Collector) {
+	s.search(query, collector)
+}
 
-	return &TopDocs{
-		totalHits: total,
-		scoreDocs: results,
+func (s *Searcher) search(query []string, collector Collector) {
+	s.scoredDocs, s.err = 0, nil
+	// 用語がなければ、フィルタに含まれるドキュメントをスコア0で返す
+	// NOTのみのフィルタはドキュメントを列挙できないので、何も返さない
+	if len(query) == 0 && s.filter != nil {
+		if s.filter.negated {
+			return
+		}
+		bits := s.filter.bits
+		for docID, ok := bits.next(0); ok; docID, ok = bits.next(docID + 1) {
+			if !s.deleted[docID] {
+				s.scoredDocs++
+				collector.Collect(&ScoreDoc{docID: docID})
+			}
+		}
+		return
 	}
-}
 
-func (s *Searcher) search(query []string) []*ScoreDoc {
 	// カーソルの取得
 	// クエリに含まれる用語のポスティングリストが一つも存在しない場合、0件で終了する
-	if s.openCursors(query) == 0 {
-		return []*ScoreDoc{}
+	allCursors, boosts := s.openCursors(query)
+	if len(allCursors) == 0 {
+		return
 	}
 
 	// 一番短いポスティングリストを参照するカーソルを洗濯
-	c := s.cursors[0]
-	cursors := s.cursors[1:]
-
-	// 結果を格納する構造体の初期化
-	docs := make([]*ScoreDoc, 0)
+	c := allCursors[0]
+	cursors := allCursors[1:]
 
-	scorer := &Scorer{indexReader: s.indexReader, cursors: s.cursors}
+	scorer := &Scorer{indexReader: s.indexReader, cursors: allCursors, boosts: boosts, score: s.score}
 	// 最も短いポスティングリストをたどり終えるまで繰り返す
 	for !c.Empty() {
 		var nextDocID DocumentID
 		// その他のカーソルをcのdocID以上になるまですすめる
 		for _, cursor := range cursors {
 			if cursor.NextDoc(c.DocID()); cursor.Empty() {
-				return docs
+				return
 			}
 			// docIDが一致しなければ
 			if cursor.DocID() != c.DocID() {
@@ -71,25 +95,28 @@ func (s *Searcher) search(query []string) []*ScoreDoc {
 		if nextDocID > 0 {
 			// nextDocID以上になるまで読みすすめる
 			if c.NextDoc(nextDocID); c.Empty() {
-				return docs
+				return
 			}
+		} else if s.deleted[c.DocID()] || !s.accepts(c.DocID()) {
+			// 削除済みのドキュメントとフィルタに含まれないドキュメントは結果に含めない
+			c.Next()
 		} else {
 			// 結果を格納
+			s.scoredDocs++
 			switch s.score {
 
 			case "BM25":
-				termCount, _ := s.documentStore.fetchTermCount(c.DocID())
-				docs = append(docs, &ScoreDoc{
+				collector.Collect(&ScoreDoc{
 					docID: c.DocID(),
-					score: scorer.CalcBM25(termCount),
+					score: scorer.CalcBM25(s.termCount(c.DocID())),
 				})
 			case "TFIDF":
-				docs = append(docs, &ScoreDoc{
+				collector.Collect(&ScoreDoc{
 					docID: c.DocID(),
 					score: scorer.CalcTFIDF(),
 				})
 			default:
-				docs = append(docs, &ScoreDoc{
+				collector.Collect(&ScoreDoc{
 					docID: c.DocID(),
 					score: scorer.CalcTFIDF(),
 				})
@@ -98,44 +125,92 @@ func (s *Searcher) search(query []string) []*ScoreDoc {
 			c.Next()
 		}
 	}
-	return docs
+}
+
+// BM25の文書長に使うドキュメントの用語数
+// BM25以外では使わないので、DocumentStoreから読み込まずに0を返す
+func (s *Searcher) termCount(docID DocumentID) int {
+	if s.score != "BM25" || s.documentStore == nil {
+		return 0
+	}
+	termCount, _ := s.documentStore.fetchTermCount(docID)
+	return termCount
+}
 
+// ドキュメントがフィルタに含まれるか
+func (s *Searcher) accepts(docID DocumentID) bool {
+	return s.filter == nil || s.filter.contains(docID)
 }
 
-func (s *Searcher) openCursors(query []string) int {
+// クエリのi番目の用語のスコアに掛ける重み
+func (s *Searcher) boost(i int) float64 {
+	if i < len(s.boosts) {
+		return s.boosts[i]
+	}
+	return 1
+}
+
+// カーソルと、各カーソルの用語の重みを返す
+func (s *Searcher) openCursors(query []string) ([]*Cursor, []float64) {
 	// ポスティングリストを取得
-	postings := s.indexReader.postingsLists(query)
+	type weightedPostings struct {
+		postings *PostingsList
+		boost    float64
+	}
+	var postings []weightedPostings
+	for i, term := range query {
+		t, err := s.indexReader.term(term)
+		if err != nil {
+			// 読み込めない用語を無視すると結果が変わるので、何も返さずにエラーを残す
+			s.err = err
+			return nil, nil
+		}
+		if t != nil {
+			postings = append(postings, weightedPostings{t.postings, s.boost(i)})
+		}
+	}
 	if len(postings) == 0 {
-		return 0
+		return nil, nil
 	}
 
 	// 複数の検索ワードの中でポスティングリストの短い順にソート
-	sort.Slice(postings, func(i, j int) bool {
-		return postings[i].Len() < postings[j].Len()
+	sort.SliceStable(postings, func(i, j int) bool {
+		return postings[i].postings.Len() < postings[j].postings.Len()
 	})
 
 	// 各ポスティングリストに対するcursorの取得
 	cursors := make([]*Cursor, len(postings))
-	for i, postingList := range postings {
-		cursors[i] = postingList.OpenCursor()
+	boosts := make([]float64, len(postings))
+	for i, p := range postings {
+		cursors[i] = p.postings.OpenCursor()
+		boosts[i] = p.boost
 	}
 
-	s.cursors = cursors
-	return len(cursors)
+	return cursors, boosts
 }
 
 type Scorer struct {
-	indexReader *IndexReader // インデクス読み取り器
-	cursors     []*Cursor    // ポスティングリストのポインタ配列
+	indexReader termReader // インデクス読み取り器
+	cursors     []*Cursor  // ポスティングリストのポインタ配列
+	boosts      []float64  // cursorsの用語ごとのスコアに掛ける重み。nilならすべて1
+	score       string     // スコアの計算方法。BM25以外はTF-IDFとする
+}
+
+// i番目のカーソルの用語の重み
+func (s Scorer) boost(i int) float64 {
+	if i < len(s.boosts) {
+		return s.boosts[i]
+	}
+	return 1
 }
 
 func (t Scorer) CalcTFIDF() float64 {
 	var score float64
 	for i := 0; i < len(t.cursors); i++ {
-		termFreq := t.cursors[i].Posting().TermFrequency
+		termFreq := t.cursors[i].TermFrequency()
 		docCount := t.cursors[i].postingsList.Len()
 		totalDocCount := t.indexReader.totalDocCount()
-		score += calcTF(termFreq) * calcIDF(totalDocCount, docCount)
+		score += t.boost(i) * calcTF(termFreq) * calcIDF(totalDocCount, docCount)
 	}
 	return score
 
@@ -144,15 +219,35 @@ func (t Scorer) CalcTFIDF() float64 {
 func (s Scorer) CalcBM25(termCount int) float64 {
 	var score float64
 	for i := 0; i < len(s.cursors); i++ {
-		termFreq := s.cursors[i].Posting().TermFrequency
+		termFreq := s.cursors[i].TermFrequency()
 		docCount := s.cursors[i].postingsList.Len()
-		totalDocCount := s.indexReader.totalDocCount()
-		score += calcTF(termFreq) * calcIDF(totalDocCount, docCount)
+		score += s.boost(i) * s.bm25TermScore(termFreq, docCount, termCount)
 	}
 	return score
 
 }
 
+// 1つの用語がドキュメントのスコアに寄与する値
+// termCountはドキュメントの用語数(文書長)で、BM25のみ使う
+func (s Scorer) termScore(termFreq, docCount, termCount int) float64 {
+	if s.score == "BM25" {
+		return s.bm25TermScore(termFreq, docCount, termCount)
+	}
+	return calcTF(termFreq) * calcIDF(s.indexReader.totalDocCount(), docCount)
+}
+
+// BM25で1つの用語がスコアに寄与する値
+// 現在の計算式は文書長を使わない
+func (s Scorer) bm25TermScore(termFreq, docCount, termCount int) float64 {
+	return calcTF(termFreq) * calcIDF(s.indexReader.totalDocCount(), docCount)
+}
+
+// 出現回数の最大値がmaxTermFreqのとき、1つの用語がスコアに寄与する値の上限
+// BM25の計算式は文書長を使わないので、TF-IDFと同じく出現回数の最大値から上限が決まる
+func (s Scorer) maxTermScore(maxTermFreq, docCount int) float64 {
+	return math.Max(s.termScore(maxTermFreq, docCount, 0), 0)
+}
+
 func calcTF(termCount int) float64 {
 	if termCount <= 0 {
 		return 0
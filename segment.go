@@ -0,0 +1,287 @@
+package ssego
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// セグメントファイル
+// Indexerのメモリ使用量が上限を超えたときに、メモリ上のインデクスを書き出すファイル
+//   - 1行目はセグメントに含まれるドキュメント数
+//   - 2行目以降は「用語\tポスティングリストのJSON」を用語の昇順に並べたもの
+//
+// 用語の昇順に並んでいるので、複数のセグメントを先頭から順に読みながらマージできる
+func writeSegment(filename string, index *Index) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+	if _, err := fmt.Fprintln(writer, index.TotalDocsCount); err != nil {
+		return err
+	}
+	for _, term := range index.sortedTerms() {
+		bytes, err := json.Marshal(index.Dictionary[term])
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(writer, "%s\t%s\n", term, bytes); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+// 用語の昇順にポスティングリストを返すイテレータ
+type termIterator interface {
+	next() (bool, error)    // 次の用語に進む。用語がなくなったらfalseを返す
+	term() string           // 現在の用語
+	postings() PostingsList // 現在の用語のポスティングリスト
+	close() error
+}
+
+// メモリ上のインデクスを用語の昇順にたどるイテレータ
+type indexIterator struct {
+	index *Index
+	terms []string
+	pos   int
+}
+
+func newIndexIterator(index *Index) *indexIterator {
+	return &indexIterator{index: index, terms: index.sortedTerms(), pos: -1}
+}
+
+func (it *indexIterator) next() (bool, error) {
+	it.pos++
+	return it.pos < len(it.terms), nil
+}
+
+func (it *indexIterator) term() string {
+	return it.terms[it.pos]
+}
+
+func (it *indexIterator) postings() PostingsList {
+	return it.index.Dictionary[it.terms[it.pos]]
+}
+
+func (it *indexIterator) close() error {
+	return nil
+}
+
+// セグメントファイルを先頭から1用語ずつ読むイテレータ
+type segmentReader struct {
+	file     *os.File
+	reader   *bufio.Reader
+	docCount int
+	current  string
+	list     PostingsList
+}
+
+func openSegment(filename string) (*segmentReader, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	r := &segmentReader{file: file, reader: bufio.NewReader(file)}
+
+	line, err := r.reader.ReadString('\n')
+	if err == nil {
+		r.docCount, err = strconv.Atoi(strings.TrimSpace(line))
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("invalid segment %s: %v", filename, err)
+	}
+	return r, nil
+}
+
+func (r *segmentReader) next() (bool, error) {
+	line, err := r.reader.ReadString('\n')
+	if err == io.EOF && line == "" {
+		return false, nil
+	}
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	tab := strings.IndexByte(line, '\t')
+	if tab < 0 {
+		return false, fmt.Errorf("invalid segment line in %s", r.file.Name())
+	}
+	r.current = line[:tab]
+	var list PostingsList
+	if err := json.Unmarshal([]byte(line[tab+1:]), &list); err != nil {
+		return false, err
+	}
+	r.list = list
+	return true, nil
+}
+
+func (r *segmentReader) term() string {
+	return r.current
+}
+
+func (r *segmentReader) postings() PostingsList {
+	return r.list
+}
+
+func (r *segmentReader) close() error {
+	return r.file.Close()
+}
+
+// コミット済みの世代のディレクトリを用語の昇順に1ファイルずつ読むイテレータ
+type generationIterator struct {
+	dir   string
+	terms []string
+	pos   int
+	list  PostingsList
+}
+
+func openGeneration(dir string) (*generationIterator, error) {
+	terms, err := termFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &generationIterator{dir: dir, terms: terms, pos: -1}, nil
+}
+
+func (it *generationIterator) next() (bool, error) {
+	it.pos++
+	if it.pos >= len(it.terms) {
+		return false, nil
+	}
+	bytes, err := ioutil.ReadFile(filepath.Join(it.dir, termFileName(it.terms[it.pos])))
+	if err != nil {
+		return false, err
+	}
+	var list PostingsList
+	if err := json.Unmarshal(bytes, &list); err != nil {
+		return false, fmt.Errorf("invalid postings list %s: %v", it.terms[it.pos], err)
+	}
+	it.list = list
+	return true, nil
+}
+
+func (it *generationIterator) term() string {
+	return it.terms[it.pos]
+}
+
+func (it *generationIterator) postings() PostingsList {
+	return it.list
+}
+
+func (it *generationIterator) close() error {
+	return nil
+}
+
+// 複数のイテレータを用語の昇順にマージするイテレータ
+// 同じ用語のポスティングリストはDocIDの昇順にマージする
+type mergeIterator struct {
+	iterators termIteratorHeap // 現在の用語が最も小さいイテレータを先頭に持つヒープ
+	all       []termIterator
+	current   string
+	list      PostingsList
+}
+
+func newMergeIterator(iterators ...termIterator) (*mergeIterator, error) {
+	m := &mergeIterator{all: iterators}
+	for _, it := range iterators {
+		ok, err := it.next()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			m.iterators = append(m.iterators, it)
+		}
+	}
+	heap.Init(&m.iterators)
+	return m, nil
+}
+
+func (m *mergeIterator) next() (bool, error) {
+	if len(m.iterators) == 0 {
+		return false, nil
+	}
+
+	m.current = m.iterators[0].term()
+	m.list = NewPostingsList()
+	for len(m.iterators) > 0 && m.iterators[0].term() == m.current {
+		it := m.iterators[0]
+		if m.list.Len() == 0 {
+			m.list = it.postings()
+		} else {
+			m.list = mergePostingsLists(m.list, it.postings())
+		}
+
+		ok, err := it.next()
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			heap.Fix(&m.iterators, 0)
+		} else {
+			heap.Pop(&m.iterators)
+		}
+	}
+	return true, nil
+}
+
+func (m *mergeIterator) term() string {
+	return m.current
+}
+
+func (m *mergeIterator) postings() PostingsList {
+	return m.list
+}
+
+func (m *mergeIterator) close() error {
+	var err error
+	for _, it := range m.all {
+		if e := it.close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+type termIteratorHeap []termIterator
+
+func (h termIteratorHeap) Len() int           { return len(h) }
+func (h termIteratorHeap) Less(i, j int) bool { return h[i].term() < h[j].term() }
+func (h termIteratorHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *termIteratorHeap) Push(x interface{}) {
+	*h = append(*h, x.(termIterator))
+}
+
+func (h *termIteratorHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	it := old[n-1]
+	*h = old[:n-1]
+	return it
+}
+
+// 辞書の用語を昇順に並べて返す
+func (idx *Index) sortedTerms() []string {
+	terms := make([]string, 0, len(idx.Dictionary))
+	for term := range idx.Dictionary {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+	return terms
+}
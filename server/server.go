@@ -0,0 +1,470 @@
+// serverパッケージは検索エンジンをHTTPのJSON APIとして公開する
+//
+//	GET    /search?q=<query>&k=<n>&score=<TFIDF|BM25>  検索
+//	       &offset=<n>&explain=true                    (ページングとスコアの説明)
+//	       &snippet=true                               (クエリの用語を含む本文の抜粋)
+//	       &facet=<field>                              (検索結果全体でのフィールドの値の集計。複数指定できる)
+//	       &sort=<key[:asc|desc],...>                  (フィールド、_score、_doc、_titleによる並び順)
+//	       &filter=<filter>                            (スコアに影響しない絞り込み。filterがあればqは省略できる)
+//	       &or=<Exhaustive|WAND|BlockMaxWAND|MaxScore>  (いずれかの用語を含むドキュメントを返すOR検索)
+//	POST   /documents                                  ドキュメントの追加({"title", "body", "fields"})
+//	PUT    /documents/<id>                             ドキュメントの置き換え
+//	DELETE /documents/<id>                             ドキュメントの削除
+//	GET    /suggest?prefix=<prefix>&n=<n>              用語の補完候補(prefixは2文字以上)
+//	GET    /stats?top=<n>                              インデクスの統計情報
+//	GET    /schema                                     インデクスのフィールドと集計できるか
+//
+// エラーは {"error": {"code": "...", "message": "..."}} の形式で返す
+// uiを有効にすると、/ui/ で検索画面を提供する
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"ssego"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// サーバーが使う検索エンジンの操作
+type Engine interface {
+	SearchWith(req ssego.SearchRequest) (*ssego.SearchResponse, error)
+	Index(doc ssego.Document) (ssego.DocumentID, error)
+	Replace(docID ssego.DocumentID, doc ssego.Document) (ssego.DocumentID, error)
+	DeleteDocument(docID ssego.DocumentID) error
+	ExplainWith(req ssego.SearchRequest, docID ssego.DocumentID) (*ssego.Explanation, error)
+	Suggest(prefix string, n int) ([]ssego.TermStats, error)
+	Stats(topN int) (*ssego.IndexStats, error)
+	Schema() *ssego.Schema
+}
+
+const (
+	// リクエストの処理時間の上限のデフォルト値
+	DefaultTimeout = 10 * time.Second
+
+	maxResults      = 1000     // 1回の検索で返す結果の上限
+	maxBodySize     = 10 << 20 // リクエストボディの大きさの上限(バイト)
+	minSuggestChars = 2        // 補完候補を求めるprefixの最小の文字数。短いと多くの用語にマッチする
+)
+
+// エラーレスポンスのコード
+const (
+	codeInvalidArgument  = "invalid_argument"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+	codeTimeout          = "timeout"
+	codeInternal         = "internal"
+)
+
+// APIのエラー
+type apiError struct {
+	status  int
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+func invalidArgument(format string, args ...interface{}) *apiError {
+	return &apiError{http.StatusBadRequest, codeInvalidArgument, fmt.Sprintf(format, args...)}
+}
+
+type Server struct {
+	engine Engine
+	mux    *http.ServeMux
+}
+
+// engineを公開するhttp.Handlerを作成する
+// timeoutを超えたリクエストには503を返す。uiがtrueなら検索画面も提供する
+func New(engine Engine, timeout time.Duration, ui bool) http.Handler {
+	s := &Server{engine: engine, mux: http.NewServeMux()}
+	s.handle("/search", s.search)
+	s.handle("/documents", s.documents)
+	s.handle("/documents/", s.document)
+	s.handle("/suggest", s.suggest)
+	s.handle("/stats", s.stats)
+	s.handle("/schema", s.schema)
+	if ui {
+		s.handle("/ui/", serveUI)
+	}
+	s.handle("/", func(w http.ResponseWriter, r *http.Request) error {
+		if ui && r.URL.Path == "/" {
+			http.Redirect(w, r, "/ui/", http.StatusFound)
+			return nil
+		}
+		return &apiError{http.StatusNotFound, codeNotFound, fmt.Sprintf("%s is not found", r.URL.Path)}
+	})
+
+	body, _ := json.Marshal(errorResponse{&apiError{Code: codeTimeout, Message: "request timed out"}})
+	handler := http.TimeoutHandler(s.mux, timeout, string(body))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// タイムアウトのレスポンスもJSONとして返す
+		w.Header().Set("Content-Type", "application/json")
+		handler.ServeHTTP(w, r)
+	})
+}
+
+type errorResponse struct {
+	Error *apiError `json:"error"`
+}
+
+// エラーを返すハンドラをhttp.Handlerとして登録する
+func (s *Server) handle(pattern string, handler func(w http.ResponseWriter, r *http.Request) error) {
+	s.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		err := handler(w, r)
+		if err == nil {
+			return
+		}
+		var apiErr *apiError
+		switch {
+		case errors.As(err, &apiErr):
+		case errors.Is(err, ssego.ErrDocumentNotFound):
+			apiErr = &apiError{http.StatusNotFound, codeNotFound, err.Error()}
+		case errors.Is(err, ssego.ErrInvalidQuery), errors.Is(err, ssego.ErrInvalidDocument):
+			apiErr = &apiError{http.StatusBadRequest, codeInvalidArgument, err.Error()}
+		default:
+			apiErr = &apiError{http.StatusInternalServerError, codeInternal, err.Error()}
+		}
+		writeJSON(w, apiErr.status, errorResponse{apiErr})
+	})
+}
+
+// レスポンスを書き込む
+// 書き込みに失敗するのはクライアントが切断した場合なので、エラーは無視する
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func allowMethods(r *http.Request, methods ...string) error {
+	for _, method := range methods {
+		if r.Method == method {
+			return nil
+		}
+	}
+	return &apiError{
+		http.StatusMethodNotAllowed,
+		codeMethodNotAllowed,
+		fmt.Sprintf("method %s is not allowed; use %s", r.Method, strings.Join(methods, " or ")),
+	}
+}
+
+// クエリパラメータの整数を読み込む。指定されていなければdefaultValueを返す
+func intParam(r *http.Request, name string, defaultValue, max int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > max {
+		return 0, invalidArgument("%s must be an integer between 1 and %d", name, max)
+	}
+	return n, nil
+}
+
+type searchResult struct {
+	DocID       ssego.DocumentID  `json:"docID"`
+	Score       float64           `json:"score"`
+	Title       string            `json:"title"`
+	Fields      map[string]string `json:"fields,omitempty"`
+	Explanation string            `json:"explanation,omitempty"`
+	Snippet     []snippetFragment `json:"snippet,omitempty"`
+}
+
+// 本文の抜粋の一部分。matchはクエリの用語に一致した単語
+type snippetFragment struct {
+	Text  string `json:"text"`
+	Match bool   `json:"match,omitempty"`
+}
+
+type facetValue struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+type searchResponse struct {
+	Query   string                  `json:"query"`
+	Results []searchResult          `json:"results"`
+	Facets  map[string][]facetValue `json:"facets,omitempty"`
+	// 続きの結果がある場合、次のページのoffset
+	NextOffset int `json:"nextOffset,omitempty"`
+}
+
+func (s *Server) search(w http.ResponseWriter, r *http.Request) error {
+	if err := allowMethods(r, http.MethodGet); err != nil {
+		return err
+	}
+	query := r.URL.Query().Get("q")
+	filter := r.URL.Query().Get("filter")
+	if strings.TrimSpace(query) == "" && strings.TrimSpace(filter) == "" {
+		return invalidArgument("q is required")
+	}
+	k, err := intParam(r, "k", 10, maxResults)
+	if err != nil {
+		return err
+	}
+	offset := 0
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 || offset+k > maxResults {
+			return invalidArgument("offset must be an integer between 0 and %d", maxResults-k)
+		}
+	}
+	explain := r.URL.Query().Get("explain") == "true"
+	score := r.URL.Query().Get("score")
+	switch score {
+	case "", "TFIDF", "BM25":
+		// 空ならエンジンに設定された計算方法を使う
+	default:
+		return invalidArgument("unknown score %q; use TFIDF or BM25", score)
+	}
+
+	sort, err := ssego.ParseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		return err
+	}
+
+	// 続きがあるかを調べるため、1件多く検索する
+	req := ssego.SearchRequest{
+		Query:   query,
+		K:       offset + k + 1,
+		Score:   score,
+		Or:      r.URL.Query().Get("or"),
+		Filter:  filter,
+		Sort:    sort,
+		Facets:  r.URL.Query()["facet"],
+		Snippet: r.URL.Query().Get("snippet") == "true",
+	}
+	res, err := s.engine.SearchWith(req)
+	if err != nil {
+		return err
+	}
+	response := searchResponse{Query: query, Results: []searchResult{}}
+	for field, values := range res.Facets {
+		if response.Facets == nil {
+			response.Facets = make(map[string][]facetValue)
+		}
+		response.Facets[field] = make([]facetValue, len(values))
+		for i, value := range values {
+			response.Facets[field][i] = facetValue{value.Value, value.Count}
+		}
+	}
+	results := res.Results
+	if len(results) > offset+k {
+		results = results[:offset+k]
+		response.NextOffset = offset + k
+	}
+	if len(results) > offset {
+		results = results[offset:]
+	} else {
+		results = nil
+	}
+	for _, result := range results {
+		res := searchResult{DocID: result.DocID, Score: result.Score, Title: result.Title, Fields: result.Fields}
+		for _, fragment := range result.Snippet {
+			res.Snippet = append(res.Snippet, snippetFragment{fragment.Text, fragment.Match})
+		}
+		if explain {
+			explanation, err := s.engine.ExplainWith(req, result.DocID)
+			if err != nil {
+				return err
+			}
+			res.Explanation = explanation.String()
+		}
+		response.Results = append(response.Results, res)
+	}
+	writeJSON(w, http.StatusOK, response)
+	return nil
+}
+
+type documentRequest struct {
+	Title  string            `json:"title"`
+	Body   string            `json:"body"`
+	Fields map[string]string `json:"fields"`
+}
+
+func (d *documentRequest) document() ssego.Document {
+	return ssego.Document{Title: d.Title, Body: strings.NewReader(d.Body), Fields: d.Fields}
+}
+
+type documentResponse struct {
+	DocID         ssego.DocumentID `json:"docID"`
+	PreviousDocID ssego.DocumentID `json:"previousDocID,omitempty"`
+}
+
+func readDocument(w http.ResponseWriter, r *http.Request) (*documentRequest, error) {
+	var doc documentRequest
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, invalidArgument("invalid document: %v", err)
+	}
+	if strings.TrimSpace(doc.Title) == "" {
+		return nil, invalidArgument("title is required")
+	}
+	return &doc, nil
+}
+
+// POST /documents
+func (s *Server) documents(w http.ResponseWriter, r *http.Request) error {
+	if err := allowMethods(r, http.MethodPost); err != nil {
+		return err
+	}
+	doc, err := readDocument(w, r)
+	if err != nil {
+		return err
+	}
+	docID, err := s.engine.Index(doc.document())
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusCreated, documentResponse{DocID: docID})
+	return nil
+}
+
+// PUT, DELETE /documents/<id>
+func (s *Server) document(w http.ResponseWriter, r *http.Request) error {
+	if err := allowMethods(r, http.MethodPut, http.MethodDelete); err != nil {
+		return err
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/documents/"), 10, 64)
+	if err != nil || id < 1 {
+		return invalidArgument("invalid document id %q", strings.TrimPrefix(r.URL.Path, "/documents/"))
+	}
+	docID := ssego.DocumentID(id)
+
+	if r.Method == http.MethodDelete {
+		if err := s.engine.DeleteDocument(docID); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+
+	doc, err := readDocument(w, r)
+	if err != nil {
+		return err
+	}
+	// 置き換えたドキュメントには新しいIDが発行される
+	newID, err := s.engine.Replace(docID, doc.document())
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, documentResponse{DocID: newID, PreviousDocID: docID})
+	return nil
+}
+
+type termResponse struct {
+	Term    string `json:"term"`
+	DocFreq int    `json:"docFreq"`
+}
+
+type suggestResponse struct {
+	Prefix      string         `json:"prefix"`
+	Suggestions []termResponse `json:"suggestions"`
+}
+
+func (s *Server) suggest(w http.ResponseWriter, r *http.Request) error {
+	if err := allowMethods(r, http.MethodGet); err != nil {
+		return err
+	}
+	prefix := r.URL.Query().Get("prefix")
+	if prefix == "" {
+		return invalidArgument("prefix is required")
+	}
+	if utf8.RuneCountInString(prefix) < minSuggestChars {
+		return invalidArgument("prefix must be at least %d characters", minSuggestChars)
+	}
+	n, err := intParam(r, "n", 10, maxResults)
+	if err != nil {
+		return err
+	}
+	terms, err := s.engine.Suggest(prefix, n)
+	if err != nil {
+		return err
+	}
+	response := suggestResponse{Prefix: prefix, Suggestions: make([]termResponse, len(terms))}
+	for i, term := range terms {
+		response.Suggestions[i] = termResponse{term.Term, term.DocFreq}
+	}
+	writeJSON(w, http.StatusOK, response)
+	return nil
+}
+
+type statsResponse struct {
+	Generation     int            `json:"generation"`
+	DocCount       int            `json:"docCount"`
+	PendingDocs    int            `json:"pendingDocs"`
+	VocabularySize int            `json:"vocabularySize"`
+	PostingsCount  int            `json:"postingsCount"`
+	PostingsBytes  int64          `json:"postingsBytes"`
+	AvgDocLength   float64        `json:"avgDocLength"`
+	TopTerms       []termResponse `json:"topTerms"`
+}
+
+func (s *Server) stats(w http.ResponseWriter, r *http.Request) error {
+	if err := allowMethods(r, http.MethodGet); err != nil {
+		return err
+	}
+	top, err := intParam(r, "top", 10, maxResults)
+	if err != nil {
+		return err
+	}
+	stats, err := s.engine.Stats(top)
+	if err != nil {
+		return err
+	}
+	response := statsResponse{
+		Generation:     stats.Generation,
+		DocCount:       stats.DocCount,
+		PendingDocs:    stats.PendingDocs,
+		VocabularySize: stats.VocabularySize,
+		PostingsCount:  stats.PostingsCount,
+		PostingsBytes:  stats.PostingsBytes,
+		AvgDocLength:   stats.AvgDocLength,
+		TopTerms:       make([]termResponse, len(stats.TopTerms)),
+	}
+	for i, term := range stats.TopTerms {
+		response.TopTerms[i] = termResponse{term.Term, term.DocFreq}
+	}
+	writeJSON(w, http.StatusOK, response)
+	return nil
+}
+
+type fieldResponse struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Indexed bool   `json:"indexed"`
+	Stored  bool   `json:"stored"`
+	Facet   bool   `json:"facet"` // facetに指定して値を集計できるか
+}
+
+type schemaResponse struct {
+	Fields []fieldResponse `json:"fields"`
+}
+
+func (s *Server) schema(w http.ResponseWriter, r *http.Request) error {
+	if err := allowMethods(r, http.MethodGet); err != nil {
+		return err
+	}
+	response := schemaResponse{Fields: []fieldResponse{}}
+	for _, field := range s.engine.Schema().Fields {
+		response.Fields = append(response.Fields, fieldResponse{
+			Name:    field.Name,
+			Type:    string(field.Type),
+			Indexed: field.Indexed,
+			Stored:  field.Stored,
+			// text以外のフィールドはdoc valuesを持つので集計できる
+			Facet: field.Type != ssego.FieldText,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+	return nil
+}
@@ -0,0 +1,258 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"ssego"
+	"strings"
+	"testing"
+	"time"
+)
+
+// テスト用の検索エンジン
+type fakeEngine struct {
+	docs   map[ssego.DocumentID]string
+	nextID ssego.DocumentID
+	delay  time.Duration
+	scorer string // スコアの計算方法を指定しないときに使う設定の値
+}
+
+func newFakeEngine() *fakeEngine {
+	return &fakeEngine{docs: map[ssego.DocumentID]string{1: "test1", 2: "test2"}, nextID: 3, scorer: "TFIDF"}
+}
+
+func (e *fakeEngine) SearchWith(req ssego.SearchRequest) (*ssego.SearchResponse, error) {
+	time.Sleep(e.delay)
+	if req.Or != "" && req.Or != ssego.WAND {
+		return nil, fmt.Errorf("%w: unknown OR algorithm %q", ssego.ErrInvalidQuery, req.Or)
+	}
+	var results []*ssego.SearchResult
+	for docID, title := range e.docs {
+		result := &ssego.SearchResult{DocID: docID, Score: 1 / float64(docID), Title: title}
+		if req.Snippet {
+			result.Snippet = []ssego.SnippetFragment{{Text: "the ", Match: false}, {Text: req.Query, Match: true}}
+		}
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].DocID < results[j].DocID })
+	if len(req.Sort) == 1 && req.Sort[0] == (ssego.SortField{Field: ssego.SortByDocID, Desc: true}) {
+		sort.Slice(results, func(i, j int) bool { return results[i].DocID > results[j].DocID })
+	}
+	res := &ssego.SearchResponse{TotalHits: len(results)}
+	for _, field := range req.Facets {
+		if field != "author" {
+			return nil, fmt.Errorf("%w: unknown field %s", ssego.ErrInvalidQuery, field)
+		}
+		res.Facets = map[string][]ssego.FacetValue{field: {{Value: "Shakespeare", Count: len(results)}}}
+	}
+	if len(results) > req.K {
+		results = results[:req.K]
+	}
+	res.Results = results
+	return res, nil
+}
+
+func (e *fakeEngine) ExplainWith(req ssego.SearchRequest, docID ssego.DocumentID) (*ssego.Explanation, error) {
+	score := req.Score
+	if score == "" {
+		score = e.scorer
+	}
+	return &ssego.Explanation{Value: 1 / float64(docID), Description: strings.TrimSpace(score + " " + req.Or)}, nil
+}
+
+func (e *fakeEngine) Index(doc ssego.Document) (ssego.DocumentID, error) {
+	for name := range doc.Fields {
+		if name != "author" {
+			return 0, fmt.Errorf("%w: field %s is not defined in the schema", ssego.ErrInvalidDocument, name)
+		}
+	}
+	id := e.nextID
+	e.nextID++
+	e.docs[id] = doc.Title
+	return id, nil
+}
+
+func (e *fakeEngine) Replace(docID ssego.DocumentID, doc ssego.Document) (ssego.DocumentID, error) {
+	if err := e.DeleteDocument(docID); err != nil {
+		return 0, err
+	}
+	return e.Index(doc)
+}
+
+func (e *fakeEngine) DeleteDocument(docID ssego.DocumentID) error {
+	if _, ok := e.docs[docID]; !ok {
+		return ssego.ErrDocumentNotFound
+	}
+	delete(e.docs, docID)
+	return nil
+}
+
+func (e *fakeEngine) Suggest(prefix string, n int) ([]ssego.TermStats, error) {
+	return []ssego.TermStats{{Term: prefix + "rel", DocFreq: 2}}, nil
+}
+
+func (e *fakeEngine) Schema() *ssego.Schema {
+	return &ssego.Schema{Fields: []ssego.Field{
+		{Name: ssego.DefaultField, Type: ssego.FieldText, Indexed: true},
+		{Name: "author", Type: ssego.FieldKeyword, Indexed: true, Stored: true},
+	}}
+}
+
+func (e *fakeEngine) Stats(topN int) (*ssego.IndexStats, error) {
+	return &ssego.IndexStats{Generation: 1, DocCount: len(e.docs)}, nil
+}
+
+func TestServer(t *testing.T) {
+	engine := newFakeEngine()
+	srv := httptest.NewServer(New(engine, time.Second, true))
+	defer srv.Close()
+
+	type testCase struct {
+		method string
+		path   string
+		body   string
+		status int
+		want   string
+	}
+	testCases := []testCase{
+		{"GET", "/search?q=quarrel", "", 200, `{"query":"quarrel","results":[{"docID":1,"score":1,"title":"test1"},{"docID":2,"score":0.5,"title":"test2"}]}`},
+		{"GET", "/search?q=quarrel&k=1", "", 200, `{"query":"quarrel","results":[{"docID":1,"score":1,"title":"test1"}],"nextOffset":1}`},
+		// scoreを指定しなければ設定のスコアの計算方法を使う
+		{"GET", "/search?q=quarrel&k=1&offset=1&explain=true", "", 200, `{"query":"quarrel","results":[{"docID":2,"score":0.5,"title":"test2","explanation":"0.5 = TFIDF\n"}]}`},
+		{"GET", "/search?q=quarrel&k=1&offset=1&explain=true&score=BM25", "", 200, `{"query":"quarrel","results":[{"docID":2,"score":0.5,"title":"test2","explanation":"0.5 = BM25\n"}]}`},
+		{"GET", "/search?q=quarrel&k=1&explain=true&or=WAND", "", 200, `{"query":"quarrel","results":[{"docID":1,"score":1,"title":"test1","explanation":"1 = TFIDF WAND\n"}],"nextOffset":1}`},
+		{"GET", "/search?q=quarrel&or=Fastest", "", 400, `{"error":{"code":"invalid_argument","message":"invalid query: unknown OR algorithm \"Fastest\""}}`},
+		{"GET", "/search?q=quarrel&k=1&snippet=true", "", 200, `{"query":"quarrel","results":[{"docID":1,"score":1,"title":"test1","snippet":[{"text":"the "},{"text":"quarrel","match":true}]}],"nextOffset":1}`},
+		{"GET", "/search?q=quarrel&k=1&facet=author", "", 200, `{"query":"quarrel","results":[{"docID":1,"score":1,"title":"test1"}],"facets":{"author":[{"value":"Shakespeare","count":2}]},"nextOffset":1}`},
+		{"GET", "/search?q=quarrel&facet=genre", "", 400, `{"error":{"code":"invalid_argument","message":"invalid query: unknown field genre"}}`},
+		{"GET", "/search?q=quarrel&sort=_doc:desc", "", 200, `{"query":"quarrel","results":[{"docID":2,"score":0.5,"title":"test2"},{"docID":1,"score":1,"title":"test1"}]}`},
+		{"GET", "/search?q=quarrel&sort=_doc:down", "", 400, `{"error":{"code":"invalid_argument","message":"invalid query: unknown sort order \"down\"; use asc or desc"}}`},
+		{"GET", "/search?filter=author:Shakespeare&k=1", "", 200, `{"query":"","results":[{"docID":1,"score":1,"title":"test1"}],"nextOffset":1}`},
+		{"GET", "/search?q=quarrel&offset=5", "", 200, `{"query":"quarrel","results":[]}`},
+		{"GET", "/search?q=quarrel&offset=-1", "", 400, `{"error":{"code":"invalid_argument","message":"offset must be an integer between 0 and 990"}}`},
+		{"GET", "/search", "", 400, `{"error":{"code":"invalid_argument","message":"q is required"}}`},
+		{"GET", "/search?q=quarrel&k=0", "", 400, `{"error":{"code":"invalid_argument","message":"k must be an integer between 1 and 1000"}}`},
+		{"GET", "/search?q=quarrel&score=PageRank", "", 400, `{"error":{"code":"invalid_argument","message":"unknown score \"PageRank\"; use TFIDF or BM25"}}`},
+		{"POST", "/search?q=quarrel", "", 405, `{"error":{"code":"method_not_allowed","message":"method POST is not allowed; use GET"}}`},
+		{"POST", "/documents", `{"title":"test3","body":"No better.","fields":{"author":"Shakespeare"}}`, 201, `{"docID":3}`},
+		{"POST", "/documents", `{"body":"No better."}`, 400, `{"error":{"code":"invalid_argument","message":"title is required"}}`},
+		{"POST", "/documents", `{"title":"test5","body":"No better.","fields":{"year":"1600"}}`, 400, `{"error":{"code":"invalid_argument","message":"invalid document: field year is not defined in the schema"}}`},
+		{"PUT", "/documents/3", `{"title":"test3","body":"Well, sir"}`, 200, `{"docID":4,"previousDocID":3}`},
+		{"DELETE", "/documents/4", "", 204, ``},
+		{"DELETE", "/documents/4", "", 404, `{"error":{"code":"not_found","message":"document not found"}}`},
+		{"DELETE", "/documents/abc", "", 400, `{"error":{"code":"invalid_argument","message":"invalid document id \"abc\""}}`},
+		{"GET", "/suggest?prefix=quar", "", 200, `{"prefix":"quar","suggestions":[{"term":"quarrel","docFreq":2}]}`},
+		{"GET", "/suggest?prefix=q", "", 400, `{"error":{"code":"invalid_argument","message":"prefix must be at least 2 characters"}}`},
+		{"GET", "/stats", "", 200, `{"generation":1,"docCount":2,"pendingDocs":0,"vocabularySize":0,"postingsCount":0,"postingsBytes":0,"avgDocLength":0,"topTerms":[]}`},
+		{"GET", "/schema", "", 200, `{"fields":[{"name":"body","type":"text","indexed":true,"stored":false,"facet":false},{"name":"author","type":"keyword","indexed":true,"stored":true,"facet":true}]}`},
+		{"GET", "/unknown", "", 404, `{"error":{"code":"not_found","message":"/unknown is not found"}}`},
+	}
+
+	for _, testCase := range testCases {
+		req, err := http.NewRequest(testCase.method, srv.URL+testCase.path, strings.NewReader(testCase.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, body := do(t, req)
+		if status != testCase.status || body != testCase.want {
+			t.Fatalf("%s %s: got: %d %s\nwant: %d %s\n", testCase.method, testCase.path, status, body, testCase.status, testCase.want)
+		}
+	}
+}
+
+func TestServerConfiguredScorer(t *testing.T) {
+	engine := newFakeEngine()
+	engine.scorer = "BM25"
+	srv := httptest.NewServer(New(engine, time.Second, false))
+	defer srv.Close()
+
+	// scoreを指定しなければ、サーバーはTFIDFを既定値とせずに設定のスコアの計算方法に任せる
+	req, err := http.NewRequest("GET", srv.URL+"/search?q=quarrel&k=1&explain=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body := do(t, req)
+	want := `{"query":"quarrel","results":[{"docID":1,"score":1,"title":"test1","explanation":"1 = BM25\n"}],"nextOffset":1}`
+	if status != http.StatusOK || body != want {
+		t.Fatalf("got: %d %s\nwant: %d %s\n", status, body, http.StatusOK, want)
+	}
+}
+
+func TestServerUI(t *testing.T) {
+	srv := httptest.NewServer(New(newFakeEngine(), time.Second, true))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Request.URL.Path != "/ui/" || res.StatusCode != http.StatusOK {
+		t.Fatalf("got: %d %s\nwant: %d /ui/\n", res.StatusCode, res.Request.URL.Path, http.StatusOK)
+	}
+	if contentType := res.Header.Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Fatalf("got content type %q", contentType)
+	}
+	if !strings.Contains(string(body), "<title>ssego</title>") {
+		t.Fatalf("got: %s", body)
+	}
+
+	// UIを無効にしたときは提供しない
+	noUI := httptest.NewServer(New(newFakeEngine(), time.Second, false))
+	defer noUI.Close()
+	req, err := http.NewRequest("GET", noUI.URL+"/ui/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, _ := do(t, req); status != http.StatusNotFound {
+		t.Fatalf("got: %d\nwant: %d\n", status, http.StatusNotFound)
+	}
+}
+
+func TestServerTimeout(t *testing.T) {
+	engine := newFakeEngine()
+	engine.delay = 100 * time.Millisecond
+	srv := httptest.NewServer(New(engine, 10*time.Millisecond, false))
+	defer srv.Close()
+
+	req, err := http.NewRequest("GET", srv.URL+"/search?q=quarrel", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, body := do(t, req)
+	want := `{"error":{"code":"timeout","message":"request timed out"}}`
+	if status != http.StatusServiceUnavailable || body != want {
+		t.Fatalf("got: %d %s\nwant: %d %s\n", status, body, http.StatusServiceUnavailable, want)
+	}
+}
+
+// リクエストを送り、ステータスコードと改行を除いたレスポンスボディを返す
+func do(t *testing.T, req *http.Request) (int, string) {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(body) > 0 {
+		if contentType := res.Header.Get("Content-Type"); contentType != "application/json" {
+			t.Fatalf("got content type %q", contentType)
+		}
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			t.Fatalf("invalid json %s: %v", body, err)
+		}
+	}
+	return res.StatusCode, strings.TrimSpace(string(body))
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+)
+
+// 検索画面。検索は /search のAPIを呼び出して行う
+//
+//go:embed ui/index.html
+var indexHTML []byte
+
+// GET /ui/
+func serveUI(w http.ResponseWriter, r *http.Request) error {
+	if err := allowMethods(r, http.MethodGet, http.MethodHead); err != nil {
+		return err
+	}
+	if r.URL.Path != "/ui/" {
+		return &apiError{http.StatusNotFound, codeNotFound, fmt.Sprintf("%s is not found", r.URL.Path)}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(indexHTML)
+	return nil
+}
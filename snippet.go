@@ -0,0 +1,108 @@
+package ssego
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// 検索結果の抜粋に含める単語数のデフォルト値
+const defaultSnippetWords = 30
+
+// 本文の抜粋の一部分。Matchはクエリの用語に一致した単語
+type SnippetFragment struct {
+	Text  string
+	Match bool
+}
+
+// 本文を単語に分割し、用語になる単語のバイト範囲を返す
+// SplitFuncと同じく空白で区切り、英数字を含まない単語は除くので、
+// i番目の範囲が出現位置iの用語に対応する
+func (t *Tokenizer) wordOffsets(text string) [][2]int {
+	var offsets [][2]int
+	add := func(start, end int) {
+		if strings.Map(replace, text[start:end]) != "" {
+			offsets = append(offsets, [2]int{start, end})
+		}
+	}
+	start := -1
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				add(start, i)
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		add(start, len(text))
+	}
+	return offsets
+}
+
+// 本文のうちクエリの用語が最も多く出現するsize語を抜き出し、用語の出現位置の単語をMatchとする
+// positionsは本文の用語の出現位置。出現位置がなければ本文の先頭を返す
+func (t *Tokenizer) snippet(body string, positions []int, size int) []SnippetFragment {
+	offsets := t.wordOffsets(body)
+	if len(offsets) == 0 {
+		return nil
+	}
+	sort.Ints(positions)
+
+	// 出現位置を始点とする窓のうち、含まれる出現位置が最も多いものを選ぶ
+	start, best := 0, 0
+	for i, j := 0, 0; i < len(positions); i++ {
+		for j < len(positions) && positions[j] < positions[i]+size {
+			j++
+		}
+		if j-i > best {
+			start, best = positions[i], j-i
+		}
+	}
+	// 最初の出現位置の前の文脈も含める
+	start -= size / 4
+	if start+size > len(offsets) {
+		start = len(offsets) - size
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + size
+	if end > len(offsets) {
+		end = len(offsets)
+	}
+
+	var fragments []SnippetFragment
+	text := func(s string, match bool) {
+		if s != "" {
+			fragments = append(fragments, SnippetFragment{s, match})
+		}
+	}
+	prefix, suffix := "", ""
+	if start > 0 {
+		prefix = "… "
+	}
+	if end < len(offsets) {
+		suffix = " …"
+	}
+	from := offsets[start][0]
+	text(prefix, false)
+	for _, position := range positions {
+		if position < start || position >= end {
+			continue
+		}
+		word := offsets[position]
+		if word[0] < from {
+			// 同じ出現位置が重複している
+			continue
+		}
+		text(body[from:word[0]], false)
+		text(body[word[0]:word[1]], true)
+		from = word[1]
+	}
+	text(body[from:offsets[end-1][1]], false)
+	text(suffix, false)
+	return fragments
+}
@@ -0,0 +1,31 @@
+package ssego
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnippet(t *testing.T) {
+	tokenizer := NewTokenizer()
+	type testCase struct {
+		body      string
+		positions []int
+		size      int
+		expected  []SnippetFragment
+	}
+	testCases := []testCase{
+		// 英数字を含まない単語は用語にならないので、出現位置に数えない
+		{"Do -- you quarrel, sir?", []int{2, 3}, 10, []SnippetFragment{{"Do -- you ", false}, {"quarrel,", true}, {" ", false}, {"sir?", true}}},
+		// 出現位置が最も多く含まれる範囲を、前の文脈とともに抜き出す
+		{"a b c d e f g quarrel h quarrel i j", []int{0, 7, 9}, 4, []SnippetFragment{{"… ", false}, {"g ", false}, {"quarrel", true}, {" h ", false}, {"quarrel", true}, {" …", false}}},
+		// 出現位置がなければ先頭を返す
+		{"No better. Well, sir", nil, 2, []SnippetFragment{{"No better.", false}, {" …", false}}},
+		{" \n", nil, 2, nil},
+	}
+	for _, testCase := range testCases {
+		got := tokenizer.snippet(testCase.body, testCase.positions, testCase.size)
+		if !reflect.DeepEqual(got, testCase.expected) {
+			t.Fatalf("%q: got:%v\nexpected:%v\n", testCase.body, got, testCase.expected)
+		}
+	}
+}
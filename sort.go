@@ -0,0 +1,237 @@
+package ssego
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// フィールドのほかに結果を並べられる値
+// スキーマのフィールドの名前は英小文字で始まるので、_で始まる名前とは重ならない
+const (
+	SortByScore = "_score" // スコア
+	SortByDocID = "_doc"   // ドキュメントID
+	SortByTitle = "_title" // ドキュメントのタイトル
+)
+
+// 結果を並べるキー
+// 前のキーの値が同じドキュメントは次のキーで並べ、すべて同じならスコアの降順、ドキュメントIDの昇順に並べる
+type SortField struct {
+	Field string // 数値か日付のフィールドの名前、またはSortByScore, SortByDocID, SortByTitle
+	Desc  bool   // 降順に並べるか
+}
+
+// 「year:desc,_score」のようにカンマで区切った並び順を読み込む
+// 各キーには:ascか:descで向きを指定できる。指定しなければ_scoreは降順、それ以外は昇順とする
+func ParseSort(spec string) ([]SortField, error) {
+	var fields []SortField
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		name, order, _ := strings.Cut(key, ":")
+		field := SortField{Field: name, Desc: name == SortByScore}
+		switch order {
+		case "":
+		case "asc":
+			field.Desc = false
+		case "desc":
+			field.Desc = true
+		default:
+			return nil, fmt.Errorf("%w: unknown sort order %q; use asc or desc", ErrInvalidQuery, order)
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// 並び順に指定したキーを検証する
+func (e *Engine) sortFields(sort []SortField) ([]sortField, error) {
+	fields := make([]sortField, len(sort))
+	for i, s := range sort {
+		fields[i] = sortField{name: s.Field, desc: s.Desc}
+		switch s.Field {
+		case SortByScore, SortByDocID, SortByTitle:
+			continue
+		}
+		field, ok := e.schema.Field(s.Field)
+		if !ok {
+			return nil, fmt.Errorf("%w: cannot sort by unknown field %s", ErrInvalidQuery, s.Field)
+		}
+		if !field.isRange() {
+			return nil, fmt.Errorf("%w: cannot sort by %s field %s", ErrInvalidQuery, field.Type, s.Field)
+		}
+		fields[i].field = field
+	}
+	return fields, nil
+}
+
+// 並べるキー
+type sortField struct {
+	name  string
+	field *Field // 数値か日付のフィールド。スコアなどで並べるときはnil
+	desc  bool
+}
+
+// ドキュメントが持つ並べるキーの値
+type sortValue struct {
+	key     uint64 // 大小関係を保って変換した数値
+	text    string // タイトル
+	missing bool   // 値を持たない
+}
+
+// 並べるキーの値とともに保持するドキュメント
+type sortedDoc struct {
+	*ScoreDoc
+	values []sortValue
+}
+
+// sortCollectorは指定したキーの順に上位K件のみを保持するCollector
+// フィールドの値とタイトルはdoc valuesから読み込む。値を持たないドキュメントは昇順・降順にかかわらず最後に並べる
+type sortCollector struct {
+	k         int
+	totalHits int
+	fields    []sortField
+	values    func(docID DocumentID) map[string]string // ドキュメントの保存したフィールドの値
+	titles    func(docID DocumentID) (string, bool)    // ドキュメントのタイトル。取得できなければfalse
+	docs      []*sortedDoc                             // 順位の低いドキュメントを先頭に持つ最小ヒープ
+}
+
+func newSortCollector(k int, fields []sortField, values func(docID DocumentID) map[string]string, titles func(docID DocumentID) (string, bool)) *sortCollector {
+	if k < 0 {
+		k = 0
+	}
+	return &sortCollector{k: k, fields: fields, values: values, titles: titles, docs: make([]*sortedDoc, 0, k)}
+}
+
+func (c *sortCollector) Collect(doc *ScoreDoc) {
+	c.totalHits++
+	if c.k == 0 {
+		return
+	}
+	sorted := &sortedDoc{ScoreDoc: doc, values: c.sortValues(doc)}
+	if len(c.docs) < c.k {
+		heap.Push(c, sorted)
+		return
+	}
+	if c.after(c.docs[0], sorted) {
+		c.docs[0] = sorted
+		heap.Fix(c, 0)
+	}
+}
+
+func (c *sortCollector) sortValues(doc *ScoreDoc) []sortValue {
+	var stored map[string]string
+	values := make([]sortValue, len(c.fields))
+	for i, f := range c.fields {
+		switch f.name {
+		case SortByScore:
+			values[i].key = floatKey(doc.score)
+			continue
+		case SortByDocID:
+			values[i].key = uint64(doc.docID)
+			continue
+		case SortByTitle:
+			title, ok := c.titles(doc.docID)
+			values[i] = sortValue{text: title, missing: !ok}
+			continue
+		}
+		if stored == nil {
+			stored = c.values(doc.docID)
+		}
+		value, ok := stored[f.name]
+		if !ok {
+			values[i].missing = true
+			continue
+		}
+		key, err := f.field.rangeKey(value)
+		values[i] = sortValue{key: key, missing: err != nil}
+	}
+	return values
+}
+
+// aがbより後に並ぶか
+func (c *sortCollector) after(a, b *sortedDoc) bool {
+	for i, f := range c.fields {
+		x, y := a.values[i], b.values[i]
+		if x.missing != y.missing {
+			return x.missing
+		}
+		if x.key != y.key {
+			return (x.key < y.key) == f.desc
+		}
+		if x.text != y.text {
+			return (x.text < y.text) == f.desc
+		}
+	}
+	return scoreDocHeap(nil).less(a.ScoreDoc, b.ScoreDoc)
+}
+
+// 収集した結果を並び順に返す
+func (c *sortCollector) TopDocs() *TopDocs {
+	h := &sortCollector{fields: c.fields, docs: make([]*sortedDoc, len(c.docs))}
+	copy(h.docs, c.docs)
+	docs := make([]*ScoreDoc, len(c.docs))
+	for i := len(docs) - 1; i >= 0; i-- {
+		docs[i] = heap.Pop(h).(*sortedDoc).ScoreDoc
+	}
+	return &TopDocs{totalHits: c.totalHits, scoreDocs: docs}
+}
+
+func (c *sortCollector) Len() int           { return len(c.docs) }
+func (c *sortCollector) Less(i, j int) bool { return c.after(c.docs[i], c.docs[j]) }
+func (c *sortCollector) Swap(i, j int)      { c.docs[i], c.docs[j] = c.docs[j], c.docs[i] }
+
+func (c *sortCollector) Push(x interface{}) {
+	c.docs = append(c.docs, x.(*sortedDoc))
+}
+
+func (c *sortCollector) Pop() interface{} {
+	old := c.docs
+	n := len(old)
+	doc := old[n-1]
+	c.docs = old[:n-1]
+	return doc
+}
+
+// タイトルのキャッシュの上限(バイト)
+const defaultTitleCacheBytes = 8 << 20
+
+// タイトルで並べるときに使う、readerの世代とFlushされていないドキュメントに記録したタイトル
+// タイトルを記録していない以前の世代のドキュメントは、次のFlushまでDocumentStoreから読み込む
+func (e *Engine) titles(reader *nrtReader) func(docID DocumentID) (string, bool) {
+	return func(docID DocumentID) (string, bool) {
+		if title, ok := reader.title(docID); ok {
+			return title, true
+		}
+		return e.title(docID)
+	}
+}
+
+// DocumentStoreに保存したドキュメントのタイトル
+// ドキュメントIDは再利用されず、同じIDのタイトルは変わらないので、読み込んだタイトルはキャッシュする
+func (e *Engine) title(docID DocumentID) (string, bool) {
+	key := strconv.FormatInt(int64(docID), 10)
+	if title, ok := e.titleCache.get(key); ok {
+		return title.(string), true
+	}
+	title, err := e.documentStore.fetchTitle(docID)
+	if err != nil {
+		return "", false
+	}
+	e.titleCache.add(key, title, int64(len(key)+len(title)))
+	return title, true
+}
+
+// 浮動小数点数を、大小関係を保ったまま符号なし整数に変換する
+// 負の数はすべてのビットを反転し、正の数は符号ビットを立てると、符号なし整数として比較できる
+func floatKey(f float64) uint64 {
+	bits := math.Float64bits(f)
+	if bits>>63 == 1 {
+		return ^bits
+	}
+	return bits | 1<<63
+}
@@ -0,0 +1,687 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: ssegopb/ssego.proto
+
+// 検索エンジンのgRPCサービス
+
+package ssegopb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type SearchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Query string                 `protobuf:"bytes,1,opt,name=query,proto3" json:"query,omitempty"`
+	// 返す結果の上限。0のときは10件
+	K int32 `protobuf:"varint,2,opt,name=k,proto3" json:"k,omitempty"`
+	// スコアの計算方法(TFIDF または BM25)。空のときはエンジンに設定された計算方法
+	Score string `protobuf:"bytes,3,opt,name=score,proto3" json:"score,omitempty"`
+	// 空のときはすべての用語を含むドキュメントのみ返す
+	// Exhaustive, WAND, BlockMaxWAND, MaxScore のいずれかを指定すると、いずれかの用語を含むドキュメントを返す
+	Or            string `protobuf:"bytes,4,opt,name=or,proto3" json:"or,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchRequest) Reset() {
+	*x = SearchRequest{}
+	mi := &file_ssegopb_ssego_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchRequest) ProtoMessage() {}
+
+func (x *SearchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssegopb_ssego_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchRequest.ProtoReflect.Descriptor instead.
+func (*SearchRequest) Descriptor() ([]byte, []int) {
+	return file_ssegopb_ssego_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *SearchRequest) GetQuery() string {
+	if x != nil {
+		return x.Query
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetK() int32 {
+	if x != nil {
+		return x.K
+	}
+	return 0
+}
+
+func (x *SearchRequest) GetScore() string {
+	if x != nil {
+		return x.Score
+	}
+	return ""
+}
+
+func (x *SearchRequest) GetOr() string {
+	if x != nil {
+		return x.Or
+	}
+	return ""
+}
+
+type SearchResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Rank  int32                  `protobuf:"varint,1,opt,name=rank,proto3" json:"rank,omitempty"`
+	DocId int64                  `protobuf:"varint,2,opt,name=doc_id,json=docId,proto3" json:"doc_id,omitempty"`
+	Score float64                `protobuf:"fixed64,3,opt,name=score,proto3" json:"score,omitempty"`
+	Title string                 `protobuf:"bytes,4,opt,name=title,proto3" json:"title,omitempty"`
+	// スキーマでstoredとしたフィールドの値
+	Fields        map[string]string `protobuf:"bytes,5,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SearchResult) Reset() {
+	*x = SearchResult{}
+	mi := &file_ssegopb_ssego_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SearchResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SearchResult) ProtoMessage() {}
+
+func (x *SearchResult) ProtoReflect() protoreflect.Message {
+	mi := &file_ssegopb_ssego_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SearchResult.ProtoReflect.Descriptor instead.
+func (*SearchResult) Descriptor() ([]byte, []int) {
+	return file_ssegopb_ssego_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SearchResult) GetRank() int32 {
+	if x != nil {
+		return x.Rank
+	}
+	return 0
+}
+
+func (x *SearchResult) GetDocId() int64 {
+	if x != nil {
+		return x.DocId
+	}
+	return 0
+}
+
+func (x *SearchResult) GetScore() float64 {
+	if x != nil {
+		return x.Score
+	}
+	return 0
+}
+
+func (x *SearchResult) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *SearchResult) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type IndexRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Title string                 `protobuf:"bytes,1,opt,name=title,proto3" json:"title,omitempty"`
+	Body  string                 `protobuf:"bytes,2,opt,name=body,proto3" json:"body,omitempty"`
+	// スキーマで定義したフィールドの値
+	Fields        map[string]string `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IndexRequest) Reset() {
+	*x = IndexRequest{}
+	mi := &file_ssegopb_ssego_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IndexRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IndexRequest) ProtoMessage() {}
+
+func (x *IndexRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssegopb_ssego_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IndexRequest.ProtoReflect.Descriptor instead.
+func (*IndexRequest) Descriptor() ([]byte, []int) {
+	return file_ssegopb_ssego_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *IndexRequest) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *IndexRequest) GetBody() string {
+	if x != nil {
+		return x.Body
+	}
+	return ""
+}
+
+func (x *IndexRequest) GetFields() map[string]string {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+type IndexResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// 追加した順に発行されたドキュメントID
+	DocIds        []int64 `protobuf:"varint,1,rep,packed,name=doc_ids,json=docIds,proto3" json:"doc_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *IndexResponse) Reset() {
+	*x = IndexResponse{}
+	mi := &file_ssegopb_ssego_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *IndexResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*IndexResponse) ProtoMessage() {}
+
+func (x *IndexResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ssegopb_ssego_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use IndexResponse.ProtoReflect.Descriptor instead.
+func (*IndexResponse) Descriptor() ([]byte, []int) {
+	return file_ssegopb_ssego_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *IndexResponse) GetDocIds() []int64 {
+	if x != nil {
+		return x.DocIds
+	}
+	return nil
+}
+
+type DeleteRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DocId         int64                  `protobuf:"varint,1,opt,name=doc_id,json=docId,proto3" json:"doc_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteRequest) Reset() {
+	*x = DeleteRequest{}
+	mi := &file_ssegopb_ssego_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteRequest) ProtoMessage() {}
+
+func (x *DeleteRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssegopb_ssego_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteRequest.ProtoReflect.Descriptor instead.
+func (*DeleteRequest) Descriptor() ([]byte, []int) {
+	return file_ssegopb_ssego_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeleteRequest) GetDocId() int64 {
+	if x != nil {
+		return x.DocId
+	}
+	return 0
+}
+
+type DeleteResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteResponse) Reset() {
+	*x = DeleteResponse{}
+	mi := &file_ssegopb_ssego_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteResponse) ProtoMessage() {}
+
+func (x *DeleteResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ssegopb_ssego_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteResponse.ProtoReflect.Descriptor instead.
+func (*DeleteResponse) Descriptor() ([]byte, []int) {
+	return file_ssegopb_ssego_proto_rawDescGZIP(), []int{5}
+}
+
+type StatsRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// ドキュメント頻度の高い用語を返す件数
+	Top           int32 `protobuf:"varint,1,opt,name=top,proto3" json:"top,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatsRequest) Reset() {
+	*x = StatsRequest{}
+	mi := &file_ssegopb_ssego_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsRequest) ProtoMessage() {}
+
+func (x *StatsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_ssegopb_ssego_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsRequest.ProtoReflect.Descriptor instead.
+func (*StatsRequest) Descriptor() ([]byte, []int) {
+	return file_ssegopb_ssego_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StatsRequest) GetTop() int32 {
+	if x != nil {
+		return x.Top
+	}
+	return 0
+}
+
+type TermStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Term          string                 `protobuf:"bytes,1,opt,name=term,proto3" json:"term,omitempty"`
+	DocFreq       int64                  `protobuf:"varint,2,opt,name=doc_freq,json=docFreq,proto3" json:"doc_freq,omitempty"`
+	TotalTermFreq int64                  `protobuf:"varint,3,opt,name=total_term_freq,json=totalTermFreq,proto3" json:"total_term_freq,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TermStats) Reset() {
+	*x = TermStats{}
+	mi := &file_ssegopb_ssego_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TermStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TermStats) ProtoMessage() {}
+
+func (x *TermStats) ProtoReflect() protoreflect.Message {
+	mi := &file_ssegopb_ssego_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TermStats.ProtoReflect.Descriptor instead.
+func (*TermStats) Descriptor() ([]byte, []int) {
+	return file_ssegopb_ssego_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *TermStats) GetTerm() string {
+	if x != nil {
+		return x.Term
+	}
+	return ""
+}
+
+func (x *TermStats) GetDocFreq() int64 {
+	if x != nil {
+		return x.DocFreq
+	}
+	return 0
+}
+
+func (x *TermStats) GetTotalTermFreq() int64 {
+	if x != nil {
+		return x.TotalTermFreq
+	}
+	return 0
+}
+
+type StatsResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Generation     int64                  `protobuf:"varint,1,opt,name=generation,proto3" json:"generation,omitempty"`
+	DocCount       int64                  `protobuf:"varint,2,opt,name=doc_count,json=docCount,proto3" json:"doc_count,omitempty"`
+	PendingDocs    int64                  `protobuf:"varint,3,opt,name=pending_docs,json=pendingDocs,proto3" json:"pending_docs,omitempty"`
+	VocabularySize int64                  `protobuf:"varint,4,opt,name=vocabulary_size,json=vocabularySize,proto3" json:"vocabulary_size,omitempty"`
+	PostingsCount  int64                  `protobuf:"varint,5,opt,name=postings_count,json=postingsCount,proto3" json:"postings_count,omitempty"`
+	PostingsBytes  int64                  `protobuf:"varint,6,opt,name=postings_bytes,json=postingsBytes,proto3" json:"postings_bytes,omitempty"`
+	AvgDocLength   float64                `protobuf:"fixed64,7,opt,name=avg_doc_length,json=avgDocLength,proto3" json:"avg_doc_length,omitempty"`
+	TopTerms       []*TermStats           `protobuf:"bytes,8,rep,name=top_terms,json=topTerms,proto3" json:"top_terms,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *StatsResponse) Reset() {
+	*x = StatsResponse{}
+	mi := &file_ssegopb_ssego_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatsResponse) ProtoMessage() {}
+
+func (x *StatsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_ssegopb_ssego_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatsResponse.ProtoReflect.Descriptor instead.
+func (*StatsResponse) Descriptor() ([]byte, []int) {
+	return file_ssegopb_ssego_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *StatsResponse) GetGeneration() int64 {
+	if x != nil {
+		return x.Generation
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetDocCount() int64 {
+	if x != nil {
+		return x.DocCount
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetPendingDocs() int64 {
+	if x != nil {
+		return x.PendingDocs
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetVocabularySize() int64 {
+	if x != nil {
+		return x.VocabularySize
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetPostingsCount() int64 {
+	if x != nil {
+		return x.PostingsCount
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetPostingsBytes() int64 {
+	if x != nil {
+		return x.PostingsBytes
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetAvgDocLength() float64 {
+	if x != nil {
+		return x.AvgDocLength
+	}
+	return 0
+}
+
+func (x *StatsResponse) GetTopTerms() []*TermStats {
+	if x != nil {
+		return x.TopTerms
+	}
+	return nil
+}
+
+var File_ssegopb_ssego_proto protoreflect.FileDescriptor
+
+const file_ssegopb_ssego_proto_rawDesc = "" +
+	"\n" +
+	"\x13ssegopb/ssego.proto\x12\bssego.v1\"Y\n" +
+	"\rSearchRequest\x12\x14\n" +
+	"\x05query\x18\x01 \x01(\tR\x05query\x12\f\n" +
+	"\x01k\x18\x02 \x01(\x05R\x01k\x12\x14\n" +
+	"\x05score\x18\x03 \x01(\tR\x05score\x12\x0e\n" +
+	"\x02or\x18\x04 \x01(\tR\x02or\"\xdc\x01\n" +
+	"\fSearchResult\x12\x12\n" +
+	"\x04rank\x18\x01 \x01(\x05R\x04rank\x12\x15\n" +
+	"\x06doc_id\x18\x02 \x01(\x03R\x05docId\x12\x14\n" +
+	"\x05score\x18\x03 \x01(\x01R\x05score\x12\x14\n" +
+	"\x05title\x18\x04 \x01(\tR\x05title\x12:\n" +
+	"\x06fields\x18\x05 \x03(\v2\".ssego.v1.SearchResult.FieldsEntryR\x06fields\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xaf\x01\n" +
+	"\fIndexRequest\x12\x14\n" +
+	"\x05title\x18\x01 \x01(\tR\x05title\x12\x12\n" +
+	"\x04body\x18\x02 \x01(\tR\x04body\x12:\n" +
+	"\x06fields\x18\x03 \x03(\v2\".ssego.v1.IndexRequest.FieldsEntryR\x06fields\x1a9\n" +
+	"\vFieldsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"(\n" +
+	"\rIndexResponse\x12\x17\n" +
+	"\adoc_ids\x18\x01 \x03(\x03R\x06docIds\"&\n" +
+	"\rDeleteRequest\x12\x15\n" +
+	"\x06doc_id\x18\x01 \x01(\x03R\x05docId\"\x10\n" +
+	"\x0eDeleteResponse\" \n" +
+	"\fStatsRequest\x12\x10\n" +
+	"\x03top\x18\x01 \x01(\x05R\x03top\"b\n" +
+	"\tTermStats\x12\x12\n" +
+	"\x04term\x18\x01 \x01(\tR\x04term\x12\x19\n" +
+	"\bdoc_freq\x18\x02 \x01(\x03R\adocFreq\x12&\n" +
+	"\x0ftotal_term_freq\x18\x03 \x01(\x03R\rtotalTermFreq\"\xbe\x02\n" +
+	"\rStatsResponse\x12\x1e\n" +
+	"\n" +
+	"generation\x18\x01 \x01(\x03R\n" +
+	"generation\x12\x1b\n" +
+	"\tdoc_count\x18\x02 \x01(\x03R\bdocCount\x12!\n" +
+	"\fpending_docs\x18\x03 \x01(\x03R\vpendingDocs\x12'\n" +
+	"\x0fvocabulary_size\x18\x04 \x01(\x03R\x0evocabularySize\x12%\n" +
+	"\x0epostings_count\x18\x05 \x01(\x03R\rpostingsCount\x12%\n" +
+	"\x0epostings_bytes\x18\x06 \x01(\x03R\rpostingsBytes\x12$\n" +
+	"\x0eavg_doc_length\x18\a \x01(\x01R\favgDocLength\x120\n" +
+	"\ttop_terms\x18\b \x03(\v2\x13.ssego.v1.TermStatsR\btopTerms2\xfe\x01\n" +
+	"\fSearchEngine\x12;\n" +
+	"\x06Search\x12\x17.ssego.v1.SearchRequest\x1a\x16.ssego.v1.SearchResult0\x01\x12:\n" +
+	"\x05Index\x12\x16.ssego.v1.IndexRequest\x1a\x17.ssego.v1.IndexResponse(\x01\x12;\n" +
+	"\x06Delete\x12\x17.ssego.v1.DeleteRequest\x1a\x18.ssego.v1.DeleteResponse\x128\n" +
+	"\x05Stats\x12\x16.ssego.v1.StatsRequest\x1a\x17.ssego.v1.StatsResponseB\x0fZ\rssego/ssegopbb\x06proto3"
+
+var (
+	file_ssegopb_ssego_proto_rawDescOnce sync.Once
+	file_ssegopb_ssego_proto_rawDescData []byte
+)
+
+func file_ssegopb_ssego_proto_rawDescGZIP() []byte {
+	file_ssegopb_ssego_proto_rawDescOnce.Do(func() {
+		file_ssegopb_ssego_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_ssegopb_ssego_proto_rawDesc), len(file_ssegopb_ssego_proto_rawDesc)))
+	})
+	return file_ssegopb_ssego_proto_rawDescData
+}
+
+var file_ssegopb_ssego_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
+var file_ssegopb_ssego_proto_goTypes = []any{
+	(*SearchRequest)(nil),  // 0: ssego.v1.SearchRequest
+	(*SearchResult)(nil),   // 1: ssego.v1.SearchResult
+	(*IndexRequest)(nil),   // 2: ssego.v1.IndexRequest
+	(*IndexResponse)(nil),  // 3: ssego.v1.IndexResponse
+	(*DeleteRequest)(nil),  // 4: ssego.v1.DeleteRequest
+	(*DeleteResponse)(nil), // 5: ssego.v1.DeleteResponse
+	(*StatsRequest)(nil),   // 6: ssego.v1.StatsRequest
+	(*TermStats)(nil),      // 7: ssego.v1.TermStats
+	(*StatsResponse)(nil),  // 8: ssego.v1.StatsResponse
+	nil,                    // 9: ssego.v1.SearchResult.FieldsEntry
+	nil,                    // 10: ssego.v1.IndexRequest.FieldsEntry
+}
+var file_ssegopb_ssego_proto_depIdxs = []int32{
+	9,  // 0: ssego.v1.SearchResult.fields:type_name -> ssego.v1.SearchResult.FieldsEntry
+	10, // 1: ssego.v1.IndexRequest.fields:type_name -> ssego.v1.IndexRequest.FieldsEntry
+	7,  // 2: ssego.v1.StatsResponse.top_terms:type_name -> ssego.v1.TermStats
+	0,  // 3: ssego.v1.SearchEngine.Search:input_type -> ssego.v1.SearchRequest
+	2,  // 4: ssego.v1.SearchEngine.Index:input_type -> ssego.v1.IndexRequest
+	4,  // 5: ssego.v1.SearchEngine.Delete:input_type -> ssego.v1.DeleteRequest
+	6,  // 6: ssego.v1.SearchEngine.Stats:input_type -> ssego.v1.StatsRequest
+	1,  // 7: ssego.v1.SearchEngine.Search:output_type -> ssego.v1.SearchResult
+	3,  // 8: ssego.v1.SearchEngine.Index:output_type -> ssego.v1.IndexResponse
+	5,  // 9: ssego.v1.SearchEngine.Delete:output_type -> ssego.v1.DeleteResponse
+	8,  // 10: ssego.v1.SearchEngine.Stats:output_type -> ssego.v1.StatsResponse
+	7,  // [7:11] is the sub-list for method output_type
+	3,  // [3:7] is the sub-list for method input_type
+	3,  // [3:3] is the sub-list for extension type_name
+	3,  // [3:3] is the sub-list for extension extendee
+	0,  // [0:3] is the sub-list for field type_name
+}
+
+func init() { file_ssegopb_ssego_proto_init() }
+func file_ssegopb_ssego_proto_init() {
+	if File_ssegopb_ssego_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_ssegopb_ssego_proto_rawDesc), len(file_ssegopb_ssego_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   11,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_ssegopb_ssego_proto_goTypes,
+		DependencyIndexes: file_ssegopb_ssego_proto_depIdxs,
+		MessageInfos:      file_ssegopb_ssego_proto_msgTypes,
+	}.Build()
+	File_ssegopb_ssego_proto = out.File
+	file_ssegopb_ssego_proto_goTypes = nil
+	file_ssegopb_ssego_proto_depIdxs = nil
+}
@@ -0,0 +1,242 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: ssegopb/ssego.proto
+
+// 検索エンジンのgRPCサービス
+
+package ssegopb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	SearchEngine_Search_FullMethodName = "/ssego.v1.SearchEngine/Search"
+	SearchEngine_Index_FullMethodName  = "/ssego.v1.SearchEngine/Index"
+	SearchEngine_Delete_FullMethodName = "/ssego.v1.SearchEngine/Delete"
+	SearchEngine_Stats_FullMethodName  = "/ssego.v1.SearchEngine/Stats"
+)
+
+// SearchEngineClient is the client API for SearchEngine service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SearchEngineClient interface {
+	// 検索結果をスコアの高い順にストリームで返す
+	Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SearchResult], error)
+	// クライアントから送られたドキュメントを順にインデクスに追加する
+	Index(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IndexRequest, IndexResponse], error)
+	// ドキュメントを削除する
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+	// インデクスの統計情報を返す
+	Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error)
+}
+
+type searchEngineClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSearchEngineClient(cc grpc.ClientConnInterface) SearchEngineClient {
+	return &searchEngineClient{cc}
+}
+
+func (c *searchEngineClient) Search(ctx context.Context, in *SearchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[SearchResult], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SearchEngine_ServiceDesc.Streams[0], SearchEngine_Search_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[SearchRequest, SearchResult]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SearchEngine_SearchClient = grpc.ServerStreamingClient[SearchResult]
+
+func (c *searchEngineClient) Index(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[IndexRequest, IndexResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &SearchEngine_ServiceDesc.Streams[1], SearchEngine_Index_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[IndexRequest, IndexResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SearchEngine_IndexClient = grpc.ClientStreamingClient[IndexRequest, IndexResponse]
+
+func (c *searchEngineClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, SearchEngine_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *searchEngineClient) Stats(ctx context.Context, in *StatsRequest, opts ...grpc.CallOption) (*StatsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatsResponse)
+	err := c.cc.Invoke(ctx, SearchEngine_Stats_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SearchEngineServer is the server API for SearchEngine service.
+// All implementations must embed UnimplementedSearchEngineServer
+// for forward compatibility.
+type SearchEngineServer interface {
+	// 検索結果をスコアの高い順にストリームで返す
+	Search(*SearchRequest, grpc.ServerStreamingServer[SearchResult]) error
+	// クライアントから送られたドキュメントを順にインデクスに追加する
+	Index(grpc.ClientStreamingServer[IndexRequest, IndexResponse]) error
+	// ドキュメントを削除する
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	// インデクスの統計情報を返す
+	Stats(context.Context, *StatsRequest) (*StatsResponse, error)
+	mustEmbedUnimplementedSearchEngineServer()
+}
+
+// UnimplementedSearchEngineServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedSearchEngineServer struct{}
+
+func (UnimplementedSearchEngineServer) Search(*SearchRequest, grpc.ServerStreamingServer[SearchResult]) error {
+	return status.Errorf(codes.Unimplemented, "method Search not implemented")
+}
+func (UnimplementedSearchEngineServer) Index(grpc.ClientStreamingServer[IndexRequest, IndexResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method Index not implemented")
+}
+func (UnimplementedSearchEngineServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedSearchEngineServer) Stats(context.Context, *StatsRequest) (*StatsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Stats not implemented")
+}
+func (UnimplementedSearchEngineServer) mustEmbedUnimplementedSearchEngineServer() {}
+func (UnimplementedSearchEngineServer) testEmbeddedByValue()                      {}
+
+// UnsafeSearchEngineServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SearchEngineServer will
+// result in compilation errors.
+type UnsafeSearchEngineServer interface {
+	mustEmbedUnimplementedSearchEngineServer()
+}
+
+func RegisterSearchEngineServer(s grpc.ServiceRegistrar, srv SearchEngineServer) {
+	// If the following call pancis, it indicates UnimplementedSearchEngineServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&SearchEngine_ServiceDesc, srv)
+}
+
+func _SearchEngine_Search_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(SearchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SearchEngineServer).Search(m, &grpc.GenericServerStream[SearchRequest, SearchResult]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SearchEngine_SearchServer = grpc.ServerStreamingServer[SearchResult]
+
+func _SearchEngine_Index_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SearchEngineServer).Index(&grpc.GenericServerStream[IndexRequest, IndexResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type SearchEngine_IndexServer = grpc.ClientStreamingServer[IndexRequest, IndexResponse]
+
+func _SearchEngine_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SearchEngineServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SearchEngine_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SearchEngineServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SearchEngine_Stats_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SearchEngineServer).Stats(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: SearchEngine_Stats_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SearchEngineServer).Stats(ctx, req.(*StatsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SearchEngine_ServiceDesc is the grpc.ServiceDesc for SearchEngine service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SearchEngine_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ssego.v1.SearchEngine",
+	HandlerType: (*SearchEngineServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Delete",
+			Handler:    _SearchEngine_Delete_Handler,
+		},
+		{
+			MethodName: "Stats",
+			Handler:    _SearchEngine_Stats_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Search",
+			Handler:       _SearchEngine_Search_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Index",
+			Handler:       _SearchEngine_Index_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "ssegopb/ssego.proto",
+}
@@ -0,0 +1,172 @@
+package ssego
+
+import (
+	"container/heap"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// インデクスの統計情報
+type IndexStats struct {
+	Generation     int         // コミット済みの世代
+	DocCount       int         // コミット済みの世代に含まれるドキュメント数
+	PendingDocs    int         // まだFlushされていないドキュメント数
+	VocabularySize int         // 用語の数
+	PostingsCount  int         // Postingの総数
+	PostingsBytes  int64       // ポスティングリストのファイルの合計サイズ(バイト)
+	AvgDocLength   float64     // コミット済みの世代のドキュメントの、本文の平均の用語数
+	TopTerms       []TermStats // ドキュメント頻度の高い用語
+}
+
+// 用語の統計情報
+type TermStats struct {
+	Term          string
+	DocFreq       int // 用語を含むドキュメント数
+	TotalTermFreq int // すべてのドキュメントでの出現回数の合計
+}
+
+// コミット済みの世代の統計情報と、ドキュメント頻度の高い上位topN件の用語を返す
+// すべてのポスティングリストを読み込むので、インデクスの大きさに比例した時間がかかる
+func (e *Engine) Stats(topN int) (*IndexStats, error) {
+	e.mu.RLock()
+	reader := e.indexReader
+	pending := e.indexer.index.TotalDocsCount
+	segments := append([]string(nil), e.indexer.segments...)
+	e.mu.RUnlock()
+
+	stats, err := indexStats(reader.indexDir, topN)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := readCommit(e.indexDir)
+	if err != nil {
+		return nil, err
+	}
+	stats.Generation = commit.Generation
+	stats.PendingDocs = pending
+	for _, segment := range segments {
+		r, err := openSegment(segment)
+		if err != nil {
+			return nil, err
+		}
+		stats.PendingDocs += r.docCount
+		r.close()
+	}
+	return stats, nil
+}
+
+// 世代のディレクトリに保存されたポスティングリストから統計情報を求める
+// 平均の用語数は、DocumentStoreではなく世代のポスティングリストから求めて、ドキュメント数と同じドキュメントを対象とする
+func indexStats(dir string, topN int) (*IndexStats, error) {
+	stats := &IndexStats{}
+	if count, err := readDocCount(dir); err == nil {
+		stats.DocCount = count
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if isTermFile(file.Name()) {
+			stats.PostingsBytes += file.Size()
+		}
+	}
+
+	it, err := openGeneration(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer it.close()
+	top := make(termStatsHeap, 0, topN)
+	bodyTerms := 0 // 本文の用語の出現回数の合計
+	for {
+		ok, err := it.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		list := it.postings()
+		stats.VocabularySize++
+		stats.PostingsCount += list.Len()
+		// フィールドの用語は「フィールド名:値」となるので、本文の用語と区別できる
+		if !strings.Contains(it.term(), ":") {
+			bodyTerms += len(list.positions)
+		}
+
+		// 範囲検索のための用語は上位の桁ほど多くのドキュメントに現れるので、頻出語に含めない
+		if topN <= 0 || isTrieTerm(it.term()) {
+			continue
+		}
+		term := TermStats{Term: it.term(), DocFreq: list.Len(), TotalTermFreq: len(list.positions)}
+		if len(top) < topN {
+			heap.Push(&top, term)
+		} else if top.less(top[0], term) {
+			top[0] = term
+			heap.Fix(&top, 0)
+		}
+	}
+
+	if stats.DocCount > 0 {
+		stats.AvgDocLength = float64(bodyTerms) / float64(stats.DocCount)
+	}
+	stats.TopTerms = []TermStats(top)
+	sort.Slice(stats.TopTerms, func(i, j int) bool {
+		return top.less(stats.TopTerms[j], stats.TopTerms[i])
+	})
+	return stats, nil
+}
+
+// 用語のポスティングリストを返す
+// textはクエリと同じく「Quarrel,」や「title:Quarrel」のように指定でき、アナライザで1つの用語に変換する
+// Flushされていないドキュメントも含める。Flushされていない削除は反映されない
+// 用語が存在しなければnilを返す
+func (e *Engine) TermPostings(text string) (*PostingsList, error) {
+	parsed, err := e.parseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed.terms) != 1 {
+		return nil, fmt.Errorf("%w: %q is not a single term", ErrInvalidQuery, text)
+	}
+	term := parsed.terms[0]
+	reader, err := e.reader()
+	if err != nil {
+		return nil, err
+	}
+	t, err := reader.term(term)
+	if t == nil || err != nil {
+		return nil, err
+	}
+	return t.postings, nil
+}
+
+// ドキュメント頻度が最も低い用語を先頭に持つヒープ
+type termStatsHeap []TermStats
+
+// aの方がドキュメント頻度が低ければtrue。同じ場合は用語の辞書順で後ろのものを低いとする
+func (h termStatsHeap) less(a, b TermStats) bool {
+	if a.DocFreq != b.DocFreq {
+		return a.DocFreq < b.DocFreq
+	}
+	return a.Term > b.Term
+}
+
+func (h termStatsHeap) Len() int           { return len(h) }
+func (h termStatsHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h termStatsHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *termStatsHeap) Push(x interface{}) {
+	*h = append(*h, x.(TermStats))
+}
+
+func (h *termStatsHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	term := old[n-1]
+	*h = old[:n-1]
+	return term
+}
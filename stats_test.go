@@ -0,0 +1,37 @@
+package ssego
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestIndexStats(t *testing.T) {
+	dir := writeTestIndex(t, []string{
+		"Do you quarrel, sir?",
+		"Quarrel sir! no, sir!",
+		"No better.",
+		"Well, sir",
+	})
+	defer os.RemoveAll(dir)
+
+	stats, err := indexStats(committedDir(dir), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.VocabularySize != 7 || stats.PostingsCount != 11 || stats.PostingsBytes == 0 {
+		t.Fatalf("got: %+v", stats)
+	}
+	// ドキュメント数と平均の用語数は同じ世代のドキュメントから求める
+	if stats.DocCount != 4 || stats.AvgDocLength != 3 {
+		t.Fatalf("got: %+v", stats)
+	}
+	expected := []TermStats{
+		{"sir", 3, 4},
+		{"no", 2, 2},
+		{"quarrel", 2, 2},
+	}
+	if !reflect.DeepEqual(stats.TopTerms, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", stats.TopTerms, expected)
+	}
+}
@@ -0,0 +1,122 @@
+package ssego
+
+import (
+	"container/heap"
+	"sort"
+	"strings"
+)
+
+// prefixで始まる用語をドキュメント頻度の高い順にn件返す
+// Flushされていないドキュメントの用語も含める
+// コミット済みの世代は用語の統計情報を読むので、ポスティングリストは読み込まない
+func (e *Engine) Suggest(prefix string, n int) ([]TermStats, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	reader, err := e.reader()
+	if err != nil {
+		return nil, err
+	}
+	// フィールドを指定した用語は、prefixでフィールドを指定したときのみ候補にする
+	// 範囲検索のための用語は候補にしない
+	// keywordの値は大文字と小文字を区別するので、そのまま探す
+	fields := strings.Contains(prefix, ":")
+	if !fields {
+		prefix = strings.ToLower(prefix)
+	}
+
+	top := make(termStatsHeap, 0, n)
+	for _, stats := range reader.termStats(prefix) {
+		if (!fields && strings.Contains(stats.Term, ":")) || isTrieTerm(stats.Term) {
+			continue
+		}
+		if len(top) < n {
+			heap.Push(&top, stats)
+		} else if top.less(top[0], stats) {
+			top[0] = stats
+			heap.Fix(&top, 0)
+		}
+	}
+
+	suggestions := []TermStats(top)
+	sort.Slice(suggestions, func(i, j int) bool {
+		return top.less(suggestions[j], suggestions[i])
+	})
+	return suggestions, nil
+}
+
+// コミット済みの世代の用語のうち、prefixで始まるものの統計情報を辞書順に返す
+// _termsのない以前の世代では、ポスティングリストを読み込んで求める。キャッシュを追い出さないように、キャッシュには加えない
+func (r *IndexReader) termStats(prefix string) []TermStats {
+	r.dictOnce.Do(func() {
+		// 読み込めなければ用語がないものとする
+		if r.dict, _ = readTermDictionary(r.indexDir); r.dict == nil {
+			r.vocab, _ = termFiles(r.indexDir)
+		}
+	})
+	if r.dict != nil {
+		i := sort.Search(len(r.dict), func(i int) bool { return r.dict[i].Term >= prefix })
+		j := i
+		for j < len(r.dict) && strings.HasPrefix(r.dict[j].Term, prefix) {
+			j++
+		}
+		return r.dict[i:j:j]
+	}
+
+	var stats []TermStats
+	for _, term := range r.vocab[sort.SearchStrings(r.vocab, prefix):] {
+		if !strings.HasPrefix(term, prefix) {
+			break
+		}
+		var t *cachedTerm
+		if cached, ok := r.termCache.get(term); ok {
+			t = cached.(*cachedTerm)
+		} else {
+			// 読み込めない用語は候補に含めない
+			t, _ = r.loadTerm(term)
+		}
+		if t != nil {
+			stats = append(stats, TermStats{Term: term, DocFreq: t.postings.Len(), TotalTermFreq: len(t.postings.positions)})
+		}
+	}
+	return stats
+}
+
+// コミット済みの世代の用語の統計情報に、セグメントとメモリ上のインデクスの用語を加えて、prefixで始まるものを辞書順に返す
+// Flushされていないドキュメントはコミット済みの世代に含まれないので、ドキュメント頻度と出現回数はそのまま足せる
+func (r *nrtReader) termStats(prefix string) []TermStats {
+	disk := r.disk.termStats(prefix)
+	stats := make([]TermStats, len(disk), len(disk))
+	copy(stats, disk)
+	index := make(map[string]int, len(stats))
+	for i, s := range stats {
+		index[s.Term] = i
+	}
+
+	unflushed := make(map[string]bool)
+	for _, segment := range r.segments {
+		for term := range segment.offsets {
+			if strings.HasPrefix(term, prefix) {
+				unflushed[term] = true
+			}
+		}
+	}
+	for term := range r.memory.Dictionary {
+		if strings.HasPrefix(term, prefix) {
+			unflushed[term] = true
+		}
+	}
+	for term := range unflushed {
+		list, _ := r.unflushedPostings(term)
+		if i, ok := index[term]; ok {
+			stats[i].DocFreq += list.Len()
+			stats[i].TotalTermFreq += len(list.positions)
+			continue
+		}
+		stats = append(stats, TermStats{Term: term, DocFreq: list.Len(), TotalTermFreq: len(list.positions)})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Term < stats[j].Term
+	})
+	return stats
+}
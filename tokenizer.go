@@ -3,6 +3,7 @@ package ssego
 import (
 	"bufio"
 	"bytes"
+	"io"
 	"strings"
 	"unicode"
 )
@@ -49,3 +50,17 @@ func (t *Tokenizer) TextToWordSequence(text string) []string {
 
 	return result
 }
+
+// io.Readerから読んだデータを分解する処理
+func (t *Tokenizer) ReaderToWordSequence(reader io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Split(t.SplitFunc)
+
+	var result []string
+
+	for scanner.Scan() {
+		result = append(result, scanner.Text())
+	}
+
+	return result, scanner.Err()
+}
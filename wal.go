@@ -0,0 +1,174 @@
+package ssego
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// ログ先行書き込み(WAL)のファイル名
+const walFileName = "_wal"
+
+// WALに記録する操作
+const (
+	walAdd    = "add"
+	walDelete = "delete"
+)
+
+// WALの1レコード
+// ドキュメントの追加では、再起動時にインデクスを作り直せるように分割済みの用語を記録する
+type walRecord struct {
+	Seq    int64             // 記録した順に振られる連番
+	Op     string            // 操作の種類
+	DocID  DocumentID        // 対象のドキュメントID
+	Title  string            `json:",omitempty"`
+	Terms  []string          `json:",omitempty"`
+	Fields map[string]string `json:",omitempty"` // 保存するフィールドの値
+}
+
+// writeAheadLogはFlushされていないドキュメントの追加・削除を記録する
+// Engineはメモリ上のインデクスを更新する前にWALに追記してディスクに同期し、
+// 起動時にまだコミットされていないレコードを再生してメモリ上のインデクスを復元する
+type writeAheadLog struct {
+	mu       sync.Mutex
+	filename string
+	file     *os.File
+	seq      int64 // 最後に記録したレコードの連番
+}
+
+// WALを開き、連番がafterより大きいレコードをapplyに渡して再生する
+func openWAL(filename string, after int64, apply func(walRecord)) (*writeAheadLog, error) {
+	w := &writeAheadLog{filename: filename, seq: after}
+	if err := w.replay(after, apply); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	w.file = file
+	return w, nil
+}
+
+func (w *writeAheadLog) replay(after int64, apply func(walRecord)) error {
+	file, err := os.Open(w.filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<30)
+	for scanner.Scan() {
+		var record walRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			// 追記の途中でクラッシュした最後のレコードは捨てる
+			break
+		}
+		if record.Seq > w.seq {
+			w.seq = record.Seq
+		}
+		if record.Seq > after {
+			apply(record)
+		}
+	}
+	return scanner.Err()
+}
+
+// レコードに連番を振って追記し、ディスクに同期する
+// 複数のレコードを渡した場合は、まとめて追記してから1度だけ同期する
+func (w *writeAheadLog) append(records ...walRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var buf []byte
+	seq := w.seq
+	for _, record := range records {
+		seq++
+		record.Seq = seq
+		bytes, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, bytes...), '\n')
+	}
+	if _, err := w.file.Write(buf); err != nil {
+		return err
+	}
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	w.seq = seq
+	return nil
+}
+
+// 連番がafterより大きいレコードを返す
+func (w *writeAheadLog) records(after int64) ([]walRecord, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var records []walRecord
+	err := w.replay(after, func(record walRecord) {
+		records = append(records, record)
+	})
+	return records, err
+}
+
+// 最後に記録したレコードの連番
+func (w *writeAheadLog) lastSeq() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.seq
+}
+
+// 連番がseq以下のレコードはコミットされたので、WALを空にする
+// seqより後に追記されたレコードは残す
+func (w *writeAheadLog) truncate(seq int64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var rest []walRecord
+	if err := w.replay(seq, func(record walRecord) {
+		rest = append(rest, record)
+	}); err != nil {
+		return err
+	}
+
+	tmp := w.filename + tmpSuffix
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, record := range rest {
+		if err := encoder.Encode(record); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	file.Close()
+
+	if err := os.Rename(tmp, w.filename); err != nil {
+		return err
+	}
+	w.file.Close()
+	w.file, err = os.OpenFile(w.filename, os.O_WRONLY|os.O_APPEND, 0666)
+	return err
+}
+
+func (w *writeAheadLog) close() error {
+	return w.file.Close()
+}
@@ -0,0 +1,137 @@
+package ssego
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWALReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, walFileName)
+
+	replay := func(after int64) []walRecord {
+		var records []walRecord
+		wal, err := openWAL(filename, after, func(record walRecord) {
+			records = append(records, record)
+		})
+		if err != nil {
+			t.Fatalf("failed to open wal: %v", err)
+		}
+		defer wal.close()
+		return records
+	}
+
+	wal, err := openWAL(filename, 0, func(walRecord) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = wal.append(
+		walRecord{Op: walAdd, DocID: 1, Title: "test1", Terms: []string{"do", "you"}},
+		walRecord{Op: walAdd, DocID: 2, Title: "test2", Terms: []string{"no"}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.truncate(1); err != nil {
+		t.Fatal(err)
+	}
+	if err := wal.append(walRecord{Op: walDelete, DocID: 1}); err != nil {
+		t.Fatal(err)
+	}
+	wal.close()
+
+	// 追記の途中でクラッシュしたレコード
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"Seq":4,"Op":"add"`)
+	file.Close()
+
+	expected := []walRecord{
+		{Seq: 2, Op: walAdd, DocID: 2, Title: "test2", Terms: []string{"no"}},
+		{Seq: 3, Op: walDelete, DocID: 1},
+	}
+	if got := replay(0); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+	// コミット済みのレコードは再生しない
+	if got := replay(2); !reflect.DeepEqual(got, expected[1:]) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected[1:])
+	}
+}
+
+func TestFlushDeleted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ssego")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	indexer := NewIndexer(NewTokenizer())
+	indexer.update(1, strings.NewReader("Do you quarrel, sir?"))
+	indexer.update(2, strings.NewReader("No better."))
+	if err := NewIndexWriter(dir).Flush(indexer.index); err != nil {
+		t.Fatal(err)
+	}
+
+	// コミット済みのドキュメントと追加したばかりのドキュメントを削除する
+	indexer = NewIndexer(NewTokenizer())
+	indexer.update(3, strings.NewReader("Quarrel sir! no, sir!"))
+	indexer.update(4, strings.NewReader("Well, sir"))
+	indexer.update(5, strings.NewReader(""))
+	indexer.delete(1)
+	indexer.delete(4)
+	req := flushRequest{index: indexer.index, added: &indexer.added, deleted: indexer.deleted, walSeq: 7, nextDocID: 6}
+	if err := NewIndexWriter(dir).flush(req); err != nil {
+		t.Fatal(err)
+	}
+
+	reader := NewIndexReader(dir)
+	expected := NewPostingsList(NewPosting(3, 1, 3))
+	if got := reader.postings("sir"); !reflect.DeepEqual(*got, expected) {
+		t.Fatalf("got:%v\nexpected:%v\n", got, expected)
+	}
+	if got := reader.postings("you"); got != nil {
+		t.Fatalf("got:%v\nexpected:nil\n", got)
+	}
+	if got := reader.totalDocCount(); got != 3 {
+		t.Fatalf("got:%v\nexpected:%v\n", got, 3)
+	}
+	commit, err := readCommit(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := (commitPoint{Generation: 2, DocCount: 3, WALSeq: 7, NextDocID: 6}); commit != expected {
+		t.Fatalf("got:%+v\nexpected:%+v\n", commit, expected)
+	}
+
+	// 用語を持たないドキュメントの削除もドキュメント数に反映する
+	indexer = NewIndexer(NewTokenizer())
+	indexer.delete(5)
+	req = flushRequest{index: indexer.index, added: &indexer.added, deleted: indexer.deleted, walSeq: 8, nextDocID: 6}
+	if err := NewIndexWriter(dir).flush(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := NewIndexReader(dir).totalDocCount(); got != 2 {
+		t.Fatalf("got:%v\nexpected:%v\n", got, 2)
+	}
+	live, err := readLiveDocs(committedDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	docs := &bitset{}
+	docs.add(2)
+	docs.add(3)
+	if !live.equal(docs) {
+		t.Fatalf("got:%v\nexpected:%v\n", live.words, docs.words)
+	}
+}
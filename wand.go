@@ -0,0 +1,296 @@
+package ssego
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// OR検索でのドキュメントの評価方法
+const (
+	Exhaustive   = "Exhaustive"   // いずれかの用語を含むすべてのドキュメントのスコアを計算する
+	WAND         = "WAND"         // 用語ごとのスコア上限値で上位K件に入らないドキュメントを読み飛ばす
+	BlockMaxWAND = "BlockMaxWAND" // WANDに加えてブロックごとのスコア上限値で読み飛ばす
+	MaxScore     = "MaxScore"     // スコア上限値の小さい用語を非必須として、必須の用語を含むドキュメントのみ評価する
+)
+
+// 動的枝刈りで使う、スコア上限値をもったカーソル
+type termCursor struct {
+	*Cursor
+	scorer     *Scorer
+	blockMaxes *BlockMaxes // ブロックごとの最大出現回数
+	docCount   int         // 用語が含まれているドキュメント数
+	boost      float64     // 用語のスコアに掛ける重み
+	maxScore   float64     // この用語がスコアに寄与する値の上限
+}
+
+// 現在のドキュメントに対してこの用語が寄与するスコア。termCountはBM25で使うドキュメントの用語数
+func (c *termCursor) score(termCount int) float64 {
+	return c.boost * c.scorer.termScore(c.TermFrequency(), c.docCount, termCount)
+}
+
+// targetを含むブロックのスコア上限値と、そのブロックの最後のDocIDを返す
+// ポスティングは読み進めずにブロックの情報だけを参照する
+func (c *termCursor) blockMaxScore(target DocumentID) (float64, DocumentID) {
+	block, ok := c.blockMaxes.block(target)
+	if !ok {
+		return 0, math.MaxInt64
+	}
+	return c.boost * c.scorer.maxTermScore(block.MaxTF, c.docCount), block.LastDocID
+}
+
+// 複数の用語のいずれかを含むドキュメントを検索し、スコアが高い順にK件結果を返す
+// algorithmにWAND, BlockMaxWAND, MaxScoreを指定すると、上位K件に入りえないドキュメントのスコア計算を省略する
+// その場合、totalHitsはスコアを計算してマッチしたドキュメント数となり、実際のヒット件数より少なくなりうる
+func (s *Searcher) SearchTopKOr(query []string, k int, algorithm string) *TopDocs {
+	collector := NewTopKCollector(k)
+	s.SearchOr(query, collector, algorithm)
+	top := collector.TopDocs()
+	top.scoredDocs = s.scoredDocs
+	return top
+}
+
+// 複数の用語のいずれかを含むドキュメントを検索し、マッチしたドキュメントをスコアとともにcollectorに渡す
+// 読み飛ばしには上位K件の足切りスコアが必要なので、collectorが*TopKCollectorでなければalgorithmにかかわらずすべて評価する
+func (s *Searcher) SearchOr(query []string, collector Collector, algorithm string) {
+	s.scoredDocs, s.err = 0, nil
+	if len(query) == 0 {
+		s.search(query, collector)
+		return
+	}
+	cursors := s.openTermCursors(query)
+	topK, ok := collector.(*TopKCollector)
+	if !ok {
+		s.exhaustive(cursors, collector)
+		return
+	}
+
+	switch algorithm {
+	case WAND:
+		s.wand(cursors, topK, false)
+	case BlockMaxWAND:
+		s.wand(cursors, topK, true)
+	case MaxScore:
+		s.maxScore(cursors, topK)
+	default:
+		s.exhaustive(cursors, topK)
+	}
+}
+
+// OR検索の評価方法を検証する。空ならAND検索とする
+func checkOrAlgorithm(algorithm string) error {
+	switch algorithm {
+	case "", Exhaustive, WAND, BlockMaxWAND, MaxScore:
+		return nil
+	}
+	return fmt.Errorf("%w: unknown OR algorithm %q; use %s, %s, %s or %s", ErrInvalidQuery, algorithm, Exhaustive, WAND, BlockMaxWAND, MaxScore)
+}
+
+func (s *Searcher) openTermCursors(query []string) []*termCursor {
+	scorer := &Scorer{indexReader: s.indexReader, score: s.score}
+	cursors := make([]*termCursor, 0, len(query))
+	for i, term := range query {
+		t, err := s.indexReader.term(term)
+		if err != nil {
+			s.err = err
+			return nil
+		}
+		if t == nil {
+			continue
+		}
+		docCount := t.postings.Len()
+		boost := s.boost(i)
+		cursors = append(cursors, &termCursor{
+			Cursor:     t.postings.OpenCursor(),
+			scorer:     scorer,
+			blockMaxes: t.blockMaxes,
+			docCount:   docCount,
+			boost:      boost,
+			maxScore:   boost * scorer.maxTermScore(t.blockMaxes.MaxTF, docCount),
+		})
+	}
+	return cursors
+}
+
+// いずれかの用語を含むすべてのドキュメントのスコアを計算する
+func (s *Searcher) exhaustive(cursors []*termCursor, collector Collector) {
+	for {
+		docID, ok := minDocID(cursors)
+		if !ok {
+			return
+		}
+		var score float64
+		termCount := s.termCount(docID)
+		for _, c := range cursors {
+			if !c.Empty() && c.DocID() == docID {
+				score += c.score(termCount)
+				c.Next()
+			}
+		}
+		s.collect(collector, docID, score)
+	}
+}
+
+// WAND (Weak AND) / Block-Max WAND
+// カーソルをDocIDの順に並べ、スコア上限値の累積が上位K件の足切りスコアを超えるカーソル(ピボット)を探す
+// ピボットより前のDocIDを持つドキュメントは上位K件に入りえないので、スコアを計算せずに読み飛ばす
+func (s *Searcher) wand(cursors []*termCursor, collector *TopKCollector, blockMax bool) {
+	for {
+		cursors = nonEmptyCursors(cursors)
+		if len(cursors) == 0 {
+			return
+		}
+		sort.Slice(cursors, func(i, j int) bool {
+			return cursors[i].DocID() < cursors[j].DocID()
+		})
+
+		threshold, full := collector.threshold()
+
+		// ピボットの選択
+		pivot := -1
+		var upper float64
+		for i, c := range cursors {
+			upper += c.maxScore
+			if !full || upper > threshold {
+				pivot = i
+				break
+			}
+		}
+		if pivot < 0 {
+			// 残りのどのドキュメントも上位K件に入りえない
+			return
+		}
+		pivotDocID := cursors[pivot].DocID()
+		// ピボットと同じドキュメントを指しているカーソルもスコアに寄与するので含める
+		for pivot+1 < len(cursors) && cursors[pivot+1].DocID() == pivotDocID {
+			pivot++
+		}
+
+		if blockMax && full {
+			// ピボットのドキュメントを含むブロックのスコア上限値で足切りする
+			var blockUpper float64
+			next := DocumentID(math.MaxInt64)
+			for _, c := range cursors[:pivot+1] {
+				score, last := c.blockMaxScore(pivotDocID)
+				blockUpper += score
+				if last < next-1 {
+					next = last + 1
+				}
+			}
+			if blockUpper <= threshold {
+				// いずれかのブロックが終わるか、ピボットより後ろのカーソルのドキュメントまで読み飛ばす
+				if pivot+1 < len(cursors) && cursors[pivot+1].DocID() < next {
+					next = cursors[pivot+1].DocID()
+				}
+				for _, c := range cursors[:pivot+1] {
+					c.NextDoc(next)
+				}
+				continue
+			}
+		}
+
+		if cursors[0].DocID() == pivotDocID {
+			// ピボットまでのカーソルがすべて同じドキュメントを指しているのでスコアを計算する
+			var score float64
+			termCount := s.termCount(pivotDocID)
+			for _, c := range cursors[:pivot+1] {
+				score += c.score(termCount)
+				c.Next()
+			}
+			s.collect(collector, pivotDocID, score)
+		} else {
+			// ピボットより前のカーソルをピボットのドキュメントまで読み飛ばす
+			for _, c := range cursors[:pivot] {
+				c.NextDoc(pivotDocID)
+			}
+		}
+	}
+}
+
+// MaxScore
+// 用語をスコア上限値の昇順に並べ、上限値の合計が足切りスコア以下になる用語を非必須とする
+// 非必須の用語だけを含むドキュメントは上位K件に入りえないので、必須の用語を含むドキュメントのみ評価する
+func (s *Searcher) maxScore(cursors []*termCursor, collector *TopKCollector) {
+	sort.Slice(cursors, func(i, j int) bool {
+		return cursors[i].maxScore < cursors[j].maxScore
+	})
+
+	// upper[i]はcursors[0]からcursors[i]までのスコア上限値の合計
+	upper := make([]float64, len(cursors))
+	var sum float64
+	for i, c := range cursors {
+		sum += c.maxScore
+		upper[i] = sum
+	}
+
+	essential := 0 // cursors[essential:]が必須の用語
+	for {
+		threshold, full := collector.threshold()
+		for full && essential < len(cursors) && upper[essential] <= threshold {
+			essential++
+		}
+
+		docID, ok := minDocID(cursors[essential:])
+		if !ok {
+			return
+		}
+
+		var score float64
+		termCount := s.termCount(docID)
+		for _, c := range cursors[essential:] {
+			if !c.Empty() && c.DocID() == docID {
+				score += c.score(termCount)
+				c.Next()
+			}
+		}
+
+		// 非必須の用語はスコア上限値の大きい順に、上位K件に入る見込みがある間だけ評価する
+		for i := essential - 1; i >= 0; i-- {
+			if full && score+upper[i] <= threshold {
+				break
+			}
+			c := cursors[i]
+			if c.NextDoc(docID); !c.Empty() && c.DocID() == docID {
+				score += c.score(termCount)
+			}
+		}
+
+		s.collect(collector, docID, score)
+	}
+}
+
+// スコアを計算したドキュメントをcollectorに渡す
+// 削除済みのドキュメントとフィルタに含まれないドキュメントは渡さない
+func (s *Searcher) collect(collector Collector, docID DocumentID, score float64) {
+	s.scoredDocs++
+	if s.deleted[docID] || !s.accepts(docID) {
+		return
+	}
+	collector.Collect(&ScoreDoc{docID: docID, score: score})
+}
+
+// カーソルが指しているDocIDのうち最小のものを返す
+func minDocID(cursors []*termCursor) (DocumentID, bool) {
+	var docID DocumentID
+	found := false
+	for _, c := range cursors {
+		if c.Empty() {
+			continue
+		}
+		if !found || c.DocID() < docID {
+			docID = c.DocID()
+			found = true
+		}
+	}
+	return docID, found
+}
+
+func nonEmptyCursors(cursors []*termCursor) []*termCursor {
+	result := cursors[:0]
+	for _, c := range cursors {
+		if !c.Empty() {
+			result = append(result, c)
+		}
+	}
+	return result
+}